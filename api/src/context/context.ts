@@ -13,14 +13,18 @@ export class Context {
   constructor(private readonly stores: Stores) {}
 
   public session: Session;
+  // authorization is the authorization header of the request, for requests that are made to the kotsadm api
+  // on behalf of the user
+  public authorization: string;
 
-  public static async fetch(stores: Stores, token: string): Promise<Context> {
+  public static async fetch(stores: Stores, token: string, authorization: string = ""): Promise<Context> {
     const pool = await getPostgresPool();
     const params = await Params.getParams();
     const sessionStore = new SessionStore(pool, params);
 
     const context = new Context(stores);
     context.session = await sessionStore.decode(token);
+    context.authorization = authorization;
     return context;
   }
 
@@ -3,7 +3,7 @@ import path from "path";
 import fs from "fs";
 import * as _ from "lodash";
 import { Params } from "../server/params";
-import { kotsDecryptString } from "./kots_ffi";
+import { kotsDecryptApiString } from "./kots_ffi";
 import NodeGit from "nodegit";
 import { Stores } from "../schema/stores";
 import { ReplicatedError } from "../server/errors";
@@ -64,7 +64,7 @@ export async function createGitCommitForVersion(stores: Stores, appId: string, c
 export async function createGitCommit(gitOpsCreds: any, branch: string, tree: commitTree[], commitMessage: string): Promise<string> {
   const localPath = tmp.dirSync().name;
   const params = await Params.getParams();
-  const decryptedPrivateKey = await kotsDecryptString(params.apiEncryptionKey, gitOpsCreds.privKey);
+  const decryptedPrivateKey = await kotsDecryptApiString(params, gitOpsCreds.privKey);
 
   const options = {
     callbacks: {
@@ -5,7 +5,7 @@ import { ReplicatedError } from "../server/errors";
 import randomstring from "randomstring";
 import slugify from "slugify";
 import * as k8s from "@kubernetes/client-node";
-import { kotsEncryptString, kotsDecryptString } from "./kots_ffi"
+import { kotsEncryptString, kotsDecryptApiString } from "./kots_ffi"
 import _ from "lodash";
 import yaml from "js-yaml";
 import { base64Decode, getPreflightResultState, base64Encode } from '../util/utilities';
@@ -1219,7 +1219,7 @@ order by adv.sequence desc`;
       return regInfo
     }
 
-    regInfo.registryPassword = await kotsDecryptString(this.params.apiEncryptionKey, regInfo.registryPasswordEnc)
+    regInfo.registryPassword = await kotsDecryptApiString(this.params, regInfo.registryPasswordEnc)
 
     return regInfo
   }
@@ -1656,6 +1656,20 @@ order by adv.sequence desc`;
 
     await this.pool.query(q, v);
 
+    // the results are also recorded as a preflight run, so they show in the preflight history like the runs of kotsadm
+    const result = typeof preflightResult === "string" ? preflightResult : JSON.stringify(preflightResult);
+    const runQ = `insert into preflight_run (id, app_id, sequence, trigger, status, result, started_at, completed_at)
+      values ($1, $2, $3, $4, $5, $6, NOW(), NOW())`;
+    const runV = [
+      randomstring.generate({ capitalization: "lowercase" }),
+      appId,
+      sequence,
+      "cli",
+      "completed",
+      result,
+    ];
+    await this.pool.query(runQ, runV);
+
     // Always deploy sequence 0 if preflight checks pass
     if (sequence === 0) {
       const results = JSON.parse(JSON.stringify(preflightResult));
@@ -607,6 +607,19 @@ export async function kotsDecryptString(cipherString: string, message: string):
   return decrypted["p"];
 }
 
+// kotsDecryptApiString decrypts a value that is encrypted with the api encryption key. While a key is being rotated,
+// API_ENCRYPTION_KEY_PREVIOUS holds the old key, and values that have not been re-encrypted yet are decrypted with it
+export async function kotsDecryptApiString(params: Params, message: string): Promise<string> {
+  try {
+    return await kotsDecryptString(params.apiEncryptionKey, message);
+  } catch (err) {
+    if (!params.apiEncryptionKeyPrevious) {
+      throw err;
+    }
+    return await kotsDecryptString(params.apiEncryptionKeyPrevious, message);
+  }
+}
+
 export async function kotsRewriteVersion(app: KotsApp, archive: string, downstreams: string[], registryInfo: KotsAppRegistryDetails, copyImages: boolean, outputFile: string, stores: Stores, updatedConfigValues: string): Promise<string> {
   const tmpDir = tmp.dirSync();
   try {
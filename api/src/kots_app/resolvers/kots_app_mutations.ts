@@ -13,11 +13,12 @@ import {
   kotsAppFromData,
   kotsAppDownloadUpdates,
   Update,
-  kotsDecryptString,
+  kotsDecryptApiString,
 } from "../kots_ffi";
 import { KotsApp } from "../kots_app"
 import * as k8s from "@kubernetes/client-node";
 import { Params } from "../../server/params";
+import { deployAppVersion } from "../../util/kotsadm_api";
 import { Repeater } from "../../util/repeater";
 import { sendInitialGitCommitsForAppDownstream } from "../gitops";
 import { StatusServer } from "../../airgap/status";
@@ -66,7 +67,7 @@ export function KotsMutations(stores: Stores) {
       const localPath = tmp.dirSync().name;
 
       const params = await Params.getParams();
-      const decryptedPrivateKey = await kotsDecryptString(params.apiEncryptionKey, gitOpsCreds.privKey);
+      const decryptedPrivateKey = await kotsDecryptApiString(params, gitOpsCreds.privKey);
 
       const cloneOptions = {
         fetchOpts: {
@@ -130,7 +131,8 @@ export function KotsMutations(stores: Stores) {
       const appId = await stores.kotsAppStore.getIdFromSlug(upstreamSlug);
       const app = await context.getApp(appId);
 
-      await stores.kotsAppStore.deployVersion(app.id, sequence);
+      // the kotsadm api enforces maintenance windows and the preflight gating policy
+      await deployAppVersion(context.authorization, app.slug, sequence);
       return true;
     },
 
@@ -7,6 +7,7 @@ export class Params {
 
   readonly postgresUri: string;
   readonly apiEncryptionKey: string;
+  readonly apiEncryptionKeyPrevious: string;
   readonly githubClientId: string;
   readonly githubPrivateKeyFile: string;
   readonly githubPrivateKeyContents: string;
@@ -34,6 +35,7 @@ export class Params {
   constructor({
     postgresUri,
     apiEncryptionKey,
+    apiEncryptionKeyPrevious,
     githubAppInstallURL,
     githubClientId,
     githubPrivateKeyFile,
@@ -60,6 +62,7 @@ export class Params {
   }) {
     this.postgresUri = postgresUri;
     this.apiEncryptionKey = apiEncryptionKey;
+    this.apiEncryptionKeyPrevious = apiEncryptionKeyPrevious;
     this.githubAppInstallURL = githubAppInstallURL;
     this.githubClientId = githubClientId;
     this.githubPrivateKeyFile = githubPrivateKeyFile;
@@ -94,6 +97,7 @@ export class Params {
     Params.instance = new Params({
       postgresUri: params["POSTGRES_URI"],
       apiEncryptionKey: params["API_ENCRYPTION_KEY"],
+      apiEncryptionKeyPrevious: params["API_ENCRYPTION_KEY_PREVIOUS"],
       githubAppInstallURL: params["GITHUB_APP_INSTALL_URL"],
       githubClientId: params["GITHUB_CLIENT_ID"],
       githubClientSecret: params["GITHUB_CLIENT_SECRET"],
@@ -125,6 +129,7 @@ export class Params {
     const paramLookup: ParamLookup = {
       POSTGRES_URI: "/shipcloud/postgres/uri",
       API_ENCRYPTION_KEY: "",
+      API_ENCRYPTION_KEY_PREVIOUS: "",
       GITHUB_APP_INSTALL_URL: "/shipcloud/github/app_install_url",
       GITHUB_CLIENT_ID: "/shipcloud/github/app_client_id",
       GITHUB_CLIENT_SECRET: "/shipcloud/github/app_client_secret",
@@ -147,7 +147,8 @@ export class Server extends ServerLoader {
     scheduler.run();
 
     const setContext = async (req: Request, res: Response, next: NextFunction) => {
-      let token = req.get("Authorization") || "";
+      const authorization = req.get("Authorization") || "";
+      let token = authorization;
 
       // remove the "bearer", if it has one
       if (token.startsWith("Bearer")) {
@@ -155,7 +156,7 @@ export class Server extends ServerLoader {
         token = splitToken.pop()!;
       }
 
-      const context = await Context.fetch(stores, token);
+      const context = await Context.fetch(stores, token, authorization);
       res.locals.context = context;
 
       next();
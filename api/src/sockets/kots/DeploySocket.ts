@@ -13,6 +13,7 @@ import { VeleroClient } from "../../snapshots/resolvers/veleroClient";
 import { kotsAppSequenceKey, kotsClusterIdKey } from "../../snapshots/snapshot";
 import { Phase, Restore } from "../../snapshots/velero";
 import { ReplicatedError } from "../../server/errors";
+import { getDeployManifests } from "../../util/kotsadm_api";
 
 const DefaultReadyState = [{ kind: "EMPTY", name: "EMPTY", namespace: "EMPTY", state: State.Ready }];
 
@@ -266,7 +267,8 @@ export class KotsDeploySocketService {
               const desiredNamespace = ".";
               const kotsAppSpec = await app.getKotsAppSpec(cluster.id, this.kotsAppStore);
 
-              const rendered = await app.render(deployedAppSequence.toString(), `overlays/downstreams/${cluster.title}`, kotsAppSpec ? kotsAppSpec.kustomizeVersion : "");
+              // config values that reference external secrets are only resolved in these manifests
+              const rendered = await getDeployManifests(app.slug, deployedAppSequence, cluster.title);
               const b = new Buffer(rendered);
 
               const imagePullSecret = await app.getImagePullSecretFromArchive(deployedAppSequence.toString());
@@ -287,7 +289,7 @@ export class KotsDeploySocketService {
 
               const previousSequence = await this.kotsAppStore.getPreviouslyDeployedSequence(app.id, clusterSocketHistory.clusterId, deployedAppSequence);
               if (previousSequence !== undefined) {
-                const previousRendered = await app.render(previousSequence.toString(), `overlays/downstreams/${cluster.title}`, kotsAppSpec ? kotsAppSpec.kustomizeVersion : "");
+                const previousRendered = await getDeployManifests(app.slug, previousSequence, cluster.title);
                 const bb = new Buffer(previousRendered);
                 args.previous_manifests = bb.toString("base64");
               }
@@ -0,0 +1,68 @@
+import rp from "request-promise";
+import { StatusCodeError } from "request-promise/errors";
+import * as k8s from "@kubernetes/client-node";
+import { Params } from "../server/params";
+import { base64Decode } from "./utilities";
+import { ReplicatedError } from "../server/errors";
+
+// getKotsAuthstring returns the token that the kots cli uses to authenticate with the kotsadm api.
+// Node uses it for the requests that it makes to the kotsadm api without a user session
+export async function getKotsAuthstring(): Promise<string> {
+  const kc = new k8s.KubeConfig();
+  kc.loadFromDefault();
+  const k8sApi = kc.makeApiClient(k8s.CoreV1Api);
+
+  const namespace = process.env["POD_NAMESPACE"]!;
+  const secret = await k8sApi.readNamespacedSecret("kotsadm-authstring", namespace);
+  const authString = base64Decode(secret.body.data!["kotsadm-authstring"]);
+  if (!authString) {
+    throw new Error("no authstring found in cluster");
+  }
+
+  return authString;
+}
+
+// getDeployManifests returns the manifests of a downstream of an app version with config values that
+// reference an external secret resolved. The manifests are rendered by the kotsadm api, and are never stored
+export async function getDeployManifests(appSlug: string, sequence: number, downstreamName: string): Promise<string> {
+  const params = await Params.getParams();
+  const authString = await getKotsAuthstring();
+
+  const manifests = await rp({
+    method: "GET",
+    uri: `${params.shipApiEndpoint}/api/v1/app/${appSlug}/sequence/${sequence}/downstream/${encodeURIComponent(downstreamName)}/manifests`,
+    headers: {
+      "Authorization": authString,
+    },
+  });
+  if (!manifests) {
+    throw new Error(`no manifests rendered for ${appSlug} sequence ${sequence}`);
+  }
+
+  return manifests;
+}
+
+// deployAppVersion requests a deploy from the kotsadm api, which holds the deploy until a maintenance window
+// opens and refuses versions that the preflight gating policy blocks. It returns true if the version was
+// deployed, and false if the deploy was queued
+export async function deployAppVersion(authorization: string, appSlug: string, sequence: number): Promise<boolean> {
+  const params = await Params.getParams();
+
+  try {
+    const response = await rp({
+      method: "POST",
+      uri: `${params.shipApiEndpoint}/api/v1/app/${appSlug}/sequence/${sequence}/deploy`,
+      headers: {
+        "Authorization": authorization,
+      },
+      body: {},
+      json: true,
+    });
+    return !response.queuedDeploy;
+  } catch (err) {
+    if (err instanceof StatusCodeError && err.error && err.error.error) {
+      throw new ReplicatedError(err.error.error);
+    }
+    throw err;
+  }
+}
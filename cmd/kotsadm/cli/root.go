@@ -27,6 +27,7 @@ func RootCmd() *cobra.Command {
 
 	cmd.AddCommand(APICmd())
 	cmd.AddCommand(OperatorCmd())
+	cmd.AddCommand(RotateEncryptionKeyCmd())
 
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func RotateEncryptionKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate-encryption-key",
+		Short: "Re-encrypts stored secrets with a new API encryption key",
+		Long: `Re-encrypts the registry passwords and gitops deploy keys that are encrypted with the old key using the new key.
+The old key defaults to API_ENCRYPTION_KEY_PREVIOUS and the new key to API_ENCRYPTION_KEY, so that the api keeps reading
+values encrypted with either key until the rotation has completed. Both variables must be set on the kotsadm and the
+kotsadm-api deployments before rotating, API_ENCRYPTION_KEY_PREVIOUS can be removed from both once this completes.`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			oldKey := v.GetString("old-key")
+			if oldKey == "" {
+				oldKey = os.Getenv(encryptionkey.PreviousKeyEnv)
+			}
+			newKey := v.GetString("new-key")
+			if newKey == "" {
+				newKey = os.Getenv(encryptionkey.CurrentKeyEnv)
+			}
+
+			result, err := encryptionkey.Rotate(oldKey, newKey)
+			if err != nil {
+				return errors.Wrap(err, "failed to rotate encryption key")
+			}
+
+			fmt.Printf("Rotated to key version %d: re-encrypted %d registry passwords and %d gitops deploy keys\n", result.Version, result.RegistryPasswords, result.GitOpsPrivateKeys)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("old-key", "", "the key that secrets are currently encrypted with (defaults to API_ENCRYPTION_KEY_PREVIOUS)")
+	cmd.Flags().String("new-key", "", "the key to encrypt secrets with (defaults to API_ENCRYPTION_KEY)")
+
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+
+	return cmd
+}
@@ -70,8 +70,9 @@ type Client struct {
 	Token           string
 	TargetNamespace string
 
-	watchedNamespaces []string
-	imagePullSecret   string
+	watchedNamespaces      []string
+	imagePullSecret        string
+	imagePullSecretAppSlug string
 
 	appStateMonitor   *appstate.Monitor
 	hookStopChans     []chan struct{}
@@ -267,6 +268,7 @@ func (c *Client) registerHandlers(socketClient *socket.Client) error {
 			}
 		}
 		c.imagePullSecret = args.ImagePullSecret
+		c.imagePullSecretAppSlug = args.AppSlug
 		c.watchedNamespaces = args.AdditionalNamespaces
 
 		result, deployError = c.ensureResourcesPresent(args)
@@ -275,6 +277,11 @@ func (c *Client) registerHandlers(socketClient *socket.Client) error {
 			return
 		}
 
+		// registry credentials may have changed, so existing namespaces need the new secret too
+		if err := c.rotateImagePullSecret(args); err != nil {
+			log.Printf("error rotating image pull secret: %s", err.Error())
+		}
+
 		c.shutdownNamespacesInformer()
 		c.runNamespacesInformer()
 
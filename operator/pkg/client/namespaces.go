@@ -5,11 +5,8 @@ import (
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
-	kuberneteserrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
@@ -44,40 +41,21 @@ func (c *Client) runNamespacesInformer() error {
 					}
 				}
 
-				if !deployImagePullSecret {
+				if !deployImagePullSecret || c.imagePullSecret == "" {
 					continue
 				}
 
-				decode := scheme.Codecs.UniversalDeserializer().Decode
-				obj, _, err := decode([]byte(c.imagePullSecret), nil, nil)
+				secret, err := decodeImagePullSecret(c.imagePullSecret)
 				if err != nil {
 					log.Print(err)
 					return
 				}
 
-				secret := obj.(*corev1.Secret)
-				secret.Namespace = addedNamespace.Name
-
-				foundSecret, err := clientset.CoreV1().Secrets(addedNamespace.Name).Get(secret.Name, metav1.GetOptions{})
-				if err != nil {
-					if kuberneteserrors.IsNotFound(err) {
-						// create it
-						_, err := clientset.CoreV1().Secrets(addedNamespace.Name).Create(secret)
-						if err != nil {
-							log.Print(err)
-							return
-						}
-					} else {
-						log.Print(err)
-						return
-					}
-				} else {
-					// Update it
-					foundSecret.Data[".dockerconfigjson"] = secret.Data[".dockerconfigjson"]
-					if _, err := clientset.CoreV1().Secrets(addedNamespace.Name).Update(secret); err != nil {
-						log.Print(err)
-						return
-					}
+				// a namespace that is created after the deploy is never the app namespace, so secrets that
+				// are already in it were not put there by kots
+				if err := ensureImagePullSecret(clientset, addedNamespace.Name, c.imagePullSecretAppSlug, secret, false); err != nil {
+					log.Print(err)
+					return
 				}
 			}
 		},
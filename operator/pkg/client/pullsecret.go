@@ -0,0 +1,222 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kuberneteserrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// imagePullSecretLabel marks the pull secrets that the operator copied into a namespace,
+	// so they can be found and removed when the namespace is no longer listed
+	imagePullSecretLabel = "kots.io/image-pull-secret"
+	appSlugLabel         = "kots.io/app-slug"
+
+	// createdByAnnotation is set on the secrets that the operator created. Secrets without it belong to someone
+	// else, and are never updated or removed, even when they have the same name
+	createdByAnnotation = "kots.io/created-by"
+	createdByOperator   = "kotsadm-operator"
+)
+
+// ImagePullSecretConflictError is returned when a secret with the name of the image pull secret already exists
+// in a namespace, and was not created by the operator
+type ImagePullSecretConflictError struct {
+	Namespace string
+	Name      string
+}
+
+func (e ImagePullSecretConflictError) Error() string {
+	return fmt.Sprintf("secret %s in namespace %s was not created by kots", e.Name, e.Namespace)
+}
+
+func (c *Client) rotateImagePullSecret(applicationManifests ApplicationManifests) error {
+	restconfig, err := rest.InClusterConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to get in cluster config")
+	}
+	clientset, err := kubernetes.NewForConfig(restconfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to get new kubernetes client")
+	}
+
+	targetNamespace := c.TargetNamespace
+	if applicationManifests.Namespace != "." {
+		targetNamespace = applicationManifests.Namespace
+	}
+
+	return rotateImagePullSecret(clientset, applicationManifests.AppSlug, applicationManifests.ImagePullSecret, targetNamespace, applicationManifests.AdditionalNamespaces)
+}
+
+// rotateImagePullSecret puts the current image pull secret in the app namespace and all of the additional
+// namespaces, and removes the secrets it copied before from namespaces that are no longer listed
+func rotateImagePullSecret(clientset kubernetes.Interface, appSlug string, imagePullSecret string, appNamespace string, additionalNamespaces []string) error {
+	var secret *corev1.Secret
+	if imagePullSecret != "" {
+		s, err := decodeImagePullSecret(imagePullSecret)
+		if err != nil {
+			return errors.Wrap(err, "failed to decode image pull secret")
+		}
+		secret = s
+
+		targetNamespaces, err := imagePullSecretNamespaces(clientset, appNamespace, additionalNamespaces)
+		if err != nil {
+			return errors.Wrap(err, "failed to list namespaces")
+		}
+		for _, namespace := range targetNamespaces {
+			// the secret in the app namespace is also in the app manifests, so kots owns it without the annotation
+			if err := ensureImagePullSecret(clientset, namespace, appSlug, secret, namespace == appNamespace); err != nil {
+				// keep going, the other namespaces should still get the new credentials
+				log.Printf("failed to update image pull secret in namespace %s: %v", namespace, err)
+			}
+		}
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{
+		imagePullSecretLabel: "true",
+		appSlugLabel:         appSlug,
+	})
+	placedSecrets, err := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return errors.Wrap(err, "failed to list image pull secrets")
+	}
+
+	for _, placedSecret := range placedSecrets.Items {
+		// the secret in the app namespace is also in the app manifests
+		if placedSecret.Namespace == appNamespace {
+			continue
+		}
+		if secret != nil && placedSecret.Name == secret.Name && isWatchedNamespace(placedSecret.Namespace, additionalNamespaces) {
+			continue
+		}
+		if !isCreatedByOperator(placedSecret.ObjectMeta) {
+			continue
+		}
+
+		log.Printf("removing image pull secret %s from namespace %s", placedSecret.Name, placedSecret.Namespace)
+		err := clientset.CoreV1().Secrets(placedSecret.Namespace).Delete(placedSecret.Name, &metav1.DeleteOptions{})
+		if err != nil && !kuberneteserrors.IsNotFound(err) {
+			log.Printf("failed to remove image pull secret from namespace %s: %v", placedSecret.Namespace, err)
+		}
+	}
+
+	return nil
+}
+
+// ensureImagePullSecret creates the secret in the namespace, or updates the credentials if it already exists.
+// Existing secrets that the operator did not create are only updated when owned is set, otherwise
+// ImagePullSecretConflictError is returned
+func ensureImagePullSecret(clientset kubernetes.Interface, namespace string, appSlug string, secret *corev1.Secret, owned bool) error {
+	foundSecret, err := clientset.CoreV1().Secrets(namespace).Get(secret.Name, metav1.GetOptions{})
+	if kuberneteserrors.IsNotFound(err) {
+		newSecret := secret.DeepCopy()
+		newSecret.Namespace = namespace
+		setImagePullSecretLabels(&newSecret.ObjectMeta, appSlug)
+		if newSecret.Annotations == nil {
+			newSecret.Annotations = map[string]string{}
+		}
+		newSecret.Annotations[createdByAnnotation] = createdByOperator
+
+		if _, err := clientset.CoreV1().Secrets(namespace).Create(newSecret); err != nil {
+			return errors.Wrap(err, "failed to create secret")
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to get secret")
+	}
+
+	if !owned && !isCreatedByOperator(foundSecret.ObjectMeta) {
+		return ImagePullSecretConflictError{Namespace: namespace, Name: secret.Name}
+	}
+
+	key := corev1.DockerConfigJsonKey
+	if bytes.Equal(foundSecret.Data[key], secret.Data[key]) && foundSecret.Labels[imagePullSecretLabel] == "true" {
+		return nil
+	}
+
+	if foundSecret.Data == nil {
+		foundSecret.Data = map[string][]byte{}
+	}
+	foundSecret.Data[key] = secret.Data[key]
+	setImagePullSecretLabels(&foundSecret.ObjectMeta, appSlug)
+
+	if _, err := clientset.CoreV1().Secrets(namespace).Update(foundSecret); err != nil {
+		return errors.Wrap(err, "failed to update secret")
+	}
+
+	return nil
+}
+
+// imagePullSecretNamespaces returns the app namespace and the additional namespaces, where "*" is all namespaces
+func imagePullSecretNamespaces(clientset kubernetes.Interface, appNamespace string, additionalNamespaces []string) ([]string, error) {
+	namespaces := []string{appNamespace}
+	seen := map[string]bool{appNamespace: true}
+
+	for _, additionalNamespace := range additionalNamespaces {
+		if additionalNamespace != "*" {
+			if !seen[additionalNamespace] {
+				seen[additionalNamespace] = true
+				namespaces = append(namespaces, additionalNamespace)
+			}
+			continue
+		}
+
+		namespaceList, err := clientset.CoreV1().Namespaces().List(metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list namespaces")
+		}
+		for _, namespace := range namespaceList.Items {
+			if !seen[namespace.Name] {
+				seen[namespace.Name] = true
+				namespaces = append(namespaces, namespace.Name)
+			}
+		}
+	}
+
+	return namespaces, nil
+}
+
+func isWatchedNamespace(namespace string, watchedNamespaces []string) bool {
+	for _, watchedNamespace := range watchedNamespaces {
+		if watchedNamespace == "*" || watchedNamespace == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeImagePullSecret(imagePullSecret string) (*corev1.Secret, error) {
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, _, err := decode([]byte(imagePullSecret), nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode")
+	}
+
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil, errors.Errorf("unexpected type %T", obj)
+	}
+
+	return secret, nil
+}
+
+func isCreatedByOperator(objectMeta metav1.ObjectMeta) bool {
+	return objectMeta.Annotations[createdByAnnotation] == createdByOperator
+}
+
+func setImagePullSecretLabels(objectMeta *metav1.ObjectMeta, appSlug string) {
+	if objectMeta.Labels == nil {
+		objectMeta.Labels = map[string]string{}
+	}
+	objectMeta.Labels[imagePullSecretLabel] = "true"
+	objectMeta.Labels[appSlugLabel] = appSlug
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testImagePullSecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: kotsadm-replicated-registry
+type: kubernetes.io/dockerconfigjson
+data:
+  .dockerconfigjson: bmV3
+`
+
+func Test_rotateImagePullSecret(t *testing.T) {
+	req := require.New(t)
+
+	labels := map[string]string{
+		imagePullSecretLabel: "true",
+		appSlugLabel:         "my-app",
+	}
+	annotations := map[string]string{
+		createdByAnnotation: createdByOperator,
+	}
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kept"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "added"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "removed"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foreign"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foreign-labeled"}},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-replicated-registry", Namespace: "kept", Labels: labels, Annotations: annotations},
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("old")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-replicated-registry", Namespace: "removed", Labels: labels, Annotations: annotations},
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("old")},
+		},
+		// secrets with the same name that kots did not create
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-replicated-registry", Namespace: "foreign"},
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("theirs")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-replicated-registry", Namespace: "foreign-labeled", Labels: labels},
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("theirs")},
+		},
+	)
+
+	err := rotateImagePullSecret(clientset, "my-app", testImagePullSecret, "app", []string{"kept", "added", "foreign"})
+	req.NoError(err)
+
+	for _, namespace := range []string{"app", "kept", "added"} {
+		secret, err := clientset.CoreV1().Secrets(namespace).Get("kotsadm-replicated-registry", metav1.GetOptions{})
+		req.NoError(err, namespace)
+		req.Equal("new", string(secret.Data[corev1.DockerConfigJsonKey]), namespace)
+		req.Equal("true", secret.Labels[imagePullSecretLabel], namespace)
+	}
+
+	_, err = clientset.CoreV1().Secrets("removed").Get("kotsadm-replicated-registry", metav1.GetOptions{})
+	req.Error(err)
+
+	// secrets that kots did not create are not adopted
+	for _, namespace := range []string{"foreign", "foreign-labeled"} {
+		secret, err := clientset.CoreV1().Secrets(namespace).Get("kotsadm-replicated-registry", metav1.GetOptions{})
+		req.NoError(err, namespace)
+		req.Equal("theirs", string(secret.Data[corev1.DockerConfigJsonKey]), namespace)
+		req.Empty(secret.Annotations[createdByAnnotation], namespace)
+	}
+
+	// without a registry, the copies are removed but the app namespace is left to the app manifests,
+	// and secrets that kots did not create are left alone
+	err = rotateImagePullSecret(clientset, "my-app", "", "app", []string{"kept", "added", "foreign"})
+	req.NoError(err)
+
+	secrets, err := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(metav1.ListOptions{})
+	req.NoError(err)
+	namespaces := []string{}
+	for _, secret := range secrets.Items {
+		namespaces = append(namespaces, secret.Namespace)
+	}
+	req.ElementsMatch([]string{"app", "foreign", "foreign-labeled"}, namespaces)
+}
+
+func Test_ensureImagePullSecret(t *testing.T) {
+	secret, err := decodeImagePullSecret(testImagePullSecret)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		existing     *corev1.Secret
+		owned        bool
+		expectErr    bool
+		expectedData string
+	}{
+		{
+			name:         "creates the secret",
+			expectedData: "new",
+		},
+		{
+			name: "updates a secret it created",
+			existing: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "kotsadm-replicated-registry",
+					Namespace:   "ns",
+					Annotations: map[string]string{createdByAnnotation: createdByOperator},
+				},
+				Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte("old")},
+			},
+			expectedData: "new",
+		},
+		{
+			name: "reports a conflict with a secret it did not create",
+			existing: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-replicated-registry", Namespace: "ns"},
+				Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("theirs")},
+			},
+			expectErr:    true,
+			expectedData: "theirs",
+		},
+		{
+			name: "updates the secret of the app manifests",
+			existing: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-replicated-registry", Namespace: "ns"},
+				Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("old")},
+			},
+			owned:        true,
+			expectedData: "new",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			clientset := fake.NewSimpleClientset()
+			if test.existing != nil {
+				clientset = fake.NewSimpleClientset(test.existing)
+			}
+
+			err := ensureImagePullSecret(clientset, "ns", "my-app", secret, test.owned)
+			if test.expectErr {
+				req.Error(err)
+				req.IsType(ImagePullSecretConflictError{}, err)
+			} else {
+				req.NoError(err)
+			}
+
+			found, err := clientset.CoreV1().Secrets("ns").Get("kotsadm-replicated-registry", metav1.GetOptions{})
+			req.NoError(err)
+			req.Equal(test.expectedData, string(found.Data[corev1.DockerConfigJsonKey]))
+		})
+	}
+}
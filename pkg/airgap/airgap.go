@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
 	"os"
 	"path/filepath"
 	"time"
@@ -53,10 +52,12 @@ func GetPendingAirgapUploadApp() (*PendingApp, error) {
 }
 
 // CreateAppFromAirgap does a lot. Maybe too much. Definitely too much.
-// This function assumes that there's an app in the database that doesn't have a version
+// This function assumes that there's an app in the database that doesn't have a version,
+// and that airgapBundle is the path to the uploaded bundle on disk
 // After execution, there will be a sequence 0 of the app, and all clusters in the database
-// will also have a version
-func CreateAppFromAirgap(pendingApp *PendingApp, airgapBundle multipart.File, registryHost string, namespace string, username string, password string) error {
+// will also have a version. When a bundle public key is configured, unsigned bundles are only accepted
+// when allowUnsigned is set
+func CreateAppFromAirgap(pendingApp *PendingApp, airgapBundle string, registryHost string, namespace string, username string, password string, allowUnsigned bool) error {
 	if err := task.SetTaskStatus("airgap-install", "Processing package...", "running"); err != nil {
 		return errors.Wrap(err, "failed to set task status")
 	}
@@ -104,27 +105,20 @@ func CreateAppFromAirgap(pendingApp *PendingApp, airgapBundle multipart.File, re
 		return errors.Wrap(err, "failed to set app airgap flag")
 	}
 
-	// save the file
-	tmpFile, err := ioutil.TempFile("", "kotsadm")
-	if err != nil {
-		finalError = err
-		return errors.Wrap(err, "failed to create temp file")
-	}
-	_, err = io.Copy(tmpFile, airgapBundle)
-	if err != nil {
-		finalError = err
-		return errors.Wrap(err, "failed to copy temp airgap")
-	}
-	defer os.RemoveAll(tmpFile.Name())
-
 	// Extract it
 	// we seem to need a lot of temp dirs here... maybe too many?
-	archiveDir, err := version.ExtractArchiveToTempDirectory(tmpFile.Name())
+	archiveDir, err := version.ExtractArchiveToTempDirectory(airgapBundle)
 	if err != nil {
 		finalError = err
 		return errors.Wrap(err, "failed to extract archive")
 	}
 
+	// nothing is pushed or created until the bundle is verified
+	if err := verifyExtractedBundle("airgap-install", archiveDir, allowUnsigned); err != nil {
+		finalError = err
+		return err
+	}
+
 	if err := task.SetTaskStatus("airgap-install", "Processing app package...", "running"); err != nil {
 		finalError = err
 		return errors.Wrap(err, "failed to set task status")
@@ -207,6 +201,13 @@ func CreateAppFromAirgap(pendingApp *PendingApp, airgapBundle multipart.File, re
 		},
 	}
 
+	// kots builds the SystemContext of image pushes itself, and can't be given the one for the registry tls settings yet
+	// TODO: pass the SystemContext to kots so that pushes trust the registry CA certificates
+	if _, err := registry.WriteContainersConfig(); err != nil {
+		finalError = err
+		return errors.Wrap(err, "failed to write containers config")
+	}
+
 	if _, err := pull.Pull(fmt.Sprintf("replicated://%s", license.Spec.AppSlug), pullOptions); err != nil {
 		finalError = err
 		return errors.Wrap(err, "failed to pull")
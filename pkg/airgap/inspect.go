@@ -0,0 +1,230 @@
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"gopkg.in/yaml.v2"
+)
+
+type BundleImage struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// BundleInspection describes what an airgap bundle contains. Problems lists the reasons the bundle
+// can't be installed for the app it was checked against
+type BundleInspection struct {
+	AppSlug           string        `json:"appSlug"`
+	VersionLabel      string        `json:"versionLabel"`
+	ReleaseNotes      string        `json:"releaseNotes"`
+	ChannelID         string        `json:"channelId"`
+	ChannelName       string        `json:"channelName"`
+	UpdateCursor      string        `json:"updateCursor"`
+	Images            []BundleImage `json:"images"`
+	ImagesSize        int64         `json:"imagesSize"`
+	MinKotsVersion    string        `json:"minKotsVersion,omitempty"`
+	TargetKotsVersion string        `json:"targetKotsVersion,omitempty"`
+	Problems          []string      `json:"problems"`
+}
+
+type airgapMetadata struct {
+	Spec struct {
+		AppSlug      string `yaml:"appSlug"`
+		ChannelID    string `yaml:"channelID"`
+		ChannelName  string `yaml:"channelName"`
+		VersionLabel string `yaml:"versionLabel"`
+		ReleaseNotes string `yaml:"releaseNotes"`
+		UpdateCursor string `yaml:"updateCursor"`
+	} `yaml:"spec"`
+}
+
+type kotsApplication struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Spec       struct {
+		MinKotsVersion    string `yaml:"minKotsVersion"`
+		TargetKotsVersion string `yaml:"targetKotsVersion"`
+	} `yaml:"spec"`
+}
+
+// InspectBundle reads the metadata, release and image list from the airgap bundle at bundlePath.
+// The images are listed from the tar headers, so they are not extracted
+func InspectBundle(bundlePath string) (*BundleInspection, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open bundle")
+	}
+	defer f.Close()
+
+	gzReader, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create gzip reader")
+	}
+	defer gzReader.Close()
+
+	inspection := BundleInspection{
+		Images:   []BundleImage{},
+		Problems: []string{},
+	}
+	foundMetadata := false
+
+	tarReader := tar.NewReader(gzReader)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read tar data")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		switch {
+		case name == "airgap.yaml":
+			content, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read airgap.yaml")
+			}
+			metadata := airgapMetadata{}
+			if err := yaml.Unmarshal(content, &metadata); err != nil {
+				return nil, errors.Wrap(err, "failed to parse airgap.yaml")
+			}
+			inspection.AppSlug = metadata.Spec.AppSlug
+			inspection.ChannelID = metadata.Spec.ChannelID
+			inspection.ChannelName = metadata.Spec.ChannelName
+			inspection.VersionLabel = metadata.Spec.VersionLabel
+			inspection.ReleaseNotes = metadata.Spec.ReleaseNotes
+			inspection.UpdateCursor = metadata.Spec.UpdateCursor
+			foundMetadata = true
+
+		case strings.HasPrefix(name, "images/"):
+			inspection.Images = append(inspection.Images, BundleImage{
+				Name: imageNameFromPath(strings.TrimPrefix(name, "images/")),
+				Size: hdr.Size,
+			})
+			inspection.ImagesSize += hdr.Size
+
+		case !strings.Contains(name, "/") && (strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")):
+			if err := inspectRelease(tarReader, &inspection); err != nil {
+				return nil, errors.Wrapf(err, "failed to inspect release %s", name)
+			}
+		}
+	}
+
+	if !foundMetadata {
+		return nil, errors.New("airgap.yaml not found in bundle")
+	}
+
+	sort.Slice(inspection.Images, func(i, j int) bool {
+		return inspection.Images[i].Name < inspection.Images[j].Name
+	})
+
+	return &inspection, nil
+}
+
+// inspectRelease looks for the kots Application in the release archive
+func inspectRelease(r io.Reader, inspection *BundleInspection) error {
+	gzReader, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to create gzip reader")
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read tar data")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if ext := path.Ext(hdr.Name); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", hdr.Name)
+		}
+
+		for _, doc := range bytes.Split(content, []byte("\n---")) {
+			application := kotsApplication{}
+			if err := yaml.Unmarshal(doc, &application); err != nil {
+				continue
+			}
+			if application.APIVersion == "kots.io/v1beta1" && application.Kind == "Application" {
+				inspection.MinKotsVersion = application.Spec.MinKotsVersion
+				inspection.TargetKotsVersion = application.Spec.TargetKotsVersion
+			}
+		}
+	}
+}
+
+// imageNameFromPath turns the path of an image in the bundle, such as docker-archive/quay.io/org/app/1.0.0,
+// into the image name quay.io/org/app:1.0.0
+func imageNameFromPath(imagePath string) string {
+	parts := strings.Split(imagePath, "/")
+	if len(parts) > 1 && (parts[0] == "docker-archive" || parts[0] == "oci-archive") {
+		parts = parts[1:]
+	}
+	if len(parts) < 2 {
+		return imagePath
+	}
+
+	return fmt.Sprintf("%s:%s", strings.Join(parts[:len(parts)-1], "/"), parts[len(parts)-1])
+}
+
+// CheckLicense adds a problem for everything in the bundle that doesn't match the license it will be installed with,
+// or the version of kotsadm that will install it
+func (i *BundleInspection) CheckLicense(license *kotsv1beta1.License, kotsadmVersion string) {
+	if license == nil {
+		i.Problems = append(i.Problems, "the app does not have a license")
+		return
+	}
+
+	if i.AppSlug != license.Spec.AppSlug {
+		i.Problems = append(i.Problems, fmt.Sprintf("the bundle is for app %q, but the license is for app %q", i.AppSlug, license.Spec.AppSlug))
+	}
+	if i.ChannelName != "" && license.Spec.ChannelName != "" && i.ChannelName != license.Spec.ChannelName {
+		i.Problems = append(i.Problems, fmt.Sprintf("the bundle is from channel %q, but the license is for channel %q", i.ChannelName, license.Spec.ChannelName))
+	}
+	if !license.Spec.IsAirgapSupported {
+		i.Problems = append(i.Problems, "the license does not allow airgap installs")
+	}
+
+	if i.MinKotsVersion == "" || kotsadmVersion == "" {
+		return
+	}
+	minVersion, err := semver.NewVersion(i.MinKotsVersion)
+	if err != nil {
+		i.Problems = append(i.Problems, fmt.Sprintf("the required kotsadm version %q is not valid", i.MinKotsVersion))
+		return
+	}
+	currentVersion, err := semver.NewVersion(kotsadmVersion)
+	if err != nil {
+		// development builds don't have a version
+		return
+	}
+	if currentVersion.LessThan(minVersion) {
+		i.Problems = append(i.Problems, fmt.Sprintf("the bundle requires kotsadm %s or later, this is kotsadm %s", i.MinKotsVersion, kotsadmVersion))
+	}
+}
@@ -0,0 +1,73 @@
+package airgap
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/pkg/cursor"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// InspectBundleForApp inspects the bundle and checks that it's a newer release of the app, for its license
+func InspectBundleForApp(bundlePath string, a *app.App) (*BundleInspection, error) {
+	inspection, err := InspectBundle(bundlePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to inspect bundle")
+	}
+
+	archiveDir, err := version.GetAppVersionArchive(a.ID, a.CurrentSequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get current archive")
+	}
+	defer os.RemoveAll(archiveDir)
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load current kotskinds")
+	}
+
+	inspection.CheckLicense(kotsKinds.License, os.Getenv("VERSION"))
+
+	currentCursor := kotsKinds.Installation.Spec.UpdateCursor
+	bc, err := cursor.NewCursor(currentCursor)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse current cursor")
+	}
+	ac, err := cursor.NewCursor(inspection.UpdateCursor)
+	if err != nil {
+		inspection.Problems = append(inspection.Problems, fmt.Sprintf("the bundle cursor %q is not valid", inspection.UpdateCursor))
+	} else if !bc.Comparable(ac) {
+		inspection.Problems = append(inspection.Problems, fmt.Sprintf("the bundle cursor %q can't be compared with the installed cursor %q", inspection.UpdateCursor, currentCursor))
+	} else if !bc.Before(ac) {
+		inspection.Problems = append(inspection.Problems, fmt.Sprintf("version %s is not newer than the installed version %s", inspection.VersionLabel, kotsKinds.Installation.Spec.VersionLabel))
+	}
+
+	return inspection, nil
+}
+
+// InspectBundleForPendingApp inspects the bundle and checks that it matches the license of the app that's being installed
+func InspectBundleForPendingApp(bundlePath string, pendingApp *PendingApp) (*BundleInspection, error) {
+	inspection, err := InspectBundle(bundlePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to inspect bundle")
+	}
+
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, _, err := decode([]byte(pendingApp.LicenseData), nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read pending license data")
+	}
+	license, ok := obj.(*kotsv1beta1.License)
+	if !ok {
+		return nil, errors.New("pending license data is not a license")
+	}
+
+	inspection.CheckLicense(license, os.Getenv("VERSION"))
+
+	return inspection, nil
+}
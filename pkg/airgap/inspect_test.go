@@ -0,0 +1,101 @@
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func writeTGZ(t *testing.T, files map[string][]byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	gzWriter := gzip.NewWriter(buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for name, content := range files {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		require.NoError(t, err)
+		_, err = tarWriter.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzWriter.Close())
+	return buf.Bytes()
+}
+
+func Test_InspectBundle(t *testing.T) {
+	req := require.New(t)
+
+	release := writeTGZ(t, map[string][]byte{
+		"kots-app.yaml": []byte(`apiVersion: kots.io/v1beta1
+kind: Application
+spec:
+  title: My App
+  minKotsVersion: 1.16.0
+`),
+		"deployment.yaml": []byte("apiVersion: apps/v1\nkind: Deployment\n"),
+	})
+
+	bundle := writeTGZ(t, map[string][]byte{
+		"airgap.yaml": []byte(`apiVersion: kots.io/v1beta1
+kind: Airgap
+spec:
+  appSlug: my-app
+  channelName: Stable
+  versionLabel: 1.2.0
+  releaseNotes: fixes
+  updateCursor: "12"
+`),
+		"app.tar.gz": release,
+		"images/docker-archive/quay.io/org/app/1.2.0": make([]byte, 100),
+		"images/docker-archive/redis/5":               make([]byte, 50),
+	})
+
+	bundleFile, err := ioutil.TempFile("", "airgap")
+	req.NoError(err)
+	defer os.Remove(bundleFile.Name())
+	_, err = bundleFile.Write(bundle)
+	req.NoError(err)
+	bundleFile.Close()
+
+	inspection, err := InspectBundle(bundleFile.Name())
+	req.NoError(err)
+
+	req.Equal("my-app", inspection.AppSlug)
+	req.Equal("Stable", inspection.ChannelName)
+	req.Equal("1.2.0", inspection.VersionLabel)
+	req.Equal("fixes", inspection.ReleaseNotes)
+	req.Equal("12", inspection.UpdateCursor)
+	req.Equal("1.16.0", inspection.MinKotsVersion)
+	req.Equal([]BundleImage{
+		{Name: "quay.io/org/app:1.2.0", Size: 100},
+		{Name: "redis:5", Size: 50},
+	}, inspection.Images)
+	req.Equal(int64(150), inspection.ImagesSize)
+
+	license := &kotsv1beta1.License{}
+	license.Spec.AppSlug = "my-app"
+	license.Spec.ChannelName = "Stable"
+	license.Spec.IsAirgapSupported = true
+
+	inspection.CheckLicense(license, "v1.16.1")
+	req.Empty(inspection.Problems)
+
+	inspection.CheckLicense(license, "v1.15.0")
+	req.Len(inspection.Problems, 1)
+
+	inspection.Problems = []string{}
+	license.Spec.AppSlug = "other-app"
+	inspection.CheckLicense(license, "")
+	req.Len(inspection.Problems, 1)
+}
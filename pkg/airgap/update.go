@@ -2,20 +2,18 @@ package airgap
 
 import (
 	"bufio"
-	"encoding/base64"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/replicatedhq/kots/pkg/crypto"
 	"github.com/replicatedhq/kots/pkg/cursor"
 	"github.com/replicatedhq/kots/pkg/pull"
 	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
 	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
 	"github.com/replicatedhq/kotsadm/pkg/logger"
 	"github.com/replicatedhq/kotsadm/pkg/preflight"
@@ -24,7 +22,9 @@ import (
 	"github.com/replicatedhq/kotsadm/pkg/version"
 )
 
-func UpdateAppFromAirgap(a *app.App, airgapBundle multipart.File) error {
+// UpdateAppFromAirgap creates a new version of the app from the bundle at the airgapBundle path.
+// When a bundle public key is configured, unsigned bundles are only accepted when allowUnsigned is set
+func UpdateAppFromAirgap(a *app.App, airgapBundle string, allowUnsigned bool) error {
 	if err := task.SetTaskStatus("update-download", "Processing package...", "running"); err != nil {
 		return errors.Wrap(err, "failed to set tasks status")
 	}
@@ -62,19 +62,7 @@ func UpdateAppFromAirgap(a *app.App, airgapBundle multipart.File) error {
 		finalError = err
 		return errors.Wrap(err, "failed to get app registry settings")
 	}
-	cipher, err := crypto.AESCipherFromString(os.Getenv("API_ENCRYPTION_KEY"))
-	if err != nil {
-		finalError = err
-		return errors.Wrap(err, "failed to create aes cipher")
-	}
-
-	decodedPassword, err := base64.StdEncoding.DecodeString(registrySettings.PasswordEnc)
-	if err != nil {
-		finalError = err
-		return errors.Wrap(err, "failed to decode")
-	}
-
-	decryptedPassword, err := cipher.Decrypt([]byte(decodedPassword))
+	decryptedPassword, err := encryptionkey.Decrypt(registrySettings.PasswordEnc)
 	if err != nil {
 		finalError = err
 		return errors.Wrap(err, "failed to decrypt")
@@ -98,23 +86,30 @@ func UpdateAppFromAirgap(a *app.App, airgapBundle multipart.File) error {
 		return err
 	}
 
-	// Start processing the airgap package
-	tmpFile, err := ioutil.TempFile("", "kotsadm")
+	// catch a bundle for another app before anything is extracted
+	inspection, err := InspectBundle(airgapBundle)
 	if err != nil {
-		finalError = err
-		return errors.Wrap(err, "failed to create temp file")
+		logger.Error(errors.Wrap(err, "failed to inspect airgap bundle"))
+	} else {
+		inspection.CheckLicense(beforeKotsKinds.License, os.Getenv("VERSION"))
+		if len(inspection.Problems) > 0 {
+			err := errors.Errorf("airgap bundle can't be installed: %s", strings.Join(inspection.Problems, "; "))
+			finalError = err
+			return err
+		}
 	}
-	_, err = io.Copy(tmpFile, airgapBundle)
+
+	// Start processing the airgap package
+	airgapRoot, err := version.ExtractArchiveToTempDirectory(airgapBundle)
 	if err != nil {
 		finalError = err
-		return errors.Wrap(err, "failed to copy temp airgap")
+		return errors.Wrap(err, "failed to extract archive")
 	}
-	defer os.RemoveAll(tmpFile.Name())
 
-	airgapRoot, err := version.ExtractArchiveToTempDirectory(tmpFile.Name())
-	if err != nil {
+	// nothing is pushed or created until the bundle is verified
+	if err := verifyExtractedBundle("update-download", airgapRoot, allowUnsigned); err != nil {
 		finalError = err
-		return errors.Wrap(err, "failed to extract archive")
+		return err
 	}
 
 	if err := task.SetTaskStatus("update-download", "Processing app package...", "running"); err != nil {
@@ -161,6 +156,13 @@ func UpdateAppFromAirgap(a *app.App, airgapBundle multipart.File) error {
 		},
 	}
 
+	// kots builds the SystemContext of image pushes itself, and can't be given the one for the registry tls settings yet
+	// TODO: pass the SystemContext to kots so that pushes trust the registry CA certificates
+	if _, err := registry.WriteContainersConfig(); err != nil {
+		finalError = err
+		return errors.Wrap(err, "failed to write containers config")
+	}
+
 	if _, err := pull.Pull(fmt.Sprintf("replicated://%s", beforeKotsKinds.License.Spec.AppSlug), pullOptions); err != nil {
 		finalError = err
 		return errors.Wrap(err, "failed to pull")
@@ -209,7 +211,7 @@ func UpdateAppFromAirgap(a *app.App, airgapBundle multipart.File) error {
 		return errors.Wrap(err, "failed to upload to s3")
 	}
 
-	if err := preflight.Run(a.ID, newSequence, currentArchivePath); err != nil {
+	if err := preflight.Run(a.ID, newSequence, currentArchivePath, preflight.TriggerAirgap); err != nil {
 		finalError = err
 		return errors.Wrap(err, "failed to start preflights")
 	}
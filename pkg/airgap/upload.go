@@ -0,0 +1,405 @@
+package airgap
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	UploadStatusUploading = "uploading"
+	UploadStatusComplete  = "complete"
+)
+
+// UploadSession is an airgap bundle that is uploaded in chunks. Chunks are written in order, and a client that
+// loses its connection asks for the session to find the offset to resume from
+type UploadSession struct {
+	ID        string    `json:"id"`
+	AppID     string    `json:"appId,omitempty"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum,omitempty"`
+	Offset    int64     `json:"offset"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// OffsetMismatchError is returned when a chunk does not start where the last one ended
+type OffsetMismatchError struct {
+	Offset int64
+}
+
+func (e OffsetMismatchError) Error() string {
+	return fmt.Sprintf("chunk must start at offset %d", e.Offset)
+}
+
+// ChecksumMismatchError is returned when the data that was received does not match the checksum sent with it
+type ChecksumMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum %s does not match expected checksum %s", e.Actual, e.Expected)
+}
+
+const defaultUploadSessionTTL = 24 * time.Hour
+
+var (
+	uploadLocksMtx sync.Mutex
+	uploadLocks    = map[string]*sync.Mutex{}
+)
+
+// lockUploadSession serializes the writes to a single upload session, so uploads of different bundles don't
+// wait for each other. It returns the func that releases the lock
+func lockUploadSession(id string) func() {
+	uploadLocksMtx.Lock()
+	l, ok := uploadLocks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		uploadLocks[id] = l
+	}
+	uploadLocksMtx.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+func forgetUploadLock(id string) {
+	uploadLocksMtx.Lock()
+	defer uploadLocksMtx.Unlock()
+	delete(uploadLocks, id)
+}
+
+// uploadDir defaults to a temp dir that does not survive a restart of kotsadm. Uploads that lose their file
+// are resumed from the data that is left, see resumeOffset
+func uploadDir() string {
+	if os.Getenv("KOTSADM_AIRGAP_UPLOAD_DIR") != "" {
+		return os.Getenv("KOTSADM_AIRGAP_UPLOAD_DIR")
+	}
+	return filepath.Join(os.TempDir(), "kotsadm-airgap-uploads")
+}
+
+// UploadPath is where the bundle of an upload session is assembled
+func UploadPath(id string) string {
+	return filepath.Join(uploadDir(), fmt.Sprintf("%s.airgap", id))
+}
+
+// CreateUploadSession starts an upload of a bundle of size bytes. appID is empty for the bundle that installs the
+// pending app. checksum is the optional sha256 of the complete bundle
+func CreateUploadSession(appID string, size int64, checksum string) (*UploadSession, error) {
+	if size <= 0 {
+		return nil, errors.New("size must be greater than 0")
+	}
+
+	if err := os.MkdirAll(uploadDir(), 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create upload dir")
+	}
+
+	now := time.Now()
+	uploadSession := UploadSession{
+		ID:        ksuid.New().String(),
+		AppID:     appID,
+		Size:      size,
+		Checksum:  strings.ToLower(checksum),
+		Offset:    0,
+		Status:    UploadStatusUploading,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	f, err := os.OpenFile(UploadPath(uploadSession.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create upload file")
+	}
+	f.Close()
+
+	db := persistence.MustGetPGSession()
+	query := `insert into airgap_upload_session (id, app_id, size, checksum, upload_offset, status, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6, $7, $7)`
+	_, err = db.Exec(query, uploadSession.ID, uploadSession.AppID, uploadSession.Size, uploadSession.Checksum, uploadSession.Offset, uploadSession.Status, now)
+	if err != nil {
+		os.Remove(UploadPath(uploadSession.ID))
+		return nil, errors.Wrap(err, "failed to insert upload session")
+	}
+
+	return &uploadSession, nil
+}
+
+func GetUploadSession(id string) (*UploadSession, error) {
+	db := persistence.MustGetPGSession()
+	query := `select id, app_id, size, checksum, upload_offset, status, created_at, updated_at from airgap_upload_session where id = $1`
+	row := db.QueryRow(query, id)
+
+	uploadSession := UploadSession{}
+	var appID sql.NullString
+	var checksum sql.NullString
+	if err := row.Scan(&uploadSession.ID, &appID, &uploadSession.Size, &checksum, &uploadSession.Offset, &uploadSession.Status,
+		&uploadSession.CreatedAt, &uploadSession.UpdatedAt); err != nil {
+		return nil, errors.Wrap(err, "failed to scan upload session")
+	}
+	uploadSession.AppID = appID.String
+	uploadSession.Checksum = checksum.String
+
+	return &uploadSession, nil
+}
+
+// WriteChunk appends a chunk to the upload at offset, and returns the offset of the next chunk.
+// The chunk is discarded if its sha256 does not match checksum
+func WriteChunk(id string, offset int64, checksum string, chunk io.Reader) (int64, error) {
+	unlock := lockUploadSession(id)
+	defer unlock()
+
+	uploadSession, err := GetUploadSession(id)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get upload session")
+	}
+	if uploadSession.Status != UploadStatusUploading {
+		return 0, errors.Errorf("upload is %s", uploadSession.Status)
+	}
+
+	if err := os.MkdirAll(uploadDir(), 0700); err != nil {
+		return 0, errors.Wrap(err, "failed to create upload dir")
+	}
+	f, err := os.OpenFile(UploadPath(id), os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open upload file")
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to stat upload file")
+	}
+	if resumeFrom := resumeOffset(fileInfo.Size(), uploadSession.Offset); resumeFrom != uploadSession.Offset {
+		if err := setUploadOffset(id, resumeFrom); err != nil {
+			return 0, errors.Wrap(err, "failed to reset upload offset")
+		}
+		return 0, OffsetMismatchError{Offset: resumeFrom}
+	}
+
+	if offset != uploadSession.Offset {
+		return 0, OffsetMismatchError{Offset: uploadSession.Offset}
+	}
+
+	// anything after the offset is left over from a chunk that failed
+	if err := f.Truncate(offset); err != nil {
+		return 0, errors.Wrap(err, "failed to truncate upload file")
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, errors.Wrap(err, "failed to seek upload file")
+	}
+
+	hash := sha256.New()
+	remaining := uploadSession.Size - offset
+	written, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(chunk, remaining+1))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to write chunk")
+	}
+	if written > remaining {
+		f.Truncate(offset)
+		return 0, errors.Errorf("chunk is larger than the %d bytes remaining", remaining)
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if checksum != "" && !strings.EqualFold(actual, checksum) {
+		f.Truncate(offset)
+		return 0, ChecksumMismatchError{Expected: checksum, Actual: actual}
+	}
+
+	if err := f.Sync(); err != nil {
+		return 0, errors.Wrap(err, "failed to sync upload file")
+	}
+
+	newOffset := offset + written
+	if err := setUploadOffset(id, newOffset); err != nil {
+		return 0, errors.Wrap(err, "failed to update upload offset")
+	}
+
+	return newOffset, nil
+}
+
+// resumeOffset is where an upload continues when the upload file has fewer bytes than the session received,
+// which happens when the file was lost with a restart of kotsadm
+func resumeOffset(fileSize int64, sessionOffset int64) int64 {
+	if fileSize < sessionOffset {
+		return fileSize
+	}
+	return sessionOffset
+}
+
+func setUploadOffset(id string, offset int64) error {
+	db := persistence.MustGetPGSession()
+	query := `update airgap_upload_session set upload_offset = $1, updated_at = $2 where id = $3`
+	if _, err := db.Exec(query, offset, time.Now(), id); err != nil {
+		return errors.Wrap(err, "failed to update upload session")
+	}
+	return nil
+}
+
+// CompleteUploadSession checks that the whole bundle was received and matches the checksum of the session,
+// and returns the path to the assembled bundle. Call it once the bundle is about to be installed, and reopen
+// the session with ReopenUploadSession if the install fails
+func CompleteUploadSession(id string) (string, error) {
+	unlock := lockUploadSession(id)
+	defer unlock()
+
+	uploadSession, err := GetUploadSession(id)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get upload session")
+	}
+	if uploadSession.Status != UploadStatusUploading {
+		return "", errors.Errorf("upload is %s", uploadSession.Status)
+	}
+	if uploadSession.Offset != uploadSession.Size {
+		return "", errors.Errorf("received %d of %d bytes", uploadSession.Offset, uploadSession.Size)
+	}
+
+	bundlePath := UploadPath(id)
+	fileInfo, err := os.Stat(bundlePath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to stat upload file")
+	}
+	if fileInfo.Size() != uploadSession.Size {
+		return "", errors.Errorf("upload file is %d bytes, expected %d", fileInfo.Size(), uploadSession.Size)
+	}
+
+	if uploadSession.Checksum != "" {
+		actual, err := fileChecksum(bundlePath)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to calculate checksum")
+		}
+		if actual != uploadSession.Checksum {
+			return "", ChecksumMismatchError{Expected: uploadSession.Checksum, Actual: actual}
+		}
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `update airgap_upload_session set status = $1, updated_at = $2 where id = $3`
+	if _, err := db.Exec(query, UploadStatusComplete, time.Now(), id); err != nil {
+		return "", errors.Wrap(err, "failed to complete upload session")
+	}
+
+	return bundlePath, nil
+}
+
+// ReopenUploadSession sets a completed session back to uploading after the bundle failed to install,
+// so the upload can be completed again without uploading the bundle again
+func ReopenUploadSession(id string) error {
+	unlock := lockUploadSession(id)
+	defer unlock()
+
+	db := persistence.MustGetPGSession()
+	query := `update airgap_upload_session set status = $1, updated_at = $2 where id = $3`
+	if _, err := db.Exec(query, UploadStatusUploading, time.Now(), id); err != nil {
+		return errors.Wrap(err, "failed to reopen upload session")
+	}
+
+	return nil
+}
+
+// DeleteUploadSession removes the session and the bundle that was uploaded
+func DeleteUploadSession(id string) error {
+	unlock := lockUploadSession(id)
+	defer func() {
+		unlock()
+		forgetUploadLock(id)
+	}()
+
+	if err := os.Remove(UploadPath(id)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove upload file")
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `delete from airgap_upload_session where id = $1`
+	if _, err := db.Exec(query, id); err != nil {
+		return errors.Wrap(err, "failed to delete upload session")
+	}
+
+	return nil
+}
+
+// StartUploadSessionReaper periodically deletes the upload sessions that were abandoned, together with their
+// bundles. A session is abandoned when it was not updated for KOTSADM_AIRGAP_UPLOAD_TTL, 24h by default
+func StartUploadSessionReaper() {
+	ttl := defaultUploadSessionTTL
+	if os.Getenv("KOTSADM_AIRGAP_UPLOAD_TTL") != "" {
+		parsed, err := time.ParseDuration(os.Getenv("KOTSADM_AIRGAP_UPLOAD_TTL"))
+		if err != nil {
+			logger.Error(errors.Wrap(err, "failed to parse KOTSADM_AIRGAP_UPLOAD_TTL, using the default"))
+		} else {
+			ttl = parsed
+		}
+	}
+
+	go func() {
+		for {
+			if err := deleteExpiredUploadSessions(time.Now(), ttl); err != nil {
+				logger.Error(errors.Wrap(err, "failed to delete expired upload sessions"))
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+func deleteExpiredUploadSessions(now time.Time, ttl time.Duration) error {
+	db := persistence.MustGetPGSession()
+	query := `select id, updated_at from airgap_upload_session`
+	rows, err := db.Query(query)
+	if err != nil {
+		return errors.Wrap(err, "failed to query upload sessions")
+	}
+
+	expiredIDs := []string{}
+	for rows.Next() {
+		var id string
+		var updatedAt time.Time
+		if err := rows.Scan(&id, &updatedAt); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "failed to scan upload session")
+		}
+		if isUploadSessionExpired(updatedAt, now, ttl) {
+			expiredIDs = append(expiredIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range expiredIDs {
+		if err := DeleteUploadSession(id); err != nil {
+			logger.Error(errors.Wrapf(err, "failed to delete upload session %s", id))
+		}
+	}
+
+	return nil
+}
+
+func isUploadSessionExpired(updatedAt time.Time, now time.Time, ttl time.Duration) bool {
+	return now.Sub(updatedAt) > ttl
+}
+
+func fileChecksum(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open file")
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", errors.Wrap(err, "failed to read file")
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,125 @@
+package airgap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_resumeOffset(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileSize      int64
+		sessionOffset int64
+		expected      int64
+	}{
+		{
+			name:          "file has every chunk",
+			fileSize:      1024,
+			sessionOffset: 1024,
+			expected:      1024,
+		},
+		{
+			name:          "file was lost",
+			fileSize:      0,
+			sessionOffset: 1024,
+			expected:      0,
+		},
+		{
+			name:          "file is missing chunks",
+			fileSize:      512,
+			sessionOffset: 1024,
+			expected:      512,
+		},
+		{
+			name:          "file has left over data from a failed chunk",
+			fileSize:      1536,
+			sessionOffset: 1024,
+			expected:      1024,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			req.Equal(test.expected, resumeOffset(test.fileSize, test.sessionOffset))
+		})
+	}
+}
+
+func Test_isUploadSessionExpired(t *testing.T) {
+	now := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		updatedAt time.Time
+		expected  bool
+	}{
+		{
+			name:      "recently updated",
+			updatedAt: now.Add(-time.Minute),
+			expected:  false,
+		},
+		{
+			name:      "updated exactly ttl ago",
+			updatedAt: now.Add(-24 * time.Hour),
+			expected:  false,
+		},
+		{
+			name:      "abandoned",
+			updatedAt: now.Add(-25 * time.Hour),
+			expected:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			req.Equal(test.expected, isUploadSessionExpired(test.updatedAt, now, 24*time.Hour))
+		})
+	}
+}
+
+func Test_lockUploadSession(t *testing.T) {
+	req := require.New(t)
+
+	unlockFirst := lockUploadSession("first")
+
+	// another session is not blocked by the first
+	locked := make(chan struct{})
+	go func() {
+		unlockSecond := lockUploadSession("second")
+		close(locked)
+		unlockSecond()
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		req.Fail("second session was blocked by the first")
+	}
+
+	// the same session waits for the lock to be released
+	relocked := make(chan struct{})
+	go func() {
+		unlock := lockUploadSession("first")
+		close(relocked)
+		unlock()
+	}()
+	select {
+	case <-relocked:
+		req.Fail("first session was locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockFirst()
+	select {
+	case <-relocked:
+	case <-time.After(time.Second):
+		req.Fail("first session was not unlocked")
+	}
+
+	forgetUploadLock("first")
+	forgetUploadLock("second")
+}
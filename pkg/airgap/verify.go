@@ -0,0 +1,262 @@
+package airgap
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/task"
+)
+
+const (
+	// ManifestFile lists the sha256 digest of every other file in the bundle
+	ManifestFile = "manifest.json"
+	// SignatureFile is the base64 encoded signature of the manifest by the vendor key
+	SignatureFile = "manifest.sig"
+
+	publicKeyEnv = "AIRGAP_BUNDLE_PUBLIC_KEY"
+)
+
+type bundleManifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// UnsignedBundleError is returned for bundles without a manifest and signature
+type UnsignedBundleError struct{}
+
+func (e UnsignedBundleError) Error() string {
+	return "the bundle is not signed"
+}
+
+// VerifyBundle checks the signature of the manifest in the extracted bundle at airgapRoot with publicKey, and
+// that every file in the bundle is in the manifest with a matching digest. It returns UnsignedBundleError
+// if the bundle doesn't have a manifest
+func VerifyBundle(airgapRoot string, publicKey []byte) error {
+	manifestData, err := ioutil.ReadFile(filepath.Join(airgapRoot, ManifestFile))
+	if os.IsNotExist(err) {
+		return UnsignedBundleError{}
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read manifest")
+	}
+
+	signatureData, err := ioutil.ReadFile(filepath.Join(airgapRoot, SignatureFile))
+	if os.IsNotExist(err) {
+		return UnsignedBundleError{}
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read signature")
+	}
+
+	if len(publicKey) == 0 {
+		return errors.Errorf("the bundle is signed, but no public key is configured in %s", publicKeyEnv)
+	}
+
+	if err := verifySignature(manifestData, signatureData, publicKey); err != nil {
+		return errors.Wrap(err, "manifest signature is not valid")
+	}
+
+	manifest := bundleManifest{}
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return errors.Wrap(err, "failed to parse manifest")
+	}
+
+	if err := verifyDigests(airgapRoot, manifest); err != nil {
+		return errors.Wrap(err, "bundle does not match manifest")
+	}
+
+	return nil
+}
+
+// VerifyBundleDigests checks that every file in the extracted bundle at airgapRoot is in the manifest with a
+// matching digest, without checking the signature of the manifest. It returns UnsignedBundleError if the bundle
+// doesn't have a manifest
+func VerifyBundleDigests(airgapRoot string) error {
+	manifestData, err := ioutil.ReadFile(filepath.Join(airgapRoot, ManifestFile))
+	if os.IsNotExist(err) {
+		return UnsignedBundleError{}
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read manifest")
+	}
+
+	manifest := bundleManifest{}
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return errors.Wrap(err, "failed to parse manifest")
+	}
+
+	if err := verifyDigests(airgapRoot, manifest); err != nil {
+		return errors.Wrap(err, "bundle does not match manifest")
+	}
+
+	return nil
+}
+
+// verifyExtractedBundle verifies the bundle and reports the result in the task status, see checkBundleSignature
+func verifyExtractedBundle(taskID string, airgapRoot string, allowUnsigned bool) error {
+	if err := task.SetTaskStatus(taskID, "Verifying bundle signature...", "running"); err != nil {
+		return errors.Wrap(err, "failed to set task status")
+	}
+
+	warning, err := checkBundleSignature(airgapRoot, BundlePublicKey(), allowUnsigned)
+	if err != nil {
+		return errors.Errorf("Bundle signature verification failed: %s", err.Error())
+	}
+
+	if warning != "" {
+		logger.Debug(warning)
+		if err := task.SetTaskStatus(taskID, warning, "running"); err != nil {
+			return errors.Wrap(err, "failed to set task status")
+		}
+		return nil
+	}
+
+	if err := task.SetTaskStatus(taskID, "Bundle signature verified", "running"); err != nil {
+		return errors.Wrap(err, "failed to set task status")
+	}
+
+	return nil
+}
+
+// checkBundleSignature enforces bundle signatures once a vendor public key is configured. Without a key, every
+// bundle is accepted with a warning, but the digests in the manifest of signed bundles are still checked. With a
+// key, unsigned bundles are rejected unless an admin allowed them, and bundles that fail verification are always
+// rejected. The returned warning is empty for verified bundles
+func checkBundleSignature(airgapRoot string, publicKey []byte, allowUnsigned bool) (string, error) {
+	if len(publicKey) == 0 {
+		err := VerifyBundleDigests(airgapRoot)
+		if _, ok := errors.Cause(err).(UnsignedBundleError); ok {
+			return fmt.Sprintf("Bundle signature was not verified because no public key is configured in %s", publicKeyEnv), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Bundle digests verified, signature not verified because no public key is configured in %s", publicKeyEnv), nil
+	}
+
+	err := VerifyBundle(airgapRoot, publicKey)
+	if _, ok := errors.Cause(err).(UnsignedBundleError); ok {
+		if !allowUnsigned {
+			return "", errors.New("the bundle is not signed. An admin can allow unsigned bundles when uploading.")
+		}
+		return "Bundle is not signed, continuing because an admin allowed unsigned bundles", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return "", nil
+}
+
+// BundlePublicKey returns the vendor public key that bundles are verified with
+func BundlePublicKey() []byte {
+	return []byte(os.Getenv(publicKeyEnv))
+}
+
+func verifySignature(data []byte, encodedSignature []byte, publicKeyPEM []byte) error {
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSignature)))
+	if err != nil {
+		return errors.Wrap(err, "failed to decode signature")
+	}
+
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return errors.New("failed to decode public key")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse public key")
+	}
+
+	digest := sha256.Sum256(data)
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.Wrap(err, "failed to verify signature")
+		}
+	case *ecdsa.PublicKey:
+		ecdsaSignature := struct {
+			R, S *big.Int
+		}{}
+		if _, err := asn1.Unmarshal(signature, &ecdsaSignature); err != nil {
+			return errors.Wrap(err, "failed to parse signature")
+		}
+		if !ecdsa.Verify(key, digest[:], ecdsaSignature.R, ecdsaSignature.S) {
+			return errors.New("failed to verify signature")
+		}
+	default:
+		return errors.Errorf("unsupported public key type %T", publicKey)
+	}
+
+	return nil
+}
+
+func verifyDigests(airgapRoot string, manifest bundleManifest) error {
+	found := map[string]bool{}
+
+	err := filepath.Walk(airgapRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(airgapRoot, path)
+		if err != nil {
+			return errors.Wrap(err, "failed to get relative path")
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == ManifestFile || relPath == SignatureFile {
+			return nil
+		}
+
+		expected, ok := manifest.Files[relPath]
+		if !ok {
+			return errors.Errorf("%s is not in the manifest", relPath)
+		}
+
+		actual, err := fileChecksum(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to calculate digest of %s", relPath)
+		}
+		if strings.TrimPrefix(strings.ToLower(expected), "sha256:") != actual {
+			return errors.Errorf("digest of %s does not match", relPath)
+		}
+
+		found[relPath] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	missing := []string{}
+	for relPath := range manifest.Files {
+		if !found[relPath] {
+			missing = append(missing, relPath)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.Errorf("missing files: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
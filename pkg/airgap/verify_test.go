@@ -0,0 +1,241 @@
+package airgap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_VerifyBundle(t *testing.T) {
+	req := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req.NoError(err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	req.NoError(err)
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req.NoError(err)
+
+	files := map[string]string{
+		"airgap.yaml":                      "kind: Airgap",
+		"app.tar.gz":                       "release",
+		"images/docker-archive/nginx/1.19": "image",
+	}
+
+	tests := []struct {
+		name      string
+		unsigned  bool
+		signer    *ecdsa.PrivateKey
+		tamper    func(root string)
+		expectErr string
+	}{
+		{
+			name:   "valid",
+			signer: key,
+		},
+		{
+			name:      "unsigned",
+			unsigned:  true,
+			expectErr: "the bundle is not signed",
+		},
+		{
+			name:      "wrong key",
+			signer:    otherKey,
+			expectErr: "manifest signature is not valid",
+		},
+		{
+			name:   "modified file",
+			signer: key,
+			tamper: func(root string) {
+				ioutil.WriteFile(filepath.Join(root, "app.tar.gz"), []byte("modified"), 0644)
+			},
+			expectErr: "digest of app.tar.gz does not match",
+		},
+		{
+			name:   "extra file",
+			signer: key,
+			tamper: func(root string) {
+				ioutil.WriteFile(filepath.Join(root, "images", "extra"), []byte("extra"), 0644)
+			},
+			expectErr: "images/extra is not in the manifest",
+		},
+		{
+			name:   "missing file",
+			signer: key,
+			tamper: func(root string) {
+				os.Remove(filepath.Join(root, "airgap.yaml"))
+			},
+			expectErr: "missing files: airgap.yaml",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			root, err := ioutil.TempDir("", "kotsadm")
+			req.NoError(err)
+			defer os.RemoveAll(root)
+
+			writeTestBundle(t, root, files, test.signer)
+
+			if test.tamper != nil {
+				test.tamper(root)
+			}
+
+			err = VerifyBundle(root, publicKey)
+			if test.expectErr == "" {
+				req.NoError(err)
+				return
+			}
+			req.Error(err)
+			req.Contains(err.Error(), test.expectErr)
+			if test.unsigned {
+				req.IsType(UnsignedBundleError{}, errors.Cause(err))
+			}
+		})
+	}
+}
+
+func Test_checkBundleSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"airgap.yaml": "kind: Airgap",
+		"app.tar.gz":  "release",
+	}
+
+	tests := []struct {
+		name          string
+		signer        *ecdsa.PrivateKey
+		publicKey     []byte
+		allowUnsigned bool
+		tamper        func(root string)
+		expectWarning string
+		expectErr     string
+	}{
+		{
+			name:          "unsigned without a public key",
+			expectWarning: "signature was not verified",
+		},
+		{
+			name:          "signed without a public key",
+			signer:        otherKey,
+			expectWarning: "digests verified, signature not verified",
+		},
+		{
+			name:   "signed without a public key and modified",
+			signer: otherKey,
+			tamper: func(root string) {
+				ioutil.WriteFile(filepath.Join(root, "app.tar.gz"), []byte("modified"), 0644)
+			},
+			expectErr: "digest of app.tar.gz does not match",
+		},
+		{
+			name:      "signed with the public key",
+			signer:    key,
+			publicKey: publicKey,
+		},
+		{
+			name:      "unsigned with a public key",
+			publicKey: publicKey,
+			expectErr: "the bundle is not signed",
+		},
+		{
+			name:          "unsigned with a public key allowed by an admin",
+			publicKey:     publicKey,
+			allowUnsigned: true,
+			expectWarning: "an admin allowed unsigned bundles",
+		},
+		{
+			name:          "signed with another key",
+			signer:        otherKey,
+			publicKey:     publicKey,
+			allowUnsigned: true,
+			expectErr:     "manifest signature is not valid",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			root, err := ioutil.TempDir("", "kotsadm")
+			req.NoError(err)
+			defer os.RemoveAll(root)
+
+			writeTestBundle(t, root, files, test.signer)
+			if test.tamper != nil {
+				test.tamper(root)
+			}
+
+			warning, err := checkBundleSignature(root, test.publicKey, test.allowUnsigned)
+			if test.expectErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), test.expectErr)
+				return
+			}
+			req.NoError(err)
+			if test.expectWarning != "" {
+				req.Contains(warning, test.expectWarning)
+			} else {
+				req.Empty(warning)
+			}
+		})
+	}
+}
+
+// writeTestBundle writes the files of an extracted bundle to root, with a manifest signed by signer.
+// The bundle is unsigned when signer is nil
+func writeTestBundle(t *testing.T, root string, files map[string]string, signer *ecdsa.PrivateKey) {
+	req := require.New(t)
+
+	manifest := bundleManifest{Files: map[string]string{}}
+	for name, content := range files {
+		req.NoError(os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755))
+		req.NoError(ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+
+		digest := sha256.Sum256([]byte(content))
+		manifest.Files[name] = "sha256:" + hex.EncodeToString(digest[:])
+	}
+
+	if signer == nil {
+		return
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	req.NoError(err)
+	req.NoError(ioutil.WriteFile(filepath.Join(root, ManifestFile), manifestData, 0644))
+
+	digest := sha256.Sum256(manifestData)
+	r, s, err := ecdsa.Sign(rand.Reader, signer, digest[:])
+	req.NoError(err)
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	req.NoError(err)
+	req.NoError(ioutil.WriteFile(filepath.Join(root, SignatureFile), []byte(base64.StdEncoding.EncodeToString(signature)), 0644))
+}
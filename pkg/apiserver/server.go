@@ -13,9 +13,14 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/replicatedhq/kotsadm/pkg/airgap"
 	"github.com/replicatedhq/kotsadm/pkg/automation"
 	"github.com/replicatedhq/kotsadm/pkg/handlers"
 	"github.com/replicatedhq/kotsadm/pkg/informers"
+	"github.com/replicatedhq/kotsadm/pkg/license"
+	"github.com/replicatedhq/kotsadm/pkg/maintenance"
+	"github.com/replicatedhq/kotsadm/pkg/preflight"
+	"github.com/replicatedhq/kotsadm/pkg/updatechecker"
 )
 
 func Start() {
@@ -35,6 +40,12 @@ func Start() {
 		log.Println("Failed to run automated installs", err)
 	}
 
+	license.StartMonitor()
+	updatechecker.StartScheduler()
+	maintenance.StartQueueProcessor()
+	preflight.StartHealthCheckMonitor()
+	airgap.StartUploadSessionReaper()
+
 	u, err := url.Parse("http://kotsadm-api-node:3000")
 	if err != nil {
 		panic(err)
@@ -70,14 +81,33 @@ func Start() {
 
 	// Airgap upload and update
 	r.Path("/api/v1/app/airgap").Methods("OPTIONS", "POST", "PUT").HandlerFunc(handlers.UploadAirgapBundle)
+	r.Path("/api/v1/airgap/upload").Methods("OPTIONS", "POST").HandlerFunc(handlers.CreateAirgapUpload)
+	r.Path("/api/v1/airgap/upload/{uploadId}").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetAirgapUpload)
+	r.Path("/api/v1/airgap/upload/{uploadId}/chunk").Methods("OPTIONS", "PUT").HandlerFunc(handlers.UploadAirgapChunk)
+	r.Path("/api/v1/airgap/upload/{uploadId}/inspect").Methods("OPTIONS", "GET").HandlerFunc(handlers.InspectAirgapUpload)
+	r.Path("/api/v1/airgap/upload/{uploadId}/complete").Methods("OPTIONS", "POST").HandlerFunc(handlers.CompleteAirgapUpload)
 
 	// Implemented handlers
 	r.Path("/api/v1/license/platform").Methods("OPTIONS", "POST").HandlerFunc(handlers.ExchangePlatformLicense)
 	r.Path("/api/v1/app/{appSlug}/sequence/{sequence}/preflight/ignore-rbac").Methods("OPTIONS", "POST").HandlerFunc(handlers.IgnorePreflightRBACErrors)
 	r.Path("/api/v1/app/{appSlug}/preflight/run").Methods("OPTIONS", "POST").HandlerFunc(handlers.StartPreflightChecks)
+	r.Path("/api/v1/app/{appSlug}/preflight/runs").Methods("OPTIONS", "GET").HandlerFunc(handlers.ListPreflightRuns)
+	r.Path("/api/v1/app/{appSlug}/preflight/runs/{runId}").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetPreflightRun)
+	r.Path("/api/v1/app/{appSlug}/preflight/diff").Methods("OPTIONS", "GET").HandlerFunc(handlers.DiffPreflightRuns)
+	r.Path("/api/v1/app/{appSlug}/preflight/policy").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetPreflightGatingPolicy)
+	r.Path("/api/v1/app/{appSlug}/preflight/policy").Methods("PUT").HandlerFunc(handlers.SetPreflightGatingPolicy)
+	r.Path("/api/v1/app/{appSlug}/preflight/audit").Methods("OPTIONS", "GET").HandlerFunc(handlers.ListPreflightGateEvents)
+	r.Path("/api/v1/app/{appSlug}/sequence/{sequence}/preflight/gate").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetPreflightGate)
+	r.Path("/api/v1/app/{appSlug}/health-checks").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetHealthChecks)
+	r.Path("/api/v1/app/{appSlug}/health-checks").Methods("PUT").HandlerFunc(handlers.SetHealthCheckSettings)
+	r.Path("/api/v1/app/{appSlug}/health-checks/run").Methods("OPTIONS", "POST").HandlerFunc(handlers.RunHealthChecks)
 	r.Path("/api/v1/upload").Methods("PUT").HandlerFunc(handlers.UploadExistingApp)
 	r.Path("/api/v1/download").Methods("GET").HandlerFunc(handlers.DownloadApp)
+	r.Path("/api/v1/encryptionkey/rotate").Methods("POST").HandlerFunc(handlers.RotateEncryptionKey)
+	r.Path("/api/v1/encryptionkey/versions").Methods("OPTIONS", "GET").HandlerFunc(handlers.ListEncryptionKeyVersions)
 	r.Path("/api/v1/app/{appSlug}/sequence/{sequence}/renderedcontents").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetAppRenderedContents)
+	r.Path("/api/v1/app/{appSlug}/sequence/{sequence}/downstream/{downstreamName}/manifests").Methods("GET").HandlerFunc(handlers.GetDeployManifests)
+	r.Path("/api/v1/app/{appSlug}/sequence/{sequence}/images").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetAppVersionImages)
 
 	r.HandleFunc("/api/v1/login", handlers.Login)
 	r.HandleFunc("/api/v1/logout", handlers.NotImplemented)
@@ -88,9 +118,36 @@ func Start() {
 
 	r.Path("/api/v1/metadata").Methods("OPTIONS", "GET").HandlerFunc(handlers.Metadata)
 	r.Path("/api/v1/app/{appSlug}/registry").Methods("OPTIONS", "PUT").HandlerFunc(handlers.UpdateAppRegistry)
+	r.Path("/api/v1/app/{appSlug}/registry/test").Methods("OPTIONS", "POST").HandlerFunc(handlers.TestAppRegistry)
+	r.Path("/api/v1/app/{appSlug}/registry/gc").Methods("OPTIONS", "GET", "POST").HandlerFunc(handlers.GarbageCollectImages)
+	r.Path("/api/v1/registry/tls").Methods("OPTIONS", "GET").HandlerFunc(handlers.ListRegistryTLS)
+	r.Path("/api/v1/registry/tls").Methods("OPTIONS", "PUT").HandlerFunc(handlers.SetRegistryTLS)
+	r.Path("/api/v1/registry/tls/{hostname}").Methods("OPTIONS", "DELETE").HandlerFunc(handlers.DeleteRegistryTLS)
 	r.Path("/api/v1/app/{appSlug}/config").Methods("OPTIONS", "PUT").HandlerFunc(handlers.UpdateAppConfig)
+	r.Path("/api/v1/app/{appSlug}/config/history").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetAppConfigHistory)
+	r.Path("/api/v1/app/{appSlug}/config/restore/{sequence}").Methods("OPTIONS", "POST").HandlerFunc(handlers.RestoreAppConfig)
+	r.Path("/api/v1/app/{appSlug}/config/values").Methods("OPTIONS", "GET").HandlerFunc(handlers.ExportAppConfigValues)
+	r.Path("/api/v1/app/{appSlug}/config/values").Methods("POST").HandlerFunc(handlers.ImportAppConfigValues)
+	r.Path("/api/v1/app/{appSlug}/sequence/{sequence}/config/preview").Methods("OPTIONS", "POST").HandlerFunc(handlers.PreviewAppConfig)
+	r.Path("/api/v1/app/{appSlug}/sequence/{sequence}/template/render").Methods("OPTIONS", "POST").HandlerFunc(handlers.RenderAppTemplate)
 	r.Path("/api/v1/app/{appSlug}/license").Methods("OPTIONS", "PUT").HandlerFunc(handlers.SyncLicense)
+	r.Path("/api/v1/app/{appSlug}/license/status").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetLicenseStatus)
+	r.Path("/api/v1/app/{appSlug}/sequence/{sequence}/license/diff").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetLicenseDiff)
+	r.Path("/api/v1/app/{appSlug}/notifications").Methods("OPTIONS", "GET").HandlerFunc(handlers.ListNotifications)
+	r.Path("/api/v1/app/{appSlug}/notification/{notificationId}/dismiss").Methods("OPTIONS", "PUT").HandlerFunc(handlers.DismissNotification)
 	r.Path("/api/v1/app/{appSlug}/updatecheck").Methods("OPTIONS", "POST").HandlerFunc(handlers.AppUpdateCheck)
+	r.Path("/api/v1/app/{appSlug}/updatecheck/schedule").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetUpdateCheckSchedule)
+	r.Path("/api/v1/app/{appSlug}/updatecheck/schedule").Methods("PUT").HandlerFunc(handlers.SetUpdateCheckSchedule)
+	r.Path("/api/v1/app/{appSlug}/updates").Methods("OPTIONS", "GET").HandlerFunc(handlers.ListAvailableUpdates)
+	r.Path("/api/v1/app/{appSlug}/updates/download").Methods("OPTIONS", "POST").HandlerFunc(handlers.DownloadUpdate)
+	r.Path("/api/v1/app/{appSlug}/autodeploy").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetAutoDeploy)
+	r.Path("/api/v1/app/{appSlug}/autodeploy").Methods("PUT").HandlerFunc(handlers.SetAutoDeployPolicy)
+	r.Path("/api/v1/app/{appSlug}/maintenancewindows").Methods("OPTIONS", "GET").HandlerFunc(handlers.GetMaintenanceWindows)
+	r.Path("/api/v1/app/{appSlug}/maintenancewindows").Methods("PUT").HandlerFunc(handlers.SetMaintenanceWindows)
+	r.Path("/api/v1/app/{appSlug}/sequence/{sequence}/deploy").Methods("OPTIONS", "POST").HandlerFunc(handlers.DeployAppVersion)
+	r.Path("/api/v1/app/{appSlug}/deploys/queued").Methods("OPTIONS", "GET").HandlerFunc(handlers.ListQueuedDeploys)
+	r.Path("/api/v1/app/{appSlug}/deploys/queued/{queuedDeployId}/deploy").Methods("OPTIONS", "POST").HandlerFunc(handlers.DeployQueuedDeploy)
+	r.Path("/api/v1/app/{appSlug}/deploys/queued/{queuedDeployId}/cancel").Methods("OPTIONS", "POST").HandlerFunc(handlers.CancelQueuedDeploy)
 
 	// App snapshot routes
 	r.Path("/api/v1/app/{appSlug}/snapshot/backup").Methods("OPTIONS", "POST").HandlerFunc(handlers.CreateBackup)
@@ -70,6 +70,39 @@ func GetFromSlug(slug string) (*App, error) {
 	return Get(id)
 }
 
+// ListInstalled returns the apps that have finished installing
+func ListInstalled() ([]*App, error) {
+	logger.Debug("getting all installed apps")
+
+	db := persistence.MustGetPGSession()
+	query := `select id from app where install_state = 'installed'`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query apps")
+	}
+	defer rows.Close()
+
+	appIDs := []string{}
+	for rows.Next() {
+		var appID string
+		if err := rows.Scan(&appID); err != nil {
+			return nil, errors.Wrap(err, "failed to scan app id")
+		}
+		appIDs = append(appIDs, appID)
+	}
+
+	apps := []*App{}
+	for _, appID := range appIDs {
+		app, err := Get(appID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get app %s", appID)
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, nil
+}
+
 func GetLicenseDataFromDatabase(id string) (string, error) {
 	logger.Debug("getting app license from database",
 		zap.String("id", id))
@@ -0,0 +1,183 @@
+package autodeploy
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/maintenance"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	"go.uber.org/zap"
+)
+
+type Decision struct {
+	Sequence     int64     `json:"sequence"`
+	VersionLabel string    `json:"versionLabel"`
+	Policy       string    `json:"policy"`
+	Deployed     bool      `json:"deployed"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func GetPolicy(appID string) (string, error) {
+	db := persistence.MustGetPGSession()
+	query := `select auto_deploy_policy from app where id = $1`
+	row := db.QueryRow(query, appID)
+
+	var policy sql.NullString
+	if err := row.Scan(&policy); err != nil {
+		return "", errors.Wrap(err, "failed to scan auto deploy policy")
+	}
+
+	if policy.String == "" {
+		return PolicyNever, nil
+	}
+	return policy.String, nil
+}
+
+func SetPolicy(appID string, policy string) error {
+	if !IsValidPolicy(policy) {
+		return errors.Errorf("unknown auto deploy policy %q", policy)
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `update app set auto_deploy_policy = $1 where id = $2`
+	if _, err := db.Exec(query, policy, appID); err != nil {
+		return errors.Wrap(err, "failed to set auto deploy policy")
+	}
+
+	return nil
+}
+
+// ListDecisions returns why each version was or was not deployed automatically, newest first
+func ListDecisions(appID string) ([]*Decision, error) {
+	db := persistence.MustGetPGSession()
+	query := `select d.sequence, v.version_label, d.policy, d.deployed, d.reason, d.created_at
+from app_auto_deploy_decision d
+left join app_version v on v.app_id = d.app_id and v.sequence = d.sequence
+where d.app_id = $1 order by d.sequence desc`
+	rows, err := db.Query(query, appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query auto deploy decisions")
+	}
+	defer rows.Close()
+
+	decisions := []*Decision{}
+	for rows.Next() {
+		decision := Decision{}
+		var versionLabel sql.NullString
+		if err := rows.Scan(&decision.Sequence, &versionLabel, &decision.Policy, &decision.Deployed, &decision.Reason, &decision.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan auto deploy decision")
+		}
+		decision.VersionLabel = versionLabel.String
+
+		decisions = append(decisions, &decision)
+	}
+
+	return decisions, nil
+}
+
+// VersionReady is called when a version has passed preflights, or has none, and deploys it if the policy of the
+// app allows it. The decision is recorded with the reason either way
+func VersionReady(appID string, sequence int64) {
+	if err := versionReady(appID, sequence); err != nil {
+		logger.Error(errors.Wrapf(err, "failed to evaluate automatic deploy of sequence %d", sequence))
+	}
+}
+
+func versionReady(appID string, sequence int64) error {
+	policy, err := GetPolicy(appID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get policy")
+	}
+	// nothing is recorded for apps that don't deploy automatically
+	if policy == PolicyNever {
+		return nil
+	}
+
+	downstreams, err := downstream.ListDownstreamsForApp(appID)
+	if err != nil {
+		return errors.Wrap(err, "failed to list downstreams")
+	}
+	if len(downstreams) == 0 {
+		return nil
+	}
+
+	currentSequence := downstreams[0].CurrentSequence
+	if currentSequence == -1 {
+		// the first version is deployed by the install
+		return nil
+	}
+	if sequence <= currentSequence {
+		return nil
+	}
+
+	currentVersionLabel, err := getVersionLabel(appID, currentSequence)
+	if err != nil {
+		return errors.Wrap(err, "failed to get deployed version label")
+	}
+	versionLabel, err := getVersionLabel(appID, sequence)
+	if err != nil {
+		return errors.Wrap(err, "failed to get version label")
+	}
+
+	status, err := downstream.GetDownstreamVersionStatus(appID, sequence)
+	if err != nil {
+		return errors.Wrap(err, "failed to get downstream version status")
+	}
+	preflightResult, err := downstream.GetPreflightResult(appID, sequence)
+	if err != nil {
+		return errors.Wrap(err, "failed to get preflight result")
+	}
+
+	deploy, reason := decide(policy, currentVersionLabel, versionLabel, status, preflightResult)
+	if deploy {
+		queuedDeploy, err := maintenance.RequestDeploy(appID, sequence, "auto", false, nil)
+		if err != nil {
+			deploy = false
+			reason = errors.Cause(err).Error()
+			logger.Error(errors.Wrap(err, "failed to deploy version"))
+		} else if queuedDeploy != nil {
+			reason = fmt.Sprintf("%s, queued until the maintenance window at %s", reason, queuedDeploy.ScheduledFor.Format(time.RFC3339))
+		}
+	}
+
+	logger.Debug("evaluated automatic deploy",
+		zap.String("appID", appID),
+		zap.Int64("sequence", sequence),
+		zap.Bool("deployed", deploy),
+		zap.String("reason", reason))
+
+	if err := recordDecision(appID, sequence, policy, deploy, reason); err != nil {
+		return errors.Wrap(err, "failed to record decision")
+	}
+
+	return nil
+}
+
+func getVersionLabel(appID string, sequence int64) (string, error) {
+	db := persistence.MustGetPGSession()
+	query := `select version_label from app_version where app_id = $1 and sequence = $2`
+	row := db.QueryRow(query, appID, sequence)
+
+	var versionLabel sql.NullString
+	if err := row.Scan(&versionLabel); err != nil {
+		return "", errors.Wrap(err, "failed to scan version label")
+	}
+
+	return versionLabel.String, nil
+}
+
+func recordDecision(appID string, sequence int64, policy string, deployed bool, reason string) error {
+	db := persistence.MustGetPGSession()
+	query := `insert into app_auto_deploy_decision (app_id, sequence, policy, deployed, reason, created_at) values ($1, $2, $3, $4, $5, $6)
+on conflict(app_id, sequence) do update set policy = EXCLUDED.policy, deployed = EXCLUDED.deployed, reason = EXCLUDED.reason, created_at = EXCLUDED.created_at`
+	if _, err := db.Exec(query, appID, sequence, policy, deployed, reason, time.Now()); err != nil {
+		return errors.Wrap(err, "failed to insert decision")
+	}
+
+	return nil
+}
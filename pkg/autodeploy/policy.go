@@ -0,0 +1,115 @@
+package autodeploy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	troubleshootpreflight "github.com/replicatedhq/troubleshoot/pkg/preflight"
+)
+
+const (
+	PolicyNever         = "never"
+	PolicyPatch         = "patch"
+	PolicyMinorAndPatch = "minor-and-patch"
+	PolicyAny           = "any"
+)
+
+func IsValidPolicy(policy string) bool {
+	switch policy {
+	case PolicyNever, PolicyPatch, PolicyMinorAndPatch, PolicyAny:
+		return true
+	}
+	return false
+}
+
+// decide returns whether a version that is ready should be deployed under the policy, and why
+func decide(policy string, currentVersionLabel string, versionLabel string, status string, preflightResult string) (bool, string) {
+	if policy == "" || policy == PolicyNever {
+		return false, "automatic deploys are disabled"
+	}
+
+	switch status {
+	case "pending_config":
+		return false, "the version requires configuration"
+	case "pending_preflight":
+		return false, "preflight checks have not completed"
+	case "pending":
+	default:
+		return false, fmt.Sprintf("the version is %s", status)
+	}
+
+	if preflightResult != "" {
+		if reason := failedPreflightReason(preflightResult); reason != "" {
+			return false, reason
+		}
+	}
+
+	if policy == PolicyAny {
+		return true, fmt.Sprintf("policy %s allows every update", policy)
+	}
+
+	change, err := versionChange(currentVersionLabel, versionLabel)
+	if err != nil {
+		return false, fmt.Sprintf("policy %s requires semantic versions: %s", policy, err.Error())
+	}
+
+	switch change {
+	case "patch":
+		return true, fmt.Sprintf("policy %s allows the patch update from %s to %s", policy, currentVersionLabel, versionLabel)
+	case "minor":
+		if policy == PolicyMinorAndPatch {
+			return true, fmt.Sprintf("policy %s allows the minor update from %s to %s", policy, currentVersionLabel, versionLabel)
+		}
+	case "none":
+		return false, fmt.Sprintf("%s is not newer than the deployed version %s", versionLabel, currentVersionLabel)
+	}
+
+	return false, fmt.Sprintf("policy %s does not allow the %s update from %s to %s", policy, change, currentVersionLabel, versionLabel)
+}
+
+// failedPreflightReason returns why the preflight result blocks a deploy, or an empty string if it passed.
+// Warnings don't block automatic deploys
+func failedPreflightReason(preflightResult string) string {
+	results := troubleshootpreflight.UploadPreflightResults{}
+	if err := json.Unmarshal([]byte(preflightResult), &results); err != nil {
+		return "failed to parse preflight results"
+	}
+
+	if len(results.Errors) > 0 {
+		return "preflight checks could not run because of permission errors"
+	}
+
+	for _, result := range results.Results {
+		if result.IsFail {
+			return fmt.Sprintf("preflight check %q failed", result.Title)
+		}
+	}
+
+	return ""
+}
+
+// versionChange returns major, minor or patch for the most significant part of the version that increased,
+// or none if the new version is not newer
+func versionChange(currentVersionLabel string, versionLabel string) (string, error) {
+	current, err := semver.NewVersion(currentVersionLabel)
+	if err != nil {
+		return "", errors.Wrapf(err, "deployed version %q", currentVersionLabel)
+	}
+	next, err := semver.NewVersion(versionLabel)
+	if err != nil {
+		return "", errors.Wrapf(err, "version %q", versionLabel)
+	}
+
+	if !next.GreaterThan(current) {
+		return "none", nil
+	}
+	if next.Major() != current.Major() {
+		return "major", nil
+	}
+	if next.Minor() != current.Minor() {
+		return "minor", nil
+	}
+	return "patch", nil
+}
@@ -0,0 +1,46 @@
+package autodeploy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_decide(t *testing.T) {
+	passed := `{"results":[{"isPass":true,"title":"Kubernetes version"},{"isWarn":true,"title":"Storage"}]}`
+	failed := `{"results":[{"isFail":true,"title":"Kubernetes version"}]}`
+	rbac := `{"errors":[{"error":"cannot list nodes"}]}`
+
+	tests := []struct {
+		name            string
+		policy          string
+		current         string
+		next            string
+		status          string
+		preflightResult string
+		expectDeploy    bool
+	}{
+		{name: "never", policy: PolicyNever, current: "1.0.0", next: "1.0.1", status: "pending", expectDeploy: false},
+		{name: "patch allowed", policy: PolicyPatch, current: "1.0.0", next: "1.0.1", status: "pending", preflightResult: passed, expectDeploy: true},
+		{name: "minor not allowed by patch", policy: PolicyPatch, current: "1.0.0", next: "1.1.0", status: "pending", expectDeploy: false},
+		{name: "minor allowed", policy: PolicyMinorAndPatch, current: "v1.0.0", next: "v1.1.0", status: "pending", expectDeploy: true},
+		{name: "major not allowed by minor", policy: PolicyMinorAndPatch, current: "1.0.0", next: "2.0.0", status: "pending", expectDeploy: false},
+		{name: "any allows non semver", policy: PolicyAny, current: "alpha", next: "beta", status: "pending", expectDeploy: true},
+		{name: "non semver", policy: PolicyPatch, current: "alpha", next: "beta", status: "pending", expectDeploy: false},
+		{name: "older version", policy: PolicyPatch, current: "1.0.1", next: "1.0.0", status: "pending", expectDeploy: false},
+		{name: "pending config", policy: PolicyAny, current: "1.0.0", next: "1.0.1", status: "pending_config", expectDeploy: false},
+		{name: "pending preflight", policy: PolicyAny, current: "1.0.0", next: "1.0.1", status: "pending_preflight", expectDeploy: false},
+		{name: "failed preflight", policy: PolicyAny, current: "1.0.0", next: "1.0.1", status: "pending", preflightResult: failed, expectDeploy: false},
+		{name: "rbac errors", policy: PolicyAny, current: "1.0.0", next: "1.0.1", status: "pending", preflightResult: rbac, expectDeploy: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			deploy, reason := decide(test.policy, test.current, test.next, test.status, test.preflightResult)
+			req.Equal(test.expectDeploy, deploy, reason)
+			req.NotEmpty(reason)
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package config
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+)
+
+// PasswordMask replaces the values of password items whenever they are returned from the api
+const PasswordMask = "***HIDDEN***"
+
+type ConfigValueChange struct {
+	Name     string `json:"name"`
+	Title    string `json:"title"`
+	OldValue string `json:"oldValue"`
+	NewValue string `json:"newValue"`
+}
+
+type ConfigHistoryEntry struct {
+	Sequence  int64               `json:"sequence"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Source    string              `json:"source"`
+	UpdatedBy string              `json:"updatedBy"`
+	Changes   []ConfigValueChange `json:"changes"`
+}
+
+// configHistoryVersion is an app version with the config that was stored with it. Config is nil for versions
+// without a config spec
+type configHistoryVersion struct {
+	Sequence      int64
+	CreatedAt     time.Time
+	Source        string
+	UpdatedBy     string
+	Config        *kotsv1beta1.Config
+	ConfigValues  *kotsv1beta1.ConfigValues
+	EncryptionKey string
+}
+
+// ListConfigHistory returns every version of the app where the config values changed
+// compared to the previous version, newest first. Password values are masked.
+func ListConfigHistory(appID string) ([]*ConfigHistoryEntry, error) {
+	db := persistence.MustGetPGSession()
+	query := `select av.sequence, av.created_at, av.config_spec, av.config_values, av.encryption_key, av.config_updated_by,
+(select adv.source from app_downstream_version adv where adv.app_id = av.app_id and adv.sequence = av.sequence limit 1)
+from app_version av where av.app_id = $1 order by av.sequence asc`
+	rows, err := db.Query(query, appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query app versions")
+	}
+	defer rows.Close()
+
+	versions := []configHistoryVersion{}
+	for rows.Next() {
+		var sequence int64
+		var createdAt sql.NullTime
+		var configSpec sql.NullString
+		var configValuesSpec sql.NullString
+		var encryptionKey sql.NullString
+		var updatedBy sql.NullString
+		var source sql.NullString
+		if err := rows.Scan(&sequence, &createdAt, &configSpec, &configValuesSpec, &encryptionKey, &updatedBy, &source); err != nil {
+			return nil, errors.Wrap(err, "failed to scan app version")
+		}
+
+		version := configHistoryVersion{
+			Sequence:      sequence,
+			Source:        source.String,
+			UpdatedBy:     updatedBy.String,
+			EncryptionKey: encryptionKey.String,
+		}
+		if createdAt.Valid {
+			version.CreatedAt = createdAt.Time
+		}
+
+		if configSpec.String != "" {
+			config, err := kotsutil.LoadConfigFromContents([]byte(configSpec.String))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to load config spec for sequence %d", sequence)
+			}
+			version.Config = config
+		}
+
+		if configValuesSpec.String != "" {
+			configValues, err := kotsutil.LoadConfigValuesFromContents([]byte(configValuesSpec.String))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to load config values for sequence %d", sequence)
+			}
+			version.ConfigValues = configValues
+		}
+
+		versions = append(versions, version)
+	}
+
+	return configHistory(versions)
+}
+
+// configHistory compares each version to the previous one with a config, and returns the versions where
+// the config values changed, newest first. Versions without a config spec are skipped, so that the next
+// version is compared to the values before them
+func configHistory(versions []configHistoryVersion) ([]*ConfigHistoryEntry, error) {
+	history := []*ConfigHistoryEntry{}
+	previousValues := map[string]string{}
+	for _, version := range versions {
+		if version.Config == nil {
+			continue
+		}
+
+		values, err := historyConfigValues(version.Config, version.ConfigValues, version.EncryptionKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read config values for sequence %d", version.Sequence)
+		}
+
+		changes := diffConfigValues(version.Config, previousValues, values)
+		previousValues = values
+		if len(changes) == 0 {
+			continue
+		}
+
+		history = append([]*ConfigHistoryEntry{
+			{
+				Sequence:  version.Sequence,
+				CreatedAt: version.CreatedAt,
+				Source:    version.Source,
+				UpdatedBy: version.UpdatedBy,
+				Changes:   changes,
+			},
+		}, history...)
+	}
+
+	return history, nil
+}
+
+// historyConfigValues returns the plain config values of a version. Older versions were stored without an
+// encryption key, their password items can't be decrypted and are masked instead
+func historyConfigValues(config *kotsv1beta1.Config, configValues *kotsv1beta1.ConfigValues, encryptionKey string) (map[string]string, error) {
+	if encryptionKey != "" {
+		return PlainConfigValues(config, configValues, encryptionKey)
+	}
+
+	values := map[string]string{}
+	if configValues == nil {
+		return values, nil
+	}
+
+	itemTypes := configItemTypes(config)
+	for name, configValue := range configValues.Spec.Values {
+		value := configValue.Value
+		if value == "" {
+			value = configValue.ValuePlaintext
+		}
+		if itemTypes[name] == "password" && value != "" {
+			value = PasswordMask
+		}
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+// GetConfigValuesForSequence returns the config values spec that was stored with the version, along with
+// the encryption key used for the password items in it
+func GetConfigValuesForSequence(appID string, sequence int64) (*kotsv1beta1.ConfigValues, string, error) {
+	db := persistence.MustGetPGSession()
+	query := `select config_values, encryption_key from app_version where app_id = $1 and sequence = $2`
+	row := db.QueryRow(query, appID, sequence)
+
+	var configValuesSpec sql.NullString
+	var encryptionKey sql.NullString
+	if err := row.Scan(&configValuesSpec, &encryptionKey); err != nil {
+		return nil, "", errors.Wrap(err, "failed to scan app version")
+	}
+
+	if configValuesSpec.String == "" {
+		return nil, "", errors.Errorf("sequence %d does not have config values", sequence)
+	}
+
+	configValues, err := kotsutil.LoadConfigValuesFromContents([]byte(configValuesSpec.String))
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to load config values")
+	}
+
+	return configValues, encryptionKey.String, nil
+}
+
+// SetConfigUpdatedBy records the user that changed the config values of the version
+func SetConfigUpdatedBy(appID string, sequence int64, updatedBy string) error {
+	db := persistence.MustGetPGSession()
+	query := `update app_version set config_updated_by = $1 where app_id = $2 and sequence = $3`
+	_, err := db.Exec(query, updatedBy, appID, sequence)
+	if err != nil {
+		return errors.Wrap(err, "failed to set config updated by")
+	}
+
+	return nil
+}
+
+// PlainConfigValues returns the config values keyed by item name, with password items decrypted
+// using encryptionKey
+func PlainConfigValues(config *kotsv1beta1.Config, configValues *kotsv1beta1.ConfigValues, encryptionKey string) (map[string]string, error) {
+	values := map[string]string{}
+	if configValues == nil {
+		return values, nil
+	}
+
+	cipher, err := crypto.AESCipherFromString(encryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+
+	itemTypes := configItemTypes(config)
+	for name, configValue := range configValues.Spec.Values {
+		value := configValue.Value
+		if value == "" {
+			value = configValue.ValuePlaintext
+		}
+
+		if itemTypes[name] == "password" && configValue.Value != "" {
+			decoded, err := base64.StdEncoding.DecodeString(configValue.Value)
+			if err == nil {
+				decrypted, err := cipher.Decrypt(decoded)
+				if err == nil {
+					value = string(decrypted)
+				}
+			}
+		}
+
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+func configItemTypes(config *kotsv1beta1.Config) map[string]string {
+	itemTypes := map[string]string{}
+	if config == nil {
+		return itemTypes
+	}
+
+	for _, group := range config.Spec.Groups {
+		for _, item := range group.Items {
+			itemTypes[item.Name] = item.Type
+		}
+	}
+
+	return itemTypes
+}
+
+// diffConfigValues compares two sets of plain config values, masking password items in the result
+func diffConfigValues(config *kotsv1beta1.Config, previous map[string]string, current map[string]string) []ConfigValueChange {
+	itemTypes := configItemTypes(config)
+	itemTitles := map[string]string{}
+	for _, group := range config.Spec.Groups {
+		for _, item := range group.Items {
+			itemTitles[item.Name] = item.Title
+		}
+	}
+
+	names := map[string]struct{}{}
+	for name := range previous {
+		names[name] = struct{}{}
+	}
+	for name := range current {
+		names[name] = struct{}{}
+	}
+
+	changes := []ConfigValueChange{}
+	for name := range names {
+		oldValue, newValue := previous[name], current[name]
+		if oldValue == newValue {
+			continue
+		}
+
+		if itemTypes[name] == "password" {
+			if oldValue != "" {
+				oldValue = PasswordMask
+			}
+			if newValue != "" {
+				newValue = PasswordMask
+			}
+		}
+
+		title := itemTitles[name]
+		if title == "" {
+			title = name
+		}
+
+		changes = append(changes, ConfigValueChange{
+			Name:     name,
+			Title:    title,
+			OldValue: oldValue,
+			NewValue: newValue,
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"encoding/base64"
+	"testing"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func historyTestConfig() *kotsv1beta1.Config {
+	return &kotsv1beta1.Config{
+		Spec: kotsv1beta1.ConfigSpec{
+			Groups: []kotsv1beta1.ConfigGroup{
+				{
+					Name: "database",
+					Items: []kotsv1beta1.ConfigItem{
+						{Name: "db_host", Title: "Database Host", Type: "text"},
+						{Name: "db_port", Type: "text"},
+						{Name: "db_password", Title: "Database Password", Type: "password"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func historyTestConfigValues(values map[string]kotsv1beta1.ConfigValue) *kotsv1beta1.ConfigValues {
+	return &kotsv1beta1.ConfigValues{
+		Spec: kotsv1beta1.ConfigValuesSpec{
+			Values: values,
+		},
+	}
+}
+
+func Test_diffConfigValues(t *testing.T) {
+	tests := []struct {
+		name            string
+		previous        map[string]string
+		current         map[string]string
+		expectedChanges []ConfigValueChange
+	}{
+		{
+			name:            "no changes",
+			previous:        map[string]string{"db_host": "postgres"},
+			current:         map[string]string{"db_host": "postgres"},
+			expectedChanges: []ConfigValueChange{},
+		},
+		{
+			name:     "changed, added and removed values",
+			previous: map[string]string{"db_host": "postgres", "db_port": "5432"},
+			current:  map[string]string{"db_host": "postgres.internal", "unknown": "value"},
+			expectedChanges: []ConfigValueChange{
+				{Name: "db_host", Title: "Database Host", OldValue: "postgres", NewValue: "postgres.internal"},
+				{Name: "db_port", Title: "db_port", OldValue: "5432", NewValue: ""},
+				{Name: "unknown", Title: "unknown", OldValue: "", NewValue: "value"},
+			},
+		},
+		{
+			name:     "changed password is masked",
+			previous: map[string]string{"db_password": "secret"},
+			current:  map[string]string{"db_password": "other secret"},
+			expectedChanges: []ConfigValueChange{
+				{Name: "db_password", Title: "Database Password", OldValue: PasswordMask, NewValue: PasswordMask},
+			},
+		},
+		{
+			name:     "added password is masked",
+			previous: map[string]string{},
+			current:  map[string]string{"db_password": "secret"},
+			expectedChanges: []ConfigValueChange{
+				{Name: "db_password", Title: "Database Password", OldValue: "", NewValue: PasswordMask},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			req.Equal(test.expectedChanges, diffConfigValues(historyTestConfig(), test.previous, test.current))
+		})
+	}
+}
+
+func Test_configHistory(t *testing.T) {
+	cipher, err := crypto.NewAESCipher()
+	require.NoError(t, err)
+	encrypted := base64.StdEncoding.EncodeToString(cipher.Encrypt([]byte("secret")))
+
+	tests := []struct {
+		name              string
+		versions          []configHistoryVersion
+		expectedSequences []int64
+		expectedChanges   [][]ConfigValueChange
+	}{
+		{
+			name: "newest first, unchanged versions skipped",
+			versions: []configHistoryVersion{
+				{Sequence: 0, Config: historyTestConfig(), ConfigValues: historyTestConfigValues(map[string]kotsv1beta1.ConfigValue{"db_host": {Value: "postgres"}})},
+				{Sequence: 1, Config: historyTestConfig(), ConfigValues: historyTestConfigValues(map[string]kotsv1beta1.ConfigValue{"db_host": {Value: "postgres"}})},
+				{Sequence: 2, Config: historyTestConfig(), ConfigValues: historyTestConfigValues(map[string]kotsv1beta1.ConfigValue{"db_host": {ValuePlaintext: "postgres.internal"}})},
+			},
+			expectedSequences: []int64{2, 0},
+			expectedChanges: [][]ConfigValueChange{
+				{{Name: "db_host", Title: "Database Host", OldValue: "postgres", NewValue: "postgres.internal"}},
+				{{Name: "db_host", Title: "Database Host", OldValue: "", NewValue: "postgres"}},
+			},
+		},
+		{
+			name: "version without a config spec keeps the previous values",
+			versions: []configHistoryVersion{
+				{Sequence: 0, Config: historyTestConfig(), ConfigValues: historyTestConfigValues(map[string]kotsv1beta1.ConfigValue{"db_host": {Value: "postgres"}, "db_port": {Value: "5432"}})},
+				{Sequence: 1},
+				{Sequence: 2, Config: historyTestConfig(), ConfigValues: historyTestConfigValues(map[string]kotsv1beta1.ConfigValue{"db_host": {Value: "postgres"}, "db_port": {Value: "5433"}})},
+			},
+			expectedSequences: []int64{2, 0},
+			expectedChanges: [][]ConfigValueChange{
+				{{Name: "db_port", Title: "db_port", OldValue: "5432", NewValue: "5433"}},
+				{
+					{Name: "db_host", Title: "Database Host", OldValue: "", NewValue: "postgres"},
+					{Name: "db_port", Title: "db_port", OldValue: "", NewValue: "5432"},
+				},
+			},
+		},
+		{
+			name: "version without an encryption key masks passwords",
+			versions: []configHistoryVersion{
+				{Sequence: 0, Config: historyTestConfig(), ConfigValues: historyTestConfigValues(map[string]kotsv1beta1.ConfigValue{"db_password": {Value: "c2VjcmV0"}})},
+				{Sequence: 1, Config: historyTestConfig(), ConfigValues: historyTestConfigValues(map[string]kotsv1beta1.ConfigValue{"db_password": {Value: encrypted}}), EncryptionKey: cipher.ToString()},
+			},
+			expectedSequences: []int64{1, 0},
+			expectedChanges: [][]ConfigValueChange{
+				{{Name: "db_password", Title: "Database Password", OldValue: PasswordMask, NewValue: PasswordMask}},
+				{{Name: "db_password", Title: "Database Password", OldValue: "", NewValue: PasswordMask}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			history, err := configHistory(test.versions)
+			req.NoError(err)
+
+			sequences := []int64{}
+			changes := [][]ConfigValueChange{}
+			for _, entry := range history {
+				sequences = append(sequences, entry.Sequence)
+				changes = append(changes, entry.Changes)
+			}
+			req.Equal(test.expectedSequences, sequences)
+			req.Equal(test.expectedChanges, changes)
+		})
+	}
+}
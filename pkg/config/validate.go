@@ -0,0 +1,378 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/replicatedhq/kotsadm/pkg/secretprovider"
+)
+
+// ValidationAnnotationPrefix is the prefix of the annotations on the Config spec that declare
+// validation rules. The remainder of the annotation key is the name of the config item, and the
+// value is a json encoded ValidationRule, for example:
+//
+//	validation.kots.io/hostname: '{"regex": "^[a-z0-9.-]+$", "maxLength": 253}'
+const ValidationAnnotationPrefix = "validation.kots.io/"
+
+type ValidationRule struct {
+	Regex     string   `json:"regex,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+
+	// Certificate requires the value to be one or more PEM encoded x509 certificates
+	Certificate bool `json:"certificate,omitempty"`
+	// PrivateKey requires the value to be a PEM encoded private key
+	PrivateKey bool `json:"privateKey,omitempty"`
+	// KeyPairWith is the name of another item that holds the private key matching the certificate in this item
+	KeyPairWith string `json:"keyPairWith,omitempty"`
+
+	// Message, when set, replaces the generated error message
+	Message string `json:"message,omitempty"`
+}
+
+type ItemValidationError struct {
+	Name    string `json:"name"`
+	Title   string `json:"title"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// GetValidationRules returns the validation rules declared on the config spec, keyed by item name
+func GetValidationRules(config *kotsv1beta1.Config) (map[string]ValidationRule, error) {
+	rules := map[string]ValidationRule{}
+	if config == nil {
+		return rules, nil
+	}
+
+	for key, value := range config.Annotations {
+		if !strings.HasPrefix(key, ValidationAnnotationPrefix) {
+			continue
+		}
+
+		itemName := strings.TrimPrefix(key, ValidationAnnotationPrefix)
+		rule := ValidationRule{}
+		if err := json.Unmarshal([]byte(value), &rule); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse validation rule for item %q", itemName)
+		}
+
+		if rule.Regex != "" {
+			if _, err := regexp.Compile(rule.Regex); err != nil {
+				return nil, errors.Wrapf(err, "failed to compile regex for item %q", itemName)
+			}
+		}
+
+		rules[itemName] = rule
+	}
+
+	return rules, nil
+}
+
+// ValidateConfig evaluates the validation rules declared on the config spec against values.
+// values are the plain text values keyed by item name. Empty values are not validated, that is
+// left to the required items check.
+func ValidateConfig(config *kotsv1beta1.Config, values map[string]string) ([]ItemValidationError, error) {
+	validationErrors := []ItemValidationError{}
+	if config == nil {
+		return validationErrors, nil
+	}
+
+	rules, err := GetValidationRules(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get validation rules")
+	}
+	if len(rules) == 0 {
+		return validationErrors, nil
+	}
+
+	items := map[string]kotsv1beta1.ConfigItem{}
+	for _, group := range config.Spec.Groups {
+		for _, item := range group.Items {
+			items[item.Name] = item
+		}
+	}
+
+	for _, group := range config.Spec.Groups {
+		for _, item := range group.Items {
+			rule, ok := rules[item.Name]
+			if !ok {
+				continue
+			}
+			if item.Hidden || item.When == "false" {
+				continue
+			}
+
+			value := itemValue(item, values[item.Name])
+			if value == "" {
+				continue
+			}
+			// references to external secrets are resolved at render time, the secret can't be validated here
+			if secretprovider.IsReference(value) {
+				continue
+			}
+
+			var keyPairValue string
+			if rule.KeyPairWith != "" {
+				keyItem, ok := items[rule.KeyPairWith]
+				if !ok {
+					return nil, errors.Errorf("item %q is paired with unknown item %q", item.Name, rule.KeyPairWith)
+				}
+				keyPairValue = itemValue(keyItem, values[keyItem.Name])
+			}
+
+			ruleName, message := validateItem(rule, value, keyPairValue)
+			if ruleName == "" {
+				continue
+			}
+
+			title := item.Title
+			if title == "" {
+				title = item.Name
+			}
+			if rule.Message != "" {
+				message = rule.Message
+			}
+
+			validationErrors = append(validationErrors, ItemValidationError{
+				Name:    item.Name,
+				Title:   title,
+				Rule:    ruleName,
+				Message: message,
+			})
+		}
+	}
+
+	return validationErrors, nil
+}
+
+// itemValue returns the plain text value of the item, file items are stored base64 encoded
+func itemValue(item kotsv1beta1.ConfigItem, value string) string {
+	if item.Type != "file" || value == "" {
+		return value
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	return string(decoded)
+}
+
+// validateItem returns the name of the first rule that failed along with a message describing the failure,
+// or an empty rule name if the value is valid
+func validateItem(rule ValidationRule, value string, keyPairValue string) (string, string) {
+	if rule.MinLength != nil && len(value) < *rule.MinLength {
+		return "minLength", fmt.Sprintf("must be at least %d characters", *rule.MinLength)
+	}
+	if rule.MaxLength != nil && len(value) > *rule.MaxLength {
+		return "maxLength", fmt.Sprintf("must be at most %d characters", *rule.MaxLength)
+	}
+
+	if rule.Regex != "" {
+		re := regexp.MustCompile(rule.Regex)
+		if !re.MatchString(value) {
+			return "regex", fmt.Sprintf("must match the pattern %s", rule.Regex)
+		}
+	}
+
+	if rule.Min != nil || rule.Max != nil {
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "range", "must be a number"
+		}
+		if rule.Min != nil && number < *rule.Min {
+			return "range", fmt.Sprintf("must be greater than or equal to %v", *rule.Min)
+		}
+		if rule.Max != nil && number > *rule.Max {
+			return "range", fmt.Sprintf("must be less than or equal to %v", *rule.Max)
+		}
+	}
+
+	if rule.Certificate {
+		if err := validateCertificate(value); err != nil {
+			return "certificate", err.Error()
+		}
+	}
+
+	if rule.PrivateKey {
+		if err := validatePrivateKey(value); err != nil {
+			return "privateKey", err.Error()
+		}
+	}
+
+	if rule.KeyPairWith != "" && keyPairValue != "" {
+		if _, err := tls.X509KeyPair([]byte(value), []byte(keyPairValue)); err != nil {
+			return "keyPair", "certificate does not match the private key"
+		}
+	}
+
+	return "", ""
+}
+
+func validateCertificate(value string) error {
+	rest := []byte(value)
+	numCerts := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return errors.Errorf("unexpected PEM block of type %q", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return errors.New("failed to parse certificate")
+		}
+		numCerts++
+	}
+
+	if numCerts == 0 {
+		return errors.New("not a PEM encoded certificate")
+	}
+
+	return nil
+}
+
+func validatePrivateKey(value string) error {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return errors.New("not a PEM encoded private key")
+	}
+
+	if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return nil
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return nil
+	}
+	if _, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return nil
+	}
+
+	return errors.New("failed to parse private key")
+}
+
+// ValidateConfigValues checks a complete set of config values, such as an imported ConfigValues document,
+// against the config spec. In addition to the declared validation rules, values for items that are not in
+// the spec and required items without a value or default are reported.
+func ValidateConfigValues(config *kotsv1beta1.Config, values map[string]string) ([]ItemValidationError, error) {
+	validationErrors := []ItemValidationError{}
+	if config == nil {
+		return validationErrors, nil
+	}
+
+	items := map[string]kotsv1beta1.ConfigItem{}
+	for _, group := range config.Spec.Groups {
+		for _, item := range group.Items {
+			items[item.Name] = item
+		}
+	}
+
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := items[name]; !ok {
+			validationErrors = append(validationErrors, ItemValidationError{
+				Name:    name,
+				Title:   name,
+				Rule:    "unknown",
+				Message: "is not an item in the config",
+			})
+		}
+	}
+
+	for _, group := range config.Spec.Groups {
+		for _, item := range group.Items {
+			if !IsRequiredItem(item) || !IsUnsetItem(item) || values[item.Name] != "" {
+				continue
+			}
+
+			title := item.Title
+			if title == "" {
+				title = item.Name
+			}
+			validationErrors = append(validationErrors, ItemValidationError{
+				Name:    item.Name,
+				Title:   title,
+				Rule:    "required",
+				Message: "is required",
+			})
+		}
+	}
+
+	ruleErrors, err := ValidateConfig(config, values)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate config")
+	}
+
+	return append(validationErrors, ruleErrors...), nil
+}
+
+// ValidateEncryptedPasswordValues checks that the value of every password item in a ConfigValues document,
+// such as an imported one, is encrypted with the installation key. Plain text passwords must be set with
+// valuePlaintext instead, a plain value would be stored as is and fail to decrypt at render time.
+func ValidateEncryptedPasswordValues(config *kotsv1beta1.Config, configValues *kotsv1beta1.ConfigValues, encryptionKey string) ([]ItemValidationError, error) {
+	validationErrors := []ItemValidationError{}
+	if config == nil || configValues == nil {
+		return validationErrors, nil
+	}
+
+	cipher, err := crypto.AESCipherFromString(encryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+
+	for _, group := range config.Spec.Groups {
+		for _, item := range group.Items {
+			if item.Type != "password" {
+				continue
+			}
+			configValue, ok := configValues.Spec.Values[item.Name]
+			if !ok || configValue.Value == "" {
+				continue
+			}
+
+			if isEncryptedWith(cipher, configValue.Value) {
+				continue
+			}
+
+			title := item.Title
+			if title == "" {
+				title = item.Name
+			}
+			validationErrors = append(validationErrors, ItemValidationError{
+				Name:    item.Name,
+				Title:   title,
+				Rule:    "encrypted",
+				Message: "is not encrypted with the installation key, use valuePlaintext for plain text passwords",
+			})
+		}
+	}
+
+	return validationErrors, nil
+}
+
+func isEncryptedWith(cipher *crypto.AESCipher, value string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return false
+	}
+	_, err = cipher.Decrypt(decoded)
+	return err == nil
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/kotskinds/multitype"
+	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_validateItem(t *testing.T) {
+	certPEM, keyPEM := generateKeyPair(t)
+	_, otherKeyPEM := generateKeyPair(t)
+
+	one := 1.0
+	max := 65535.0
+	three := 3
+	eight := 8
+
+	tests := []struct {
+		name         string
+		rule         ValidationRule
+		value        string
+		keyPairValue string
+		expectedRule string
+	}{
+		{
+			name:         "regex match",
+			rule:         ValidationRule{Regex: `^[a-z0-9.-]+$`},
+			value:        "registry.example.com",
+			expectedRule: "",
+		},
+		{
+			name:         "regex mismatch",
+			rule:         ValidationRule{Regex: `^[a-z0-9.-]+$`},
+			value:        "not a hostname",
+			expectedRule: "regex",
+		},
+		{
+			name:         "port in range",
+			rule:         ValidationRule{Min: &one, Max: &max},
+			value:        "8443",
+			expectedRule: "",
+		},
+		{
+			name:         "port out of range",
+			rule:         ValidationRule{Min: &one, Max: &max},
+			value:        "70000",
+			expectedRule: "range",
+		},
+		{
+			name:         "port not a number",
+			rule:         ValidationRule{Min: &one, Max: &max},
+			value:        "https",
+			expectedRule: "range",
+		},
+		{
+			name:         "too short",
+			rule:         ValidationRule{MinLength: &eight},
+			value:        "abc",
+			expectedRule: "minLength",
+		},
+		{
+			name:         "too long",
+			rule:         ValidationRule{MaxLength: &three},
+			value:        "abcd",
+			expectedRule: "maxLength",
+		},
+		{
+			name:         "valid certificate",
+			rule:         ValidationRule{Certificate: true},
+			value:        certPEM,
+			expectedRule: "",
+		},
+		{
+			name:         "malformed certificate",
+			rule:         ValidationRule{Certificate: true},
+			value:        "-----BEGIN CERTIFICATE-----\nnope\n-----END CERTIFICATE-----\n",
+			expectedRule: "certificate",
+		},
+		{
+			name:         "valid private key",
+			rule:         ValidationRule{PrivateKey: true},
+			value:        keyPEM,
+			expectedRule: "",
+		},
+		{
+			name:         "certificate is not a private key",
+			rule:         ValidationRule{PrivateKey: true},
+			value:        certPEM,
+			expectedRule: "privateKey",
+		},
+		{
+			name:         "matching key pair",
+			rule:         ValidationRule{Certificate: true, KeyPairWith: "tls_key"},
+			value:        certPEM,
+			keyPairValue: keyPEM,
+			expectedRule: "",
+		},
+		{
+			name:         "mismatched key pair",
+			rule:         ValidationRule{Certificate: true, KeyPairWith: "tls_key"},
+			value:        certPEM,
+			keyPairValue: otherKeyPEM,
+			expectedRule: "keyPair",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			rule, _ := validateItem(test.rule, test.value, test.keyPairValue)
+			req.Equal(test.expectedRule, rule)
+		})
+	}
+}
+
+func generateKeyPair(t *testing.T) (string, string) {
+	req := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req.NoError(err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kotsadm.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	req.NoError(err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	req.NoError(err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return string(certPEM), string(keyPEM)
+}
+
+func Test_ValidateConfigValues(t *testing.T) {
+	config := &kotsv1beta1.Config{
+		Spec: kotsv1beta1.ConfigSpec{
+			Groups: []kotsv1beta1.ConfigGroup{
+				{
+					Name: "database",
+					Items: []kotsv1beta1.ConfigItem{
+						{Name: "db_host", Title: "Database Host", Required: true},
+						{Name: "db_port", Required: true, Default: multitype.BoolOrString{Type: multitype.String, StrVal: "5432"}},
+						{Name: "db_password", Type: "password", Required: true, Hidden: true},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		values        map[string]string
+		expectedRules map[string]string
+	}{
+		{
+			name:          "complete",
+			values:        map[string]string{"db_host": "postgres"},
+			expectedRules: map[string]string{},
+		},
+		{
+			name:          "missing required item",
+			values:        map[string]string{"db_port": "5433"},
+			expectedRules: map[string]string{"db_host": "required"},
+		},
+		{
+			name:          "unknown item",
+			values:        map[string]string{"db_host": "postgres", "db_name": "app"},
+			expectedRules: map[string]string{"db_name": "unknown"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			validationErrors, err := ValidateConfigValues(config, test.values)
+			req.NoError(err)
+
+			rules := map[string]string{}
+			for _, validationError := range validationErrors {
+				rules[validationError.Name] = validationError.Rule
+			}
+			req.Equal(test.expectedRules, rules)
+		})
+	}
+}
+
+func Test_ValidateEncryptedPasswordValues(t *testing.T) {
+	cipher, err := crypto.NewAESCipher()
+	require.NoError(t, err)
+	otherCipher, err := crypto.NewAESCipher()
+	require.NoError(t, err)
+
+	config := &kotsv1beta1.Config{
+		Spec: kotsv1beta1.ConfigSpec{
+			Groups: []kotsv1beta1.ConfigGroup{
+				{
+					Name: "database",
+					Items: []kotsv1beta1.ConfigItem{
+						{Name: "db_host", Type: "text"},
+						{Name: "db_password", Title: "Database Password", Type: "password"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		value         kotsv1beta1.ConfigValue
+		expectedRules map[string]string
+	}{
+		{
+			name:          "encrypted with the installation key",
+			value:         kotsv1beta1.ConfigValue{Value: base64.StdEncoding.EncodeToString(cipher.Encrypt([]byte("secret")))},
+			expectedRules: map[string]string{},
+		},
+		{
+			name:          "plain text with valuePlaintext",
+			value:         kotsv1beta1.ConfigValue{ValuePlaintext: "secret"},
+			expectedRules: map[string]string{},
+		},
+		{
+			name:          "plain text with value",
+			value:         kotsv1beta1.ConfigValue{Value: "secret"},
+			expectedRules: map[string]string{"db_password": "encrypted"},
+		},
+		{
+			name:          "encrypted with another key",
+			value:         kotsv1beta1.ConfigValue{Value: base64.StdEncoding.EncodeToString(otherCipher.Encrypt([]byte("secret")))},
+			expectedRules: map[string]string{"db_password": "encrypted"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			configValues := &kotsv1beta1.ConfigValues{
+				Spec: kotsv1beta1.ConfigValuesSpec{
+					Values: map[string]kotsv1beta1.ConfigValue{
+						"db_host":     {Value: "postgres"},
+						"db_password": test.value,
+					},
+				},
+			}
+
+			validationErrors, err := ValidateEncryptedPasswordValues(config, configValues, cipher.ToString())
+			req.NoError(err)
+
+			rules := map[string]string{}
+			for _, validationError := range validationErrors {
+				rules[validationError.Name] = validationError.Rule
+			}
+			req.Equal(test.expectedRules, rules)
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/marccampbell/yaml-toolbox/pkg/splitter"
 	"github.com/pkg/errors"
@@ -109,3 +111,95 @@ func DiffAppVersionsForDownstream(downstreamName string, archive string, diffBas
 
 	return &diff, nil
 }
+
+type FileDiff struct {
+	Filename     string `json:"filename"`
+	Status       string `json:"status"`
+	LinesAdded   int    `json:"linesAdded"`
+	LinesRemoved int    `json:"linesRemoved"`
+	Patch        string `json:"patch"`
+}
+
+// DiffFiles compares two sets of rendered files, returning a line diff for each file that was added,
+// removed or modified. Lines in the patch are prefixed with "+", "-" or " "
+func DiffFiles(updatedFiles map[string][]byte, baseFiles map[string][]byte) []FileDiff {
+	fileDiffs := []FileDiff{}
+
+	for filename, updatedContents := range updatedFiles {
+		baseContents, ok := baseFiles[filename]
+		if !ok {
+			fileDiff := diffFile(filename, "", string(updatedContents))
+			fileDiff.Status = "added"
+			fileDiffs = append(fileDiffs, fileDiff)
+			continue
+		}
+
+		if bytes.Equal(updatedContents, baseContents) {
+			continue
+		}
+
+		fileDiff := diffFile(filename, string(baseContents), string(updatedContents))
+		fileDiff.Status = "modified"
+		fileDiffs = append(fileDiffs, fileDiff)
+	}
+
+	for filename, baseContents := range baseFiles {
+		if _, ok := updatedFiles[filename]; ok {
+			continue
+		}
+
+		fileDiff := diffFile(filename, string(baseContents), "")
+		fileDiff.Status = "removed"
+		fileDiffs = append(fileDiffs, fileDiff)
+	}
+
+	sort.Slice(fileDiffs, func(i, j int) bool {
+		return fileDiffs[i].Filename < fileDiffs[j].Filename
+	})
+
+	return fileDiffs
+}
+
+func diffFile(filename string, baseContent string, updatedContent string) FileDiff {
+	dmp := diffmatchpatch.New()
+
+	charsA, charsB, lines := dmp.DiffLinesToChars(baseContent, updatedContent)
+
+	diffs := dmp.DiffMain(charsA, charsB, false)
+	diffs = dmp.DiffCharsToLines(diffs, lines)
+
+	fileDiff := FileDiff{
+		Filename: filename,
+	}
+
+	var patch strings.Builder
+	for _, diff := range diffs {
+		prefix := " "
+		if diff.Type == diffmatchpatch.DiffDelete {
+			prefix = "-"
+		} else if diff.Type == diffmatchpatch.DiffInsert {
+			prefix = "+"
+		}
+
+		for _, line := range strings.SplitAfter(diff.Text, "\n") {
+			if line == "" {
+				continue
+			}
+
+			if diff.Type == diffmatchpatch.DiffDelete {
+				fileDiff.LinesRemoved++
+			} else if diff.Type == diffmatchpatch.DiffInsert {
+				fileDiff.LinesAdded++
+			}
+
+			patch.WriteString(prefix)
+			patch.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				patch.WriteString("\n")
+			}
+		}
+	}
+	fileDiff.Patch = patch.String()
+
+	return fileDiff
+}
@@ -59,3 +59,63 @@ func Test_diffContent(t *testing.T) {
 		})
 	}
 }
+
+func Test_DiffFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		updatedFiles  map[string][]byte
+		baseFiles     map[string][]byte
+		expectedDiffs []FileDiff
+	}{
+		{
+			name: "identical",
+			updatedFiles: map[string][]byte{
+				"deployment.yaml": []byte("replicas: 1\n"),
+			},
+			baseFiles: map[string][]byte{
+				"deployment.yaml": []byte("replicas: 1\n"),
+			},
+			expectedDiffs: []FileDiff{},
+		},
+		{
+			name: "added, modified and removed",
+			updatedFiles: map[string][]byte{
+				"configmap.yaml":  []byte("data: a\n"),
+				"deployment.yaml": []byte("kind: Deployment\nreplicas: 2\n"),
+			},
+			baseFiles: map[string][]byte{
+				"deployment.yaml": []byte("kind: Deployment\nreplicas: 1\n"),
+				"service.yaml":    []byte("kind: Service\n"),
+			},
+			expectedDiffs: []FileDiff{
+				{
+					Filename:   "configmap.yaml",
+					Status:     "added",
+					LinesAdded: 1,
+					Patch:      "+data: a\n",
+				},
+				{
+					Filename:     "deployment.yaml",
+					Status:       "modified",
+					LinesAdded:   1,
+					LinesRemoved: 1,
+					Patch:        " kind: Deployment\n-replicas: 1\n+replicas: 2\n",
+				},
+				{
+					Filename:     "service.yaml",
+					Status:       "removed",
+					LinesRemoved: 1,
+					Patch:        "-kind: Service\n",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			actualDiffs := DiffFiles(test.updatedFiles, test.baseFiles)
+			req.Equal(test.expectedDiffs, actualDiffs)
+		})
+	}
+}
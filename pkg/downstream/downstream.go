@@ -2,6 +2,7 @@ package downstream
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/kotsadm/pkg/downstream/types"
@@ -105,3 +106,53 @@ func SetIgnorePreflightPermissionErrors(appID string, sequence int64) error {
 
 	return nil
 }
+
+// DeployVersion sets the sequence as the current sequence of the app's downstreams, and marks the version as deployed.
+// The operator picks up the new current sequence and applies it
+func DeployVersion(appID string, sequence int64) error {
+	db := persistence.MustGetPGSession()
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin")
+	}
+	defer tx.Rollback()
+
+	if err := DeployVersionTx(tx, appID, sequence); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit")
+	}
+
+	return nil
+}
+
+// DeployVersionTx deploys the sequence as part of tx, so that other changes can be committed along with the deploy
+func DeployVersionTx(tx *sql.Tx, appID string, sequence int64) error {
+	query := `update app_downstream set current_sequence = $1 where app_id = $2`
+	if _, err := tx.Exec(query, sequence, appID); err != nil {
+		return errors.Wrap(err, "failed to update downstream current sequence")
+	}
+
+	query = `update app_downstream_version set status = 'deployed', applied_at = $3 where sequence = $1 and app_id = $2`
+	if _, err := tx.Exec(query, sequence, appID, time.Now()); err != nil {
+		return errors.Wrap(err, "failed to set downstream version deployed")
+	}
+
+	return nil
+}
+
+// GetPreflightResult returns the stored preflight result of a downstream version, or an empty string if preflights have not completed
+func GetPreflightResult(appID string, sequence int64) (string, error) {
+	db := persistence.MustGetPGSession()
+	query := `select preflight_result from app_downstream_version where app_id = $1 and sequence = $2`
+	row := db.QueryRow(query, appID, sequence)
+
+	var preflightResult sql.NullString
+	if err := row.Scan(&preflightResult); err != nil {
+		return "", errors.Wrap(err, "failed to scan preflight result")
+	}
+
+	return preflightResult.String, nil
+}
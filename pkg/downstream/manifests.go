@@ -0,0 +1,46 @@
+package downstream
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/marccampbell/yaml-toolbox/pkg/splitter"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+)
+
+// BuildManifests runs kustomize on the downstream overlay in archiveDir and returns the rendered
+// manifests split into files. When downstreamName is empty, the midstream is built instead
+func BuildManifests(archiveDir string, downstreamName string, kustomizeVersion string) (map[string][]byte, error) {
+	output, err := KustomizeBuild(archiveDir, downstreamName, kustomizeVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := splitter.SplitYAML(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to split yaml")
+	}
+
+	return files, nil
+}
+
+// KustomizeBuild runs kustomize on the downstream overlay in archiveDir and returns the rendered
+// manifests as a single yaml stream. When downstreamName is empty, the midstream is built instead
+func KustomizeBuild(archiveDir string, downstreamName string, kustomizeVersion string) ([]byte, error) {
+	kustomizeBuildTarget := filepath.Join(archiveDir, "overlays", "midstream")
+	if downstreamName != "" {
+		kustomizeBuildTarget = filepath.Join(archiveDir, "overlays", "downstreams", downstreamName)
+	}
+
+	output, err := exec.Command(fmt.Sprintf("kustomize%s", kustomizeVersion), "build", kustomizeBuildTarget).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			logger.Errorf("kustomize stderr: %q", string(ee.Stderr))
+		}
+		return nil, errors.Wrap(err, "failed to run kustomize")
+	}
+
+	return output, nil
+}
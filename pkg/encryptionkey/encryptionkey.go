@@ -0,0 +1,83 @@
+package encryptionkey
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/crypto"
+)
+
+const (
+	// CurrentKeyEnv holds the key that everything is encrypted with
+	CurrentKeyEnv = "API_ENCRYPTION_KEY"
+	// PreviousKeyEnv holds the key that is being rotated away from. While it's set, values that were
+	// encrypted with it can still be read, until the rotation has re-encrypted them
+	PreviousKeyEnv = "API_ENCRYPTION_KEY_PREVIOUS"
+)
+
+// Encrypt encrypts plaintext with the current key and returns it base64 encoded
+func Encrypt(plaintext []byte) (string, error) {
+	cipher, err := crypto.AESCipherFromString(os.Getenv(CurrentKeyEnv))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create aes cipher")
+	}
+
+	return base64.StdEncoding.EncodeToString(cipher.Encrypt(plaintext)), nil
+}
+
+// Decrypt decrypts a base64 encoded value with the current key, falling back to the previous key
+// during a rotation
+func Decrypt(encoded string) ([]byte, error) {
+	decrypted, err := decryptWithKey(os.Getenv(CurrentKeyEnv), encoded)
+	if err == nil {
+		return decrypted, nil
+	}
+
+	previousKey := os.Getenv(PreviousKeyEnv)
+	if previousKey == "" {
+		return nil, err
+	}
+
+	decrypted, previousErr := decryptWithKey(previousKey, encoded)
+	if previousErr != nil {
+		return nil, err
+	}
+
+	return decrypted, nil
+}
+
+func decryptWithKey(key string, encoded string) ([]byte, error) {
+	cipher, err := crypto.AESCipherFromString(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create aes cipher")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode")
+	}
+
+	decrypted, err := cipher.Decrypt(decoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt")
+	}
+
+	return decrypted, nil
+}
+
+func encryptWithKey(key string, plaintext []byte) (string, error) {
+	cipher, err := crypto.AESCipherFromString(key)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create aes cipher")
+	}
+
+	return base64.StdEncoding.EncodeToString(cipher.Encrypt(plaintext)), nil
+}
+
+// KeyDigest identifies a key without storing it
+func KeyDigest(key string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+}
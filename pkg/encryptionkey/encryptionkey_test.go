@@ -0,0 +1,52 @@
+package encryptionkey
+
+import (
+	"os"
+	"testing"
+
+	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_DecryptDuringRotation(t *testing.T) {
+	req := require.New(t)
+
+	oldCipher, err := crypto.NewAESCipher()
+	req.NoError(err)
+	newCipher, err := crypto.NewAESCipher()
+	req.NoError(err)
+	oldKey, newKey := oldCipher.ToString(), newCipher.ToString()
+
+	defer os.Setenv(CurrentKeyEnv, os.Getenv(CurrentKeyEnv))
+	defer os.Setenv(PreviousKeyEnv, os.Getenv(PreviousKeyEnv))
+
+	os.Setenv(CurrentKeyEnv, oldKey)
+	os.Setenv(PreviousKeyEnv, "")
+	encrypted, err := Encrypt([]byte("hunter2"))
+	req.NoError(err)
+
+	// the new key is in place, but the value has not been re-encrypted yet
+	os.Setenv(CurrentKeyEnv, newKey)
+	_, err = Decrypt(encrypted)
+	req.Error(err)
+
+	os.Setenv(PreviousKeyEnv, oldKey)
+	decrypted, err := Decrypt(encrypted)
+	req.NoError(err)
+	req.Equal("hunter2", string(decrypted))
+
+	reencrypted, changed, err := reencrypt(encrypted, oldKey, newKey)
+	req.NoError(err)
+	req.True(changed)
+
+	os.Setenv(PreviousKeyEnv, "")
+	decrypted, err = Decrypt(reencrypted)
+	req.NoError(err)
+	req.Equal("hunter2", string(decrypted))
+
+	// running the rotation again leaves values that use the new key alone
+	_, changed, err = reencrypt(reencrypted, oldKey, newKey)
+	req.NoError(err)
+	req.False(changed)
+}
@@ -0,0 +1,285 @@
+package encryptionkey
+
+import (
+	"database/sql"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/k8s"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	corev1 "k8s.io/api/core/v1"
+	kuberneteserrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var gitOpsPrivateKeyRegex = regexp.MustCompile(`^provider\.\d+\.privateKey$`)
+
+type KeyVersion struct {
+	Version           int64      `json:"version"`
+	KeyDigest         string     `json:"keyDigest"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	RetiredAt         *time.Time `json:"retiredAt,omitempty"`
+	RegistryPasswords int        `json:"registryPasswords"`
+	GitOpsPrivateKeys int        `json:"gitopsPrivateKeys"`
+}
+
+type RotationResult struct {
+	Version           int64 `json:"version"`
+	RegistryPasswords int   `json:"registryPasswords"`
+	GitOpsPrivateKeys int   `json:"gitopsPrivateKeys"`
+}
+
+// ListKeyVersions returns every key that has been used, newest first
+func ListKeyVersions() ([]KeyVersion, error) {
+	db := persistence.MustGetPGSession()
+	query := `select version, key_digest, created_at, retired_at, registry_passwords, gitops_private_keys from api_encryption_key order by version desc`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query key versions")
+	}
+	defer rows.Close()
+
+	keyVersions := []KeyVersion{}
+	for rows.Next() {
+		keyVersion := KeyVersion{}
+		var retiredAt sql.NullTime
+		var registryPasswords sql.NullInt64
+		var gitOpsPrivateKeys sql.NullInt64
+		if err := rows.Scan(&keyVersion.Version, &keyVersion.KeyDigest, &keyVersion.CreatedAt, &retiredAt, &registryPasswords, &gitOpsPrivateKeys); err != nil {
+			return nil, errors.Wrap(err, "failed to scan key version")
+		}
+		if retiredAt.Valid {
+			keyVersion.RetiredAt = &retiredAt.Time
+		}
+		keyVersion.RegistryPasswords = int(registryPasswords.Int64)
+		keyVersion.GitOpsPrivateKeys = int(gitOpsPrivateKeys.Int64)
+
+		keyVersions = append(keyVersions, keyVersion)
+	}
+
+	return keyVersions, nil
+}
+
+// Rotate decrypts every value that is encrypted with oldKey and encrypts it with newKey. The database is
+// updated in a single transaction, and the gitops secret is put back if that transaction fails to commit.
+// Values that are already encrypted with newKey are left alone, so an interrupted rotation can be run again.
+// Once this returns, API_ENCRYPTION_KEY should be set to newKey and API_ENCRYPTION_KEY_PREVIOUS can be removed.
+func Rotate(oldKey string, newKey string) (*RotationResult, error) {
+	if oldKey == "" || newKey == "" {
+		return nil, errors.New("both the old and the new key are required")
+	}
+	if oldKey == newKey {
+		return nil, errors.New("the new key is the same as the old key")
+	}
+	if _, err := encryptWithKey(newKey, []byte{}); err != nil {
+		return nil, errors.Wrap(err, "new key is not valid")
+	}
+	if _, err := encryptWithKey(oldKey, []byte{}); err != nil {
+		return nil, errors.Wrap(err, "old key is not valid")
+	}
+
+	db := persistence.MustGetPGSession()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	latestVersion, latestDigest, err := getLatestKeyVersion(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get latest key version")
+	}
+	if latestDigest != "" && latestDigest != KeyDigest(oldKey) && latestDigest != KeyDigest(newKey) {
+		return nil, errors.Errorf("the old key does not match key version %d", latestVersion)
+	}
+
+	result := RotationResult{}
+
+	registryPasswords, err := rotateRegistryPasswords(tx, oldKey, newKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to rotate registry passwords")
+	}
+	result.RegistryPasswords = registryPasswords
+
+	clientset, err := k8s.Clientset()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create clientset")
+	}
+
+	originalGitOpsSecret, gitOpsPrivateKeys, err := rotateGitOpsPrivateKeys(clientset, oldKey, newKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to rotate gitops private keys")
+	}
+	result.GitOpsPrivateKeys = gitOpsPrivateKeys
+
+	restoreGitOpsSecret := func() {
+		if originalGitOpsSecret == nil {
+			return
+		}
+		current, err := clientset.CoreV1().Secrets(originalGitOpsSecret.Namespace).Get(originalGitOpsSecret.Name, metav1.GetOptions{})
+		if err != nil {
+			logger.Error(errors.Wrap(err, "failed to get gitops secret to restore"))
+			return
+		}
+		current.Data = originalGitOpsSecret.Data
+		if _, err := clientset.CoreV1().Secrets(current.Namespace).Update(current); err != nil {
+			logger.Error(errors.Wrap(err, "failed to restore gitops secret"))
+		}
+	}
+
+	now := time.Now()
+	if latestDigest == KeyDigest(newKey) {
+		// a previous rotation to this key was interrupted, or is being run again
+		result.Version = latestVersion
+		query := `update api_encryption_key set registry_passwords = registry_passwords + $1, gitops_private_keys = gitops_private_keys + $2 where version = $3`
+		if _, err := tx.Exec(query, result.RegistryPasswords, result.GitOpsPrivateKeys, latestVersion); err != nil {
+			restoreGitOpsSecret()
+			return nil, errors.Wrap(err, "failed to update key version")
+		}
+	} else {
+		if latestDigest == "" {
+			// the first rotation records the key that was used until now
+			latestVersion = 1
+			query := `insert into api_encryption_key (version, key_digest, created_at, registry_passwords, gitops_private_keys) values ($1, $2, $3, 0, 0)`
+			if _, err := tx.Exec(query, latestVersion, KeyDigest(oldKey), now); err != nil {
+				restoreGitOpsSecret()
+				return nil, errors.Wrap(err, "failed to record old key version")
+			}
+		}
+
+		query := `update api_encryption_key set retired_at = $1 where retired_at is null`
+		if _, err := tx.Exec(query, now); err != nil {
+			restoreGitOpsSecret()
+			return nil, errors.Wrap(err, "failed to retire old key version")
+		}
+
+		result.Version = latestVersion + 1
+		query = `insert into api_encryption_key (version, key_digest, created_at, registry_passwords, gitops_private_keys) values ($1, $2, $3, $4, $5)`
+		if _, err := tx.Exec(query, result.Version, KeyDigest(newKey), now, result.RegistryPasswords, result.GitOpsPrivateKeys); err != nil {
+			restoreGitOpsSecret()
+			return nil, errors.Wrap(err, "failed to record new key version")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		restoreGitOpsSecret()
+		return nil, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return &result, nil
+}
+
+func getLatestKeyVersion(tx *sql.Tx) (int64, string, error) {
+	query := `select version, key_digest from api_encryption_key order by version desc limit 1`
+	row := tx.QueryRow(query)
+
+	var version int64
+	var keyDigest string
+	if err := row.Scan(&version, &keyDigest); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, "", nil
+		}
+		return 0, "", errors.Wrap(err, "failed to scan key version")
+	}
+
+	return version, keyDigest, nil
+}
+
+func rotateRegistryPasswords(tx *sql.Tx, oldKey string, newKey string) (int, error) {
+	query := `select id, registry_password_enc from app where registry_password_enc is not null and registry_password_enc != '' for update`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to query apps")
+	}
+
+	updated := map[string]string{}
+	for rows.Next() {
+		var appID string
+		var passwordEnc string
+		if err := rows.Scan(&appID, &passwordEnc); err != nil {
+			rows.Close()
+			return 0, errors.Wrap(err, "failed to scan app")
+		}
+
+		reencrypted, changed, err := reencrypt(passwordEnc, oldKey, newKey)
+		if err != nil {
+			rows.Close()
+			return 0, errors.Wrapf(err, "failed to re-encrypt registry password for app %s", appID)
+		}
+		if changed {
+			updated[appID] = reencrypted
+		}
+	}
+	rows.Close()
+
+	for appID, passwordEnc := range updated {
+		query := `update app set registry_password_enc = $1 where id = $2`
+		if _, err := tx.Exec(query, passwordEnc, appID); err != nil {
+			return 0, errors.Wrapf(err, "failed to update registry password for app %s", appID)
+		}
+	}
+
+	return len(updated), nil
+}
+
+// rotateGitOpsPrivateKeys re-encrypts the deploy keys in the kotsadm-gitops secret and returns the secret
+// as it was before, so that it can be restored
+func rotateGitOpsPrivateKeys(clientset kubernetes.Interface, oldKey string, newKey string) (*corev1.Secret, int, error) {
+	secret, err := clientset.CoreV1().Secrets(os.Getenv("POD_NAMESPACE")).Get("kotsadm-gitops", metav1.GetOptions{})
+	if kuberneteserrors.IsNotFound(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get gitops secret")
+	}
+
+	original := secret.DeepCopy()
+
+	updated := 0
+	for key, value := range secret.Data {
+		if !gitOpsPrivateKeyRegex.MatchString(key) {
+			continue
+		}
+
+		reencrypted, changed, err := reencrypt(string(value), oldKey, newKey)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to re-encrypt %s", key)
+		}
+		if changed {
+			secret.Data[key] = []byte(reencrypted)
+			updated++
+		}
+	}
+
+	if updated == 0 {
+		return nil, 0, nil
+	}
+
+	if _, err := clientset.CoreV1().Secrets(secret.Namespace).Update(secret); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to update gitops secret")
+	}
+
+	return original, updated, nil
+}
+
+// reencrypt returns encoded encrypted with newKey, and false if it already was
+func reencrypt(encoded string, oldKey string, newKey string) (string, bool, error) {
+	decrypted, err := decryptWithKey(oldKey, encoded)
+	if err != nil {
+		if _, newErr := decryptWithKey(newKey, encoded); newErr == nil {
+			return encoded, false, nil
+		}
+		return "", false, err
+	}
+
+	reencrypted, err := encryptWithKey(newKey, decrypted)
+	if err != nil {
+		return "", false, err
+	}
+
+	return reencrypted, true, nil
+}
@@ -13,7 +13,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
 	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
 	"github.com/replicatedhq/kotsadm/pkg/logger"
 	"golang.org/x/crypto/ssh"
@@ -129,16 +129,7 @@ func GetDownstreamGitOps(appID string, clusterID string) (*GitOpsConfig, error)
 				}
 				provider, publicKey, privateKey, repoURI, err := gitOpsConfigFromSecretData(idx, secret.Data)
 
-				cipher, err := crypto.AESCipherFromString(os.Getenv("API_ENCRYPTION_KEY"))
-				if err != nil {
-					return nil, errors.Wrap(err, "failed to create aes cipher")
-				}
-				decodedPrivateKey, err := base64.StdEncoding.DecodeString(privateKey)
-				if err != nil {
-					return nil, errors.Wrap(err, "failed to decode")
-				}
-
-				decryptedPrivateKey, err := cipher.Decrypt([]byte(decodedPrivateKey))
+				decryptedPrivateKey, err := encryptionkey.Decrypt(privateKey)
 				if err != nil {
 					return nil, errors.Wrap(err, "failed to decrypt")
 				}
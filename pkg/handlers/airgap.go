@@ -1,16 +1,16 @@
 package handlers
 
 import (
-	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
 
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/kotsadm/pkg/airgap"
 	"github.com/replicatedhq/kotsadm/pkg/app"
 	"github.com/replicatedhq/kotsadm/pkg/logger"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"github.com/replicatedhq/kotsadm/pkg/registry"
 )
 
 type CreateAppFromAirgapRequest struct {
@@ -45,6 +45,12 @@ func UploadAirgapBundle(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateAppFromAirgap(w http.ResponseWriter, r *http.Request) {
+	allowUnsigned := r.FormValue("allowUnsigned") == "true"
+	if allowUnsigned && !isConsoleSession(r) {
+		w.WriteHeader(403)
+		return
+	}
+
 	a, err := app.Get(r.FormValue("appId"))
 	if err != nil {
 		logger.Error(err)
@@ -52,7 +58,7 @@ func updateAppFromAirgap(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	airgapBundle, _, err := r.FormFile("file")
+	airgapBundle, err := saveAirgapBundle(r)
 	if err != nil {
 		logger.Error(err)
 		w.WriteHeader(500)
@@ -60,8 +66,8 @@ func updateAppFromAirgap(w http.ResponseWriter, r *http.Request) {
 	}
 
 	go func() {
-		defer airgapBundle.Close()
-		if err := airgap.UpdateAppFromAirgap(a, airgapBundle); err != nil {
+		defer os.Remove(airgapBundle)
+		if err := airgap.UpdateAppFromAirgap(a, airgapBundle, allowUnsigned); err != nil {
 			logger.Error(err)
 		}
 	}()
@@ -72,6 +78,12 @@ func updateAppFromAirgap(w http.ResponseWriter, r *http.Request) {
 }
 
 func createAppFromAirgap(w http.ResponseWriter, r *http.Request) {
+	allowUnsigned := r.FormValue("allowUnsigned") == "true"
+	if allowUnsigned && !isConsoleSession(r) {
+		w.WriteHeader(403)
+		return
+	}
+
 	pendingApp, err := airgap.GetPendingAirgapUploadApp()
 	if err != nil {
 		logger.Error(err)
@@ -79,25 +91,14 @@ func createAppFromAirgap(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var registryHost, namespace, username, password string
-	registryHost, username, password, err = getKurlRegistryCreds()
+	registryHost, namespace, username, password, err := airgapRegistryOptions(pendingApp, r.FormValue("registryHost"), r.FormValue("namespace"), r.FormValue("username"), r.FormValue("password"))
 	if err != nil {
 		logger.Error(err)
 		w.WriteHeader(500)
 		return
 	}
 
-	// if found kurl registry creds, use kurl registry
-	if registryHost != "" {
-		namespace = pendingApp.Slug
-	} else {
-		registryHost = r.FormValue("registryHost")
-		namespace = r.FormValue("namespace")
-		username = r.FormValue("username")
-		password = r.FormValue("password")
-	}
-
-	airgapBundle, _, err := r.FormFile("file")
+	airgapBundle, err := saveAirgapBundle(r)
 	if err != nil {
 		logger.Error(err)
 		w.WriteHeader(500)
@@ -105,8 +106,8 @@ func createAppFromAirgap(w http.ResponseWriter, r *http.Request) {
 	}
 
 	go func() {
-		defer airgapBundle.Close()
-		if err := airgap.CreateAppFromAirgap(pendingApp, airgapBundle, registryHost, namespace, username, password); err != nil {
+		defer os.Remove(airgapBundle)
+		if err := airgap.CreateAppFromAirgap(pendingApp, airgapBundle, registryHost, namespace, username, password, allowUnsigned); err != nil {
 			logger.Error(err)
 		}
 	}()
@@ -116,52 +117,40 @@ func createAppFromAirgap(w http.ResponseWriter, r *http.Request) {
 	JSON(w, 202, createAppFromAirgapResponse)
 }
 
-func getKurlRegistryCreds() (hostname string, username string, password string, finalErr error) {
-	cfg, err := config.GetConfig()
+// saveAirgapBundle copies the bundle in the multipart form to a temp file, and returns its path
+func saveAirgapBundle(r *http.Request) (string, error) {
+	formFile, _, err := r.FormFile("file")
 	if err != nil {
-		finalErr = errors.Wrap(err, "failed to get cluster config")
-		return
+		return "", errors.Wrap(err, "failed to get file from form")
 	}
+	defer formFile.Close()
 
-	clientset, err := kubernetes.NewForConfig(cfg)
+	tmpFile, err := ioutil.TempFile("", "kotsadm")
 	if err != nil {
-		finalErr = errors.Wrap(err, "failed to create kubernetes clientset")
-		return
+		return "", errors.Wrap(err, "failed to create temp file")
 	}
+	defer tmpFile.Close()
 
-	// kURL registry secret is always in default namespace
-	secret, err := clientset.CoreV1().Secrets("default").Get("registry-creds", metav1.GetOptions{})
-	if err != nil {
-		return
-	}
-
-	dockerJson, ok := secret.Data[".dockerconfigjson"]
-	if !ok {
-		return
+	if _, err := io.Copy(tmpFile, formFile); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", errors.Wrap(err, "failed to copy temp airgap")
 	}
 
-	type dockerRegistryAuth struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Auth     string `json:"auth"`
-	}
-	dockerConfig := struct {
-		Auths map[string]dockerRegistryAuth `json:"auths"`
-	}{}
+	return tmpFile.Name(), nil
+}
 
-	err = json.Unmarshal(dockerJson, &dockerConfig)
+// airgapRegistryOptions returns the registry that images are pushed to when installing the pending app.
+// The kurl registry is used when there is one
+func airgapRegistryOptions(pendingApp *airgap.PendingApp, registryHost string, namespace string, username string, password string) (string, string, string, string, error) {
+	kurlHost, kurlUsername, kurlPassword, err := registry.GetKurlRegistryCreds()
 	if err != nil {
-		return
+		return "", "", "", "", errors.Wrap(err, "failed to get kurl registry creds")
 	}
 
-	for host, auth := range dockerConfig.Auths {
-		if auth.Username == "kurl" {
-			hostname = host
-			username = auth.Username
-			password = auth.Password
-			return
-		}
+	// if found kurl registry creds, use kurl registry
+	if kurlHost != "" {
+		return kurlHost, pendingApp.Slug, kurlUsername, kurlPassword, nil
 	}
 
-	return
+	return registryHost, namespace, username, password, nil
 }
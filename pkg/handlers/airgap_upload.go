@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/airgap"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+)
+
+type CreateAirgapUploadRequest struct {
+	// AppID is the app to update, or empty to install the pending app
+	AppID    string `json:"appId"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+type AirgapUploadResponse struct {
+	Success       bool                  `json:"success"`
+	Error         string                `json:"error,omitempty"`
+	UploadSession *airgap.UploadSession `json:"uploadSession,omitempty"`
+}
+
+type UploadAirgapChunkResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Offset  int64  `json:"offset"`
+}
+
+type CompleteAirgapUploadRequest struct {
+	RegistryHost string `json:"registryHost"`
+	Namespace    string `json:"namespace"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	// AllowUnsigned lets an admin install a bundle that has no signed manifest when a bundle public key is configured.
+	// It is refused for the kots cli token
+	AllowUnsigned bool `json:"allowUnsigned"`
+}
+
+type CompleteAirgapUploadResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+func CreateAirgapUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	airgapUploadResponse := AirgapUploadResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	createAirgapUploadRequest := CreateAirgapUploadRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&createAirgapUploadRequest); err != nil {
+		logger.Error(err)
+		airgapUploadResponse.Error = "failed to decode request body"
+		JSON(w, 400, airgapUploadResponse)
+		return
+	}
+
+	if createAirgapUploadRequest.AppID != "" {
+		if _, err := app.Get(createAirgapUploadRequest.AppID); err != nil {
+			logger.Error(err)
+			airgapUploadResponse.Error = "failed to get app"
+			JSON(w, 400, airgapUploadResponse)
+			return
+		}
+	}
+
+	uploadSession, err := airgap.CreateUploadSession(createAirgapUploadRequest.AppID, createAirgapUploadRequest.Size, createAirgapUploadRequest.Checksum)
+	if err != nil {
+		logger.Error(err)
+		airgapUploadResponse.Error = errors.Cause(err).Error()
+		JSON(w, 500, airgapUploadResponse)
+		return
+	}
+
+	airgapUploadResponse.Success = true
+	airgapUploadResponse.UploadSession = uploadSession
+
+	JSON(w, 201, airgapUploadResponse)
+}
+
+// GetAirgapUpload returns the upload session, clients resume from its offset
+func GetAirgapUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	airgapUploadResponse := AirgapUploadResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	uploadSession, err := airgap.GetUploadSession(mux.Vars(r)["uploadId"])
+	if err != nil {
+		logger.Error(err)
+		airgapUploadResponse.Error = "failed to get upload session"
+		JSON(w, 404, airgapUploadResponse)
+		return
+	}
+
+	airgapUploadResponse.Success = true
+	airgapUploadResponse.UploadSession = uploadSession
+
+	JSON(w, 200, airgapUploadResponse)
+}
+
+// UploadAirgapChunk appends the request body to the upload. The offset query param is where the chunk starts,
+// and the X-Chunk-Checksum header is the sha256 of the chunk
+func UploadAirgapChunk(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization, x-chunk-checksum")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	uploadAirgapChunkResponse := UploadAirgapChunkResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		logger.Error(err)
+		uploadAirgapChunkResponse.Error = "failed to parse offset"
+		JSON(w, 400, uploadAirgapChunkResponse)
+		return
+	}
+
+	checksum := r.Header.Get("X-Chunk-Checksum")
+	if checksum == "" {
+		uploadAirgapChunkResponse.Error = "X-Chunk-Checksum header is required"
+		JSON(w, 400, uploadAirgapChunkResponse)
+		return
+	}
+
+	newOffset, err := airgap.WriteChunk(mux.Vars(r)["uploadId"], offset, checksum, r.Body)
+	if err != nil {
+		logger.Error(err)
+		uploadAirgapChunkResponse.Error = errors.Cause(err).Error()
+		switch cause := errors.Cause(err).(type) {
+		case airgap.OffsetMismatchError:
+			uploadAirgapChunkResponse.Offset = cause.Offset
+			JSON(w, 409, uploadAirgapChunkResponse)
+		case airgap.ChecksumMismatchError:
+			uploadAirgapChunkResponse.Offset = offset
+			JSON(w, 400, uploadAirgapChunkResponse)
+		default:
+			JSON(w, 500, uploadAirgapChunkResponse)
+		}
+		return
+	}
+
+	uploadAirgapChunkResponse.Success = true
+	uploadAirgapChunkResponse.Offset = newOffset
+
+	JSON(w, 200, uploadAirgapChunkResponse)
+}
+
+// CompleteAirgapUpload verifies the assembled bundle, and then installs or updates the app from it in the background
+func CompleteAirgapUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	completeAirgapUploadResponse := CompleteAirgapUploadResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	completeAirgapUploadRequest := CompleteAirgapUploadRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&completeAirgapUploadRequest); err != nil {
+			logger.Error(err)
+			completeAirgapUploadResponse.Error = "failed to decode request body"
+			JSON(w, 400, completeAirgapUploadResponse)
+			return
+		}
+	}
+
+	if completeAirgapUploadRequest.AllowUnsigned && !isConsoleSession(r) {
+		completeAirgapUploadResponse.Error = "only an admin can allow unsigned bundles"
+		JSON(w, 403, completeAirgapUploadResponse)
+		return
+	}
+
+	uploadID := mux.Vars(r)["uploadId"]
+	uploadSession, err := airgap.GetUploadSession(uploadID)
+	if err != nil {
+		logger.Error(err)
+		completeAirgapUploadResponse.Error = "failed to get upload session"
+		JSON(w, 404, completeAirgapUploadResponse)
+		return
+	}
+
+	var installBundle func(airgapBundle string) error
+	if uploadSession.AppID != "" {
+		a, err := app.Get(uploadSession.AppID)
+		if err != nil {
+			logger.Error(err)
+			completeAirgapUploadResponse.Error = "failed to get app"
+			JSON(w, 500, completeAirgapUploadResponse)
+			return
+		}
+
+		installBundle = func(airgapBundle string) error {
+			return airgap.UpdateAppFromAirgap(a, airgapBundle, completeAirgapUploadRequest.AllowUnsigned)
+		}
+	} else {
+		pendingApp, err := airgap.GetPendingAirgapUploadApp()
+		if err != nil {
+			logger.Error(err)
+			completeAirgapUploadResponse.Error = "failed to get pending app"
+			JSON(w, 500, completeAirgapUploadResponse)
+			return
+		}
+
+		registryHost, namespace, username, password, err := airgapRegistryOptions(pendingApp, completeAirgapUploadRequest.RegistryHost,
+			completeAirgapUploadRequest.Namespace, completeAirgapUploadRequest.Username, completeAirgapUploadRequest.Password)
+		if err != nil {
+			logger.Error(err)
+			completeAirgapUploadResponse.Error = "failed to get registry options"
+			JSON(w, 500, completeAirgapUploadResponse)
+			return
+		}
+
+		installBundle = func(airgapBundle string) error {
+			return airgap.CreateAppFromAirgap(pendingApp, airgapBundle, registryHost, namespace, username, password, completeAirgapUploadRequest.AllowUnsigned)
+		}
+	}
+
+	airgapBundle, err := airgap.CompleteUploadSession(uploadID)
+	if err != nil {
+		logger.Error(err)
+		completeAirgapUploadResponse.Error = errors.Cause(err).Error()
+		JSON(w, 400, completeAirgapUploadResponse)
+		return
+	}
+
+	go func() {
+		if err := installBundle(airgapBundle); err != nil {
+			logger.Error(err)
+			// keep the bundle so the upload can be completed again
+			if err := airgap.ReopenUploadSession(uploadID); err != nil {
+				logger.Error(err)
+			}
+			return
+		}
+		deleteAirgapUpload(uploadID)
+	}()
+
+	completeAirgapUploadResponse.Success = true
+
+	JSON(w, 202, completeAirgapUploadResponse)
+}
+
+func deleteAirgapUpload(uploadID string) {
+	if err := airgap.DeleteUploadSession(uploadID); err != nil {
+		logger.Error(err)
+	}
+}
+
+type InspectAirgapUploadResponse struct {
+	Success    bool                     `json:"success"`
+	Error      string                   `json:"error,omitempty"`
+	Inspection *airgap.BundleInspection `json:"inspection,omitempty"`
+}
+
+// InspectAirgapUpload reports what a fully uploaded bundle contains, and whether it can be installed
+// for the app of the upload, before the upload is completed
+func InspectAirgapUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	inspectAirgapUploadResponse := InspectAirgapUploadResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	uploadSession, err := airgap.GetUploadSession(mux.Vars(r)["uploadId"])
+	if err != nil {
+		logger.Error(err)
+		inspectAirgapUploadResponse.Error = "failed to get upload session"
+		JSON(w, 404, inspectAirgapUploadResponse)
+		return
+	}
+
+	if uploadSession.Offset != uploadSession.Size {
+		inspectAirgapUploadResponse.Error = "the bundle has not been fully uploaded"
+		JSON(w, 400, inspectAirgapUploadResponse)
+		return
+	}
+
+	inspection, err := inspectAirgapUpload(uploadSession)
+	if err != nil {
+		logger.Error(err)
+		inspectAirgapUploadResponse.Error = errors.Cause(err).Error()
+		JSON(w, 400, inspectAirgapUploadResponse)
+		return
+	}
+
+	inspectAirgapUploadResponse.Success = true
+	inspectAirgapUploadResponse.Inspection = inspection
+
+	JSON(w, 200, inspectAirgapUploadResponse)
+}
+
+func inspectAirgapUpload(uploadSession *airgap.UploadSession) (*airgap.BundleInspection, error) {
+	if uploadSession.AppID != "" {
+		a, err := app.Get(uploadSession.AppID)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get app")
+		}
+		return airgap.InspectBundleForApp(airgap.UploadPath(uploadSession.ID), a)
+	}
+
+	pendingApp, err := airgap.GetPendingAirgapUploadApp()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get pending app")
+	}
+	return airgap.InspectBundleForPendingApp(airgap.UploadPath(uploadSession.ID), pendingApp)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/autodeploy"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+)
+
+type GetAutoDeployResponse struct {
+	Success   bool                   `json:"success"`
+	Error     string                 `json:"error,omitempty"`
+	Policy    string                 `json:"policy"`
+	Decisions []*autodeploy.Decision `json:"decisions"`
+}
+
+type SetAutoDeployPolicyRequest struct {
+	Policy string `json:"policy"`
+}
+
+type SetAutoDeployPolicyResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+func GetAutoDeploy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getAutoDeployResponse := GetAutoDeployResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getAutoDeployResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getAutoDeployResponse)
+		return
+	}
+
+	policy, err := autodeploy.GetPolicy(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		getAutoDeployResponse.Error = "failed to get auto deploy policy"
+		JSON(w, 500, getAutoDeployResponse)
+		return
+	}
+
+	decisions, err := autodeploy.ListDecisions(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		getAutoDeployResponse.Error = "failed to list auto deploy decisions"
+		JSON(w, 500, getAutoDeployResponse)
+		return
+	}
+
+	getAutoDeployResponse.Success = true
+	getAutoDeployResponse.Policy = policy
+	getAutoDeployResponse.Decisions = decisions
+
+	JSON(w, 200, getAutoDeployResponse)
+}
+
+func SetAutoDeployPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	setAutoDeployPolicyResponse := SetAutoDeployPolicyResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	setAutoDeployPolicyRequest := SetAutoDeployPolicyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&setAutoDeployPolicyRequest); err != nil {
+		logger.Error(err)
+		setAutoDeployPolicyResponse.Error = "failed to decode request body"
+		JSON(w, 400, setAutoDeployPolicyResponse)
+		return
+	}
+
+	if !autodeploy.IsValidPolicy(setAutoDeployPolicyRequest.Policy) {
+		setAutoDeployPolicyResponse.Error = "policy must be one of never, patch, minor-and-patch or any"
+		JSON(w, 400, setAutoDeployPolicyResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		setAutoDeployPolicyResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, setAutoDeployPolicyResponse)
+		return
+	}
+
+	if err := autodeploy.SetPolicy(foundApp.ID, setAutoDeployPolicyRequest.Policy); err != nil {
+		logger.Error(err)
+		setAutoDeployPolicyResponse.Error = "failed to set auto deploy policy"
+		JSON(w, 500, setAutoDeployPolicyResponse)
+		return
+	}
+
+	setAutoDeployPolicyResponse.Success = true
+
+	JSON(w, 200, setAutoDeployPolicyResponse)
+}
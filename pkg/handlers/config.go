@@ -34,12 +34,17 @@ type UpdateAppConfigRequest struct {
 	Sequence         int64                      `json:"sequence"`
 	CreateNewVersion bool                       `json:"createNewVersion"`
 	ConfigGroups     []*kotsv1beta1.ConfigGroup `json:"configGroups"`
+	Deploy           bool                       `json:"deploy"`
 }
 
 type UpdateAppConfigResponse struct {
-	Success       bool     `json:"success"`
-	Error         string   `json:"error,omitempty"`
-	RequiredItems []string `json:"requiredItems,omitempty"`
+	Success          bool                         `json:"success"`
+	Error            string                       `json:"error,omitempty"`
+	RequiredItems    []string                     `json:"requiredItems,omitempty"`
+	ValidationErrors []config.ItemValidationError `json:"validationErrors,omitempty"`
+	// DeployPending is set when the version is deployed once its preflight checks complete. A deploy that the
+	// preflight gating policy blocks is in the gate events, and can be deployed with an override
+	DeployPending bool `json:"deployPending,omitempty"`
 }
 
 func UpdateAppConfig(w http.ResponseWriter, r *http.Request) {
@@ -89,14 +94,14 @@ func UpdateAppConfig(w http.ResponseWriter, r *http.Request) {
 	if !updateAppConfigRequest.CreateNewVersion {
 		// special case handling for "do not create new version"
 		// no need to update versions after this/search for latest sequence that has the same upstream version/etc
-		resp, err := updateAppConfig(foundApp, updateAppConfigRequest.Sequence, updateAppConfigRequest, true)
+		resp, err := updateAppConfig(foundApp, updateAppConfigRequest.Sequence, updateAppConfigRequest, true, sess.UserID)
 		if err != nil {
 			logger.Error(err)
 			JSON(w, 500, resp)
 			return
 		}
 
-		if len(resp.RequiredItems) > 0 {
+		if len(resp.RequiredItems) > 0 || len(resp.ValidationErrors) > 0 {
 			JSON(w, 400, resp)
 			return
 		}
@@ -118,32 +123,32 @@ func UpdateAppConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// attempt to apply the config to the app version specified in the request
-	resp, err := updateAppConfig(foundApp, latestSequenceMatchingUpdateCursor, updateAppConfigRequest, true)
+	resp, err := updateAppConfig(foundApp, latestSequenceMatchingUpdateCursor, updateAppConfigRequest, true, sess.UserID)
 	if err != nil {
 		logger.Error(err)
 		JSON(w, 500, resp)
 		return
 	}
 
-	if len(resp.RequiredItems) > 0 {
+	if len(resp.RequiredItems) > 0 || len(resp.ValidationErrors) > 0 {
 		JSON(w, 400, resp)
 		return
 	}
 
 	// if there were no errors applying the config for the desired version, do the same for any later versions too
 	for _, version := range laterVersions {
-		_, err := updateAppConfig(foundApp, version.Sequence, updateAppConfigRequest, false)
+		_, err := updateAppConfig(foundApp, version.Sequence, updateAppConfigRequest, false, sess.UserID)
 		if err != nil {
 			logger.Error(errors.Wrapf(err, "error creating app with new config based on sequence %d for upstream %q", version.Sequence, version.VersionLabel))
 		}
 	}
 
-	JSON(w, 200, UpdateAppConfigResponse{Success: true})
+	JSON(w, 200, resp)
 }
 
 // if isPrimaryVersion is false, missing a required config field will not cause a failure, and instead will create
 // the app version with status needs_config
-func updateAppConfig(updateApp *app.App, sequence int64, req UpdateAppConfigRequest, isPrimaryVersion bool) (UpdateAppConfigResponse, error) {
+func updateAppConfig(updateApp *app.App, sequence int64, req UpdateAppConfigRequest, isPrimaryVersion bool, updatedBy string) (UpdateAppConfigResponse, error) {
 	updateAppConfigResponse := UpdateAppConfigResponse{
 		Success: false,
 	}
@@ -184,38 +189,20 @@ func updateAppConfig(updateApp *app.App, sequence int64, req UpdateAppConfigRequ
 		return updateAppConfigResponse, nil
 	}
 
-	// we don't merge, this is a wholesale replacement of the config values
-	// so we don't need the complex logic in kots, we can just write
-	values := kotsKinds.ConfigValues.Spec.Values
-	for _, group := range req.ConfigGroups {
-		for _, item := range group.Items {
-			if item.Value.Type == multitype.Bool {
-				updatedValue := item.Value.BoolVal
-				v := values[item.Name]
-				v.Value = strconv.FormatBool(updatedValue)
-				values[item.Name] = v
-			} else if item.Value.Type == multitype.String {
-				updatedValue := item.Value.String()
-				if item.Type == "password" {
-					// encrypt using the key
-					cipher, err := crypto.AESCipherFromString(kotsKinds.Installation.Spec.EncryptionKey)
-					if err != nil {
-						updateAppConfigResponse.Error = "failed to get encryption cipher"
-						return updateAppConfigResponse, err
-					}
-
-					// if the decryption succeeds, don't encrypt again
-					_, err = decrypt(updatedValue, cipher)
-					if err != nil {
-						updatedValue = base64.StdEncoding.EncodeToString(cipher.Encrypt([]byte(updatedValue)))
-					}
-				}
-
-				v := values[item.Name]
-				v.Value = updatedValue
-				values[item.Name] = v
-			}
+	// validate the submitted values against the rules declared on the config spec
+	// an invalid config never creates a version, not even for later versions
+	validationErrors, err := validateConfigGroups(kotsKinds, req.ConfigGroups)
+	if err != nil {
+		updateAppConfigResponse.Error = "failed to validate config"
+		return updateAppConfigResponse, err
+	}
+	if len(validationErrors) > 0 {
+		updateAppConfigResponse.ValidationErrors = validationErrors
+		updateAppConfigResponse.Error = "The config is not valid"
+		if !isPrimaryVersion {
+			return updateAppConfigResponse, errors.Errorf("config is not valid for sequence %d", sequence)
 		}
+		return updateAppConfigResponse, nil
 	}
 
 	if kotsKinds.ConfigValues == nil {
@@ -223,6 +210,12 @@ func updateAppConfig(updateApp *app.App, sequence int64, req UpdateAppConfigRequ
 		return updateAppConfigResponse, errors.New("no config values found")
 	}
 
+	values, err := updatedConfigValues(kotsKinds, req.ConfigGroups)
+	if err != nil {
+		updateAppConfigResponse.Error = "failed to update config values"
+		return updateAppConfigResponse, err
+	}
+
 	kotsKinds.ConfigValues.Spec.Values = values
 
 	configValuesSpec, err := kotsKinds.Marshal("kots.io", "v1beta1", "ConfigValues")
@@ -271,20 +264,101 @@ func updateAppConfig(updateApp *app.App, sequence int64, req UpdateAppConfigRequ
 		}
 	}
 
+	if err := config.SetConfigUpdatedBy(updateApp.ID, int64(sequence), updatedBy); err != nil {
+		updateAppConfigResponse.Error = "failed to record config change"
+		return updateAppConfigResponse, err
+	}
+
 	if err := downstream.SetDownstreamVersionPendingPreflight(updateApp.ID, int64(sequence)); err != nil {
 		updateAppConfigResponse.Error = "failed to set downstream status to 'pending preflight'"
 		return updateAppConfigResponse, err
 	}
 
-	if err := preflight.Run(updateApp.ID, int64(sequence), archiveDir); err != nil {
+	// the deploy waits for the preflights, so that the preflight gating policy is evaluated with their results
+	deploySource := ""
+	if isPrimaryVersion && req.Deploy {
+		deploySource = "config"
+	}
+	if err := preflight.RunAndDeploy(updateApp.ID, int64(sequence), archiveDir, preflight.TriggerConfig, deploySource); err != nil {
 		updateAppConfigResponse.Error = errors.Cause(err).Error()
 		return updateAppConfigResponse, err
 	}
+	updateAppConfigResponse.DeployPending = deploySource != ""
 
 	updateAppConfigResponse.Success = true
 	return updateAppConfigResponse, nil
 }
 
+// updatedConfigValues returns the config values of the app with the items in configGroups applied.
+// we don't merge, this is a wholesale replacement of the config values
+// so we don't need the complex logic in kots, we can just write
+func updatedConfigValues(kotsKinds *kotsutil.KotsKinds, configGroups []*kotsv1beta1.ConfigGroup) (map[string]kotsv1beta1.ConfigValue, error) {
+	values := kotsKinds.ConfigValues.Spec.Values
+	for _, group := range configGroups {
+		for _, item := range group.Items {
+			if item.Value.Type == multitype.Bool {
+				updatedValue := item.Value.BoolVal
+				v := values[item.Name]
+				v.Value = strconv.FormatBool(updatedValue)
+				values[item.Name] = v
+			} else if item.Value.Type == multitype.String {
+				updatedValue := item.Value.String()
+				if item.Type == "password" {
+					// encrypt using the key
+					cipher, err := crypto.AESCipherFromString(kotsKinds.Installation.Spec.EncryptionKey)
+					if err != nil {
+						return nil, errors.Wrap(err, "failed to get encryption cipher")
+					}
+
+					// if the decryption succeeds, don't encrypt again
+					_, err = decrypt(updatedValue, cipher)
+					if err != nil {
+						updatedValue = base64.StdEncoding.EncodeToString(cipher.Encrypt([]byte(updatedValue)))
+					}
+				}
+
+				v := values[item.Name]
+				v.Value = updatedValue
+				values[item.Name] = v
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// validateConfigGroups collects the plain text values from the request and runs the config validation rules on them
+func validateConfigGroups(kotsKinds *kotsutil.KotsKinds, configGroups []*kotsv1beta1.ConfigGroup) ([]config.ItemValidationError, error) {
+	if kotsKinds.Config == nil {
+		return nil, nil
+	}
+
+	cipher, err := crypto.AESCipherFromString(kotsKinds.Installation.Spec.EncryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get encryption cipher")
+	}
+
+	values := map[string]string{}
+	for _, group := range configGroups {
+		for _, item := range group.Items {
+			if item.Value.Type == multitype.Bool {
+				values[item.Name] = strconv.FormatBool(item.Value.BoolVal)
+			} else if item.Value.Type == multitype.String {
+				value := item.Value.String()
+				if item.Type == "password" {
+					// unchanged passwords are sent back encrypted
+					if decrypted, err := decrypt(value, cipher); err == nil {
+						value = decrypted
+					}
+				}
+				values[item.Name] = value
+			}
+		}
+	}
+
+	return config.ValidateConfig(kotsKinds.Config, values)
+}
+
 func decrypt(input string, cipher *crypto.AESCipher) (string, error) {
 	if cipher == nil {
 		return "", errors.New("cipher not defined")
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/config"
+	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/preflight"
+	"github.com/replicatedhq/kotsadm/pkg/registry"
+	"github.com/replicatedhq/kotsadm/pkg/render"
+	"github.com/replicatedhq/kotsadm/pkg/session"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+)
+
+type GetAppConfigHistoryResponse struct {
+	Success bool                         `json:"success"`
+	Error   string                       `json:"error,omitempty"`
+	History []*config.ConfigHistoryEntry `json:"history"`
+}
+
+type RestoreAppConfigResponse struct {
+	Success          bool                         `json:"success"`
+	Error            string                       `json:"error,omitempty"`
+	Sequence         int64                        `json:"sequence"`
+	ValidationErrors []config.ItemValidationError `json:"validationErrors,omitempty"`
+}
+
+func GetAppConfigHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getAppConfigHistoryResponse := GetAppConfigHistoryResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getAppConfigHistoryResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getAppConfigHistoryResponse)
+		return
+	}
+
+	history, err := config.ListConfigHistory(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		getAppConfigHistoryResponse.Error = "failed to list config history"
+		JSON(w, 500, getAppConfigHistoryResponse)
+		return
+	}
+
+	getAppConfigHistoryResponse.Success = true
+	getAppConfigHistoryResponse.History = history
+	JSON(w, 200, getAppConfigHistoryResponse)
+}
+
+func RestoreAppConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	restoreAppConfigResponse := RestoreAppConfigResponse{
+		Success: false,
+	}
+
+	sess, err := session.Parse(r.Header.Get("Authorization"))
+	if err != nil {
+		logger.Error(err)
+		restoreAppConfigResponse.Error = "failed to parse authorization header"
+		JSON(w, 401, restoreAppConfigResponse)
+		return
+	}
+
+	// we don't currently have roles, all valid tokens are valid sessions
+	if sess == nil || sess.ID == "" {
+		restoreAppConfigResponse.Error = "failed to parse authorization header"
+		JSON(w, 401, restoreAppConfigResponse)
+		return
+	}
+
+	fromSequence, err := strconv.ParseInt(mux.Vars(r)["sequence"], 10, 64)
+	if err != nil {
+		logger.Error(err)
+		restoreAppConfigResponse.Error = "failed to parse sequence"
+		JSON(w, 400, restoreAppConfigResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		restoreAppConfigResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, restoreAppConfigResponse)
+		return
+	}
+
+	resp, err := restoreAppConfig(foundApp, fromSequence, sess.UserID)
+	if err != nil {
+		logger.Error(err)
+		JSON(w, 500, resp)
+		return
+	}
+
+	if len(resp.ValidationErrors) > 0 {
+		JSON(w, 400, resp)
+		return
+	}
+
+	JSON(w, 200, resp)
+}
+
+// restoreAppConfig creates a new version from the current sequence of the app, using the config values
+// that were stored with fromSequence
+func restoreAppConfig(restoreApp *app.App, fromSequence int64, updatedBy string) (RestoreAppConfigResponse, error) {
+	restoreAppConfigResponse := RestoreAppConfigResponse{
+		Success: false,
+	}
+
+	restoredConfigValues, restoredEncryptionKey, err := config.GetConfigValuesForSequence(restoreApp.ID, fromSequence)
+	if err != nil {
+		restoreAppConfigResponse.Error = "failed to get config values to restore"
+		return restoreAppConfigResponse, err
+	}
+
+	archiveDir, err := version.GetAppVersionArchive(restoreApp.ID, restoreApp.CurrentSequence)
+	if err != nil {
+		restoreAppConfigResponse.Error = "failed to get app version archive"
+		return restoreAppConfigResponse, err
+	}
+	defer os.RemoveAll(archiveDir)
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		restoreAppConfigResponse.Error = "failed to load kots kinds from path"
+		return restoreAppConfigResponse, err
+	}
+
+	if kotsKinds.ConfigValues == nil {
+		restoreAppConfigResponse.Error = "no config values found"
+		return restoreAppConfigResponse, errors.New("no config values found")
+	}
+
+	plainValues, err := config.PlainConfigValues(kotsKinds.Config, restoredConfigValues, restoredEncryptionKey)
+	if err != nil {
+		restoreAppConfigResponse.Error = "failed to read config values to restore"
+		return restoreAppConfigResponse, err
+	}
+
+	validationErrors, err := config.ValidateConfig(kotsKinds.Config, plainValues)
+	if err != nil {
+		restoreAppConfigResponse.Error = "failed to validate config"
+		return restoreAppConfigResponse, err
+	}
+	if len(validationErrors) > 0 {
+		restoreAppConfigResponse.ValidationErrors = validationErrors
+		restoreAppConfigResponse.Error = "The restored config is not valid for the current version"
+		return restoreAppConfigResponse, nil
+	}
+
+	values, err := reencryptConfigValues(kotsKinds, restoredConfigValues, plainValues, restoredEncryptionKey)
+	if err != nil {
+		restoreAppConfigResponse.Error = "failed to encrypt config values"
+		return restoreAppConfigResponse, err
+	}
+	kotsKinds.ConfigValues.Spec.Values = values
+
+	configValuesSpec, err := kotsKinds.Marshal("kots.io", "v1beta1", "ConfigValues")
+	if err != nil {
+		restoreAppConfigResponse.Error = "failed to marshal config values spec"
+		return restoreAppConfigResponse, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(archiveDir, "upstream", "userdata", "config.yaml"), []byte(configValuesSpec), 0644); err != nil {
+		restoreAppConfigResponse.Error = "failed to write config.yaml to upstream/userdata"
+		return restoreAppConfigResponse, err
+	}
+
+	newSequence, err := createConfigVersion(restoreApp, archiveDir, "Config Restore", updatedBy)
+	if err != nil {
+		restoreAppConfigResponse.Error = errors.Cause(err).Error()
+		return restoreAppConfigResponse, err
+	}
+
+	restoreAppConfigResponse.Success = true
+	restoreAppConfigResponse.Sequence = newSequence
+	return restoreAppConfigResponse, nil
+}
+
+// reencryptConfigValues makes sure that password items in the restored values are encrypted with the
+// encryption key of the current installation, the key may have changed since the values were stored
+func reencryptConfigValues(kotsKinds *kotsutil.KotsKinds, restored *kotsv1beta1.ConfigValues, plainValues map[string]string, restoredEncryptionKey string) (map[string]kotsv1beta1.ConfigValue, error) {
+	values := map[string]kotsv1beta1.ConfigValue{}
+	for name, value := range restored.Spec.Values {
+		values[name] = value
+	}
+
+	if restoredEncryptionKey == kotsKinds.Installation.Spec.EncryptionKey || kotsKinds.Config == nil {
+		return values, nil
+	}
+
+	cipher, err := crypto.AESCipherFromString(kotsKinds.Installation.Spec.EncryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get encryption cipher")
+	}
+
+	for _, group := range kotsKinds.Config.Spec.Groups {
+		for _, item := range group.Items {
+			if item.Type != "password" {
+				continue
+			}
+			v, ok := values[item.Name]
+			if !ok || v.Value == "" {
+				continue
+			}
+			v.Value = base64.StdEncoding.EncodeToString(cipher.Encrypt([]byte(plainValues[item.Name])))
+			values[item.Name] = v
+		}
+	}
+
+	return values, nil
+}
+
+// createConfigVersion creates a new version of the app from archiveDir, which has updated config values
+// written to upstream/userdata/config.yaml, and starts preflights for it
+func createConfigVersion(a *app.App, archiveDir string, source string, updatedBy string) (int64, error) {
+	registrySettings, err := registry.GetRegistrySettingsForApp(a.ID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get registry settings")
+	}
+	if err := render.RenderDir(archiveDir, a.ID, registrySettings); err != nil {
+		return 0, errors.Wrap(err, "failed to render archive directory")
+	}
+
+	newSequence, err := version.CreateVersion(a.ID, archiveDir, source, a.CurrentSequence)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create an app version")
+	}
+
+	if err := version.CreateAppVersionArchive(a.ID, newSequence, archiveDir); err != nil {
+		return 0, errors.Wrap(err, "failed to create an app version archive")
+	}
+
+	if err := config.SetConfigUpdatedBy(a.ID, newSequence, updatedBy); err != nil {
+		return 0, errors.Wrap(err, "failed to record config change")
+	}
+
+	if err := downstream.SetDownstreamVersionPendingPreflight(a.ID, newSequence); err != nil {
+		return 0, errors.Wrap(err, "failed to set downstream status to 'pending preflight'")
+	}
+
+	if err := preflight.Run(a.ID, newSequence, archiveDir, preflight.TriggerConfig); err != nil {
+		return 0, errors.Wrap(err, "failed to run preflights")
+	}
+
+	return newSequence, nil
+}
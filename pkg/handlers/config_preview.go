@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/config"
+	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/registry"
+	registrytypes "github.com/replicatedhq/kotsadm/pkg/registry/types"
+	"github.com/replicatedhq/kotsadm/pkg/render"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+)
+
+type PreviewAppConfigRequest struct {
+	ConfigGroups []*kotsv1beta1.ConfigGroup `json:"configGroups"`
+	Downstream   string                     `json:"downstream,omitempty"`
+	Diff         bool                       `json:"diff"`
+}
+
+type PreviewAppConfigResponse struct {
+	Success          bool                         `json:"success"`
+	Error            string                       `json:"error,omitempty"`
+	ValidationErrors []config.ItemValidationError `json:"validationErrors,omitempty"`
+	TemplateErrors   []*render.TemplateError      `json:"templateErrors,omitempty"`
+	Files            map[string]string            `json:"files,omitempty"`
+	Diff             []downstream.FileDiff        `json:"diff,omitempty"`
+}
+
+// PreviewAppConfig renders the manifests of a sequence with proposed config values, without
+// creating a version or storing anything
+func PreviewAppConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	previewAppConfigResponse := PreviewAppConfigResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	previewAppConfigRequest := PreviewAppConfigRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&previewAppConfigRequest); err != nil {
+		logger.Error(err)
+		previewAppConfigResponse.Error = "failed to decode request body"
+		JSON(w, 400, previewAppConfigResponse)
+		return
+	}
+
+	sequence, err := strconv.ParseInt(mux.Vars(r)["sequence"], 10, 64)
+	if err != nil {
+		logger.Error(err)
+		previewAppConfigResponse.Error = "failed to parse sequence"
+		JSON(w, 400, previewAppConfigResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		previewAppConfigResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, previewAppConfigResponse)
+		return
+	}
+
+	resp, err := previewAppConfig(foundApp, sequence, previewAppConfigRequest)
+	if err != nil {
+		logger.Error(err)
+		JSON(w, 500, resp)
+		return
+	}
+
+	if len(resp.ValidationErrors) > 0 || len(resp.TemplateErrors) > 0 {
+		JSON(w, 400, resp)
+		return
+	}
+
+	JSON(w, 200, resp)
+}
+
+// previewAppConfig renders a scratch copy of the archive for sequence with the config values in req applied.
+// the archive is never stored, and no version is created
+func previewAppConfig(previewApp *app.App, sequence int64, req PreviewAppConfigRequest) (PreviewAppConfigResponse, error) {
+	previewAppConfigResponse := PreviewAppConfigResponse{
+		Success: false,
+	}
+
+	archiveDir, err := version.GetAppVersionArchive(previewApp.ID, sequence)
+	if err != nil {
+		previewAppConfigResponse.Error = "failed to get app version archive"
+		return previewAppConfigResponse, err
+	}
+	defer os.RemoveAll(archiveDir)
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		previewAppConfigResponse.Error = "failed to load kots kinds from path"
+		return previewAppConfigResponse, err
+	}
+
+	if kotsKinds.ConfigValues == nil {
+		previewAppConfigResponse.Error = "no config values found"
+		return previewAppConfigResponse, errors.New("no config values found")
+	}
+
+	validationErrors, err := validateConfigGroups(kotsKinds, req.ConfigGroups)
+	if err != nil {
+		previewAppConfigResponse.Error = "failed to validate config"
+		return previewAppConfigResponse, err
+	}
+	if len(validationErrors) > 0 {
+		previewAppConfigResponse.ValidationErrors = validationErrors
+		previewAppConfigResponse.Error = "The config is not valid"
+		return previewAppConfigResponse, nil
+	}
+
+	values, err := updatedConfigValues(kotsKinds, req.ConfigGroups)
+	if err != nil {
+		previewAppConfigResponse.Error = "failed to update config values"
+		return previewAppConfigResponse, err
+	}
+	kotsKinds.ConfigValues.Spec.Values = values
+
+	configValuesSpec, err := kotsKinds.Marshal("kots.io", "v1beta1", "ConfigValues")
+	if err != nil {
+		previewAppConfigResponse.Error = "failed to marshal config values spec"
+		return previewAppConfigResponse, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(archiveDir, "upstream", "userdata", "config.yaml"), []byte(configValuesSpec), 0644); err != nil {
+		previewAppConfigResponse.Error = "failed to write config.yaml to upstream/userdata"
+		return previewAppConfigResponse, err
+	}
+
+	registrySettings, err := registry.GetRegistrySettingsForApp(previewApp.ID)
+	if err != nil {
+		previewAppConfigResponse.Error = "failed to get registry settings"
+		return previewAppConfigResponse, err
+	}
+
+	// render each upstream file on its own first so that template errors can be reported with their position,
+	// rendering the whole dir only reports the first error without the file it came from
+	templateErrors, err := findTemplateErrors(kotsKinds, registrySettings, archiveDir)
+	if err != nil {
+		previewAppConfigResponse.Error = "failed to render upstream files"
+		return previewAppConfigResponse, err
+	}
+	if len(templateErrors) > 0 {
+		previewAppConfigResponse.TemplateErrors = templateErrors
+		previewAppConfigResponse.Error = "The config could not be rendered"
+		return previewAppConfigResponse, nil
+	}
+
+	if err := render.RenderDir(archiveDir, previewApp.ID, registrySettings); err != nil {
+		previewAppConfigResponse.Error = "failed to render archive directory"
+		return previewAppConfigResponse, err
+	}
+
+	downstreamName := req.Downstream
+	if downstreamName == "" {
+		downstreams, err := downstream.ListDownstreamsForApp(previewApp.ID)
+		if err != nil {
+			previewAppConfigResponse.Error = "failed to list downstreams"
+			return previewAppConfigResponse, err
+		}
+		if len(downstreams) > 0 {
+			downstreamName = downstreams[0].Name
+		}
+	}
+
+	files, err := downstream.BuildManifests(archiveDir, downstreamName, kotsKinds.KustomizeVersion())
+	if err != nil {
+		previewAppConfigResponse.Error = "failed to build manifests"
+		return previewAppConfigResponse, err
+	}
+
+	if req.Diff {
+		baseArchiveDir, err := version.GetAppVersionArchive(previewApp.ID, sequence)
+		if err != nil {
+			previewAppConfigResponse.Error = "failed to get app version archive"
+			return previewAppConfigResponse, err
+		}
+		defer os.RemoveAll(baseArchiveDir)
+
+		baseFiles, err := downstream.BuildManifests(baseArchiveDir, downstreamName, kotsKinds.KustomizeVersion())
+		if err != nil {
+			previewAppConfigResponse.Error = "failed to build manifests for the current config"
+			return previewAppConfigResponse, err
+		}
+
+		previewAppConfigResponse.Diff = downstream.DiffFiles(files, baseFiles)
+	} else {
+		previewAppConfigResponse.Files = map[string]string{}
+		for filename, content := range files {
+			previewAppConfigResponse.Files[filename] = string(content)
+		}
+	}
+
+	previewAppConfigResponse.Success = true
+	return previewAppConfigResponse, nil
+}
+
+// findTemplateErrors renders every upstream file in archiveDir and returns the template errors found,
+// filenames are relative to the upstream dir
+func findTemplateErrors(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.RegistrySettings, archiveDir string) ([]*render.TemplateError, error) {
+	upstreamDir := filepath.Join(archiveDir, "upstream")
+	templateErrors := []*render.TemplateError{}
+
+	err := filepath.Walk(upstreamDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(upstreamDir, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if relPath == "userdata" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", relPath)
+		}
+
+		_, err = render.RenderNamedFile(kotsKinds, registrySettings, relPath, content)
+		if err != nil {
+			if templateErr, ok := err.(*render.TemplateError); ok {
+				templateErrors = append(templateErrors, templateErr)
+				return nil
+			}
+			return errors.Wrapf(err, "failed to render %s", relPath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk upstream dir")
+	}
+
+	return templateErrors, nil
+}
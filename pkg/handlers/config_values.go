@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/config"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/session"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+)
+
+type ImportAppConfigValuesResponse struct {
+	Success          bool                         `json:"success"`
+	Error            string                       `json:"error,omitempty"`
+	Sequence         int64                        `json:"sequence"`
+	ValidationErrors []config.ItemValidationError `json:"validationErrors,omitempty"`
+}
+
+// invalidConfigValuesError is returned for config values that can't be imported into the app, such as a
+// document that doesn't parse or an app without a config. These are errors of the request, not of the server
+type invalidConfigValuesError struct {
+	err error
+}
+
+func (e *invalidConfigValuesError) Error() string {
+	return e.err.Error()
+}
+
+// ExportAppConfigValues returns the ConfigValues of the current version of the app as yaml.
+// Password items stay encrypted with the installation key, so the document can be imported back into
+// the same install. Decrypted values are only returned with decryptPasswordValues=true, and only to
+// the kots cli, which authenticates with the authstring from the cluster.
+func ExportAppConfigValues(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	sess, err := session.Parse(r.Header.Get("Authorization"))
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(401)
+		return
+	}
+
+	// we don't currently have roles, all valid tokens are valid sessions
+	if sess == nil || sess.ID == "" {
+		w.WriteHeader(401)
+		return
+	}
+
+	decryptPasswordValues := false
+	if r.URL.Query().Get("decryptPasswordValues") != "" {
+		decryptPasswordValues, err = strconv.ParseBool(r.URL.Query().Get("decryptPasswordValues"))
+		if err != nil {
+			logger.Error(err)
+			w.WriteHeader(400)
+			return
+		}
+	}
+
+	if decryptPasswordValues && sess.UserID != "kots-cli" {
+		logger.Error(errors.New("decrypted config values can only be exported by the kots cli"))
+		w.WriteHeader(403)
+		return
+	}
+
+	a, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+
+	archiveDir, err := version.GetAppVersionArchive(a.ID, a.CurrentSequence)
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+	defer os.RemoveAll(archiveDir)
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+
+	if kotsKinds.ConfigValues == nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	if decryptPasswordValues {
+		if err := kotsKinds.DecryptConfigValues(); err != nil {
+			logger.Error(err)
+			w.WriteHeader(500)
+			return
+		}
+	}
+
+	configValuesSpec, err := kotsKinds.Marshal("kots.io", "v1beta1", "ConfigValues")
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=config.yaml")
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.WriteHeader(200)
+	w.Write([]byte(configValuesSpec))
+}
+
+// ImportAppConfigValues creates a new version of the app from the current version, with the config values
+// replaced by the ConfigValues document in the request body. Password items may be set in plain text
+// with valuePlaintext, they are encrypted with the installation key before the version is stored. A password
+// value must already be encrypted with the installation key, otherwise the import is rejected.
+func ImportAppConfigValues(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	importAppConfigValuesResponse := ImportAppConfigValuesResponse{
+		Success: false,
+	}
+
+	sess, err := session.Parse(r.Header.Get("Authorization"))
+	if err != nil {
+		logger.Error(err)
+		importAppConfigValuesResponse.Error = "failed to parse authorization header"
+		JSON(w, 401, importAppConfigValuesResponse)
+		return
+	}
+
+	// we don't currently have roles, all valid tokens are valid sessions
+	if sess == nil || sess.ID == "" {
+		importAppConfigValuesResponse.Error = "failed to parse authorization header"
+		JSON(w, 401, importAppConfigValuesResponse)
+		return
+	}
+
+	configValuesSpec, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Error(err)
+		importAppConfigValuesResponse.Error = "failed to read request body"
+		JSON(w, 400, importAppConfigValuesResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		importAppConfigValuesResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, importAppConfigValuesResponse)
+		return
+	}
+
+	resp, err := importAppConfigValues(foundApp, configValuesSpec, sess.UserID)
+	if _, ok := err.(*invalidConfigValuesError); ok {
+		logger.Error(err)
+		JSON(w, 400, resp)
+		return
+	} else if err != nil {
+		logger.Error(err)
+		JSON(w, 500, resp)
+		return
+	}
+
+	if len(resp.ValidationErrors) > 0 {
+		JSON(w, 400, resp)
+		return
+	}
+
+	JSON(w, 200, resp)
+}
+
+func importAppConfigValues(importApp *app.App, configValuesSpec []byte, updatedBy string) (ImportAppConfigValuesResponse, error) {
+	importAppConfigValuesResponse := ImportAppConfigValuesResponse{
+		Success: false,
+	}
+
+	importedConfigValues, err := kotsutil.LoadConfigValuesFromContents(configValuesSpec)
+	if err != nil {
+		importAppConfigValuesResponse.Error = "failed to parse config values"
+		return importAppConfigValuesResponse, &invalidConfigValuesError{err: err}
+	}
+
+	archiveDir, err := version.GetAppVersionArchive(importApp.ID, importApp.CurrentSequence)
+	if err != nil {
+		importAppConfigValuesResponse.Error = "failed to get app version archive"
+		return importAppConfigValuesResponse, err
+	}
+	defer os.RemoveAll(archiveDir)
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		importAppConfigValuesResponse.Error = "failed to load kots kinds from path"
+		return importAppConfigValuesResponse, err
+	}
+
+	if kotsKinds.Config == nil {
+		importAppConfigValuesResponse.Error = "app does not have a config"
+		return importAppConfigValuesResponse, &invalidConfigValuesError{err: errors.New("app does not have a config")}
+	}
+
+	passwordErrors, err := config.ValidateEncryptedPasswordValues(kotsKinds.Config, importedConfigValues, kotsKinds.Installation.Spec.EncryptionKey)
+	if err != nil {
+		importAppConfigValuesResponse.Error = "failed to validate password values"
+		return importAppConfigValuesResponse, err
+	}
+	if len(passwordErrors) > 0 {
+		importAppConfigValuesResponse.ValidationErrors = passwordErrors
+		importAppConfigValuesResponse.Error = "The config values are not valid"
+		return importAppConfigValuesResponse, nil
+	}
+
+	plainValues, err := config.PlainConfigValues(kotsKinds.Config, importedConfigValues, kotsKinds.Installation.Spec.EncryptionKey)
+	if err != nil {
+		importAppConfigValuesResponse.Error = "failed to read config values"
+		return importAppConfigValuesResponse, err
+	}
+
+	validationErrors, err := config.ValidateConfigValues(kotsKinds.Config, plainValues)
+	if err != nil {
+		importAppConfigValuesResponse.Error = "failed to validate config"
+		return importAppConfigValuesResponse, err
+	}
+	if len(validationErrors) > 0 {
+		importAppConfigValuesResponse.ValidationErrors = validationErrors
+		importAppConfigValuesResponse.Error = "The config values are not valid"
+		return importAppConfigValuesResponse, nil
+	}
+
+	kotsKinds.ConfigValues = importedConfigValues
+	if err := kotsKinds.EncryptConfigValues(); err != nil {
+		importAppConfigValuesResponse.Error = "failed to encrypt config values"
+		return importAppConfigValuesResponse, err
+	}
+
+	updatedConfigValuesSpec, err := kotsKinds.Marshal("kots.io", "v1beta1", "ConfigValues")
+	if err != nil {
+		importAppConfigValuesResponse.Error = "failed to marshal config values spec"
+		return importAppConfigValuesResponse, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(archiveDir, "upstream", "userdata", "config.yaml"), []byte(updatedConfigValuesSpec), 0644); err != nil {
+		importAppConfigValuesResponse.Error = "failed to write config.yaml to upstream/userdata"
+		return importAppConfigValuesResponse, err
+	}
+
+	newSequence, err := createConfigVersion(importApp, archiveDir, "Config Import", updatedBy)
+	if err != nil {
+		importAppConfigValuesResponse.Error = errors.Cause(err).Error()
+		return importAppConfigValuesResponse, err
+	}
+
+	importAppConfigValuesResponse.Success = true
+	importAppConfigValuesResponse.Sequence = newSequence
+	return importAppConfigValuesResponse, nil
+}
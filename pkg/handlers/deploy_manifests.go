@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/registry"
+	"github.com/replicatedhq/kotsadm/pkg/render"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+)
+
+// GetDeployManifests returns the manifests of a downstream of an app version as they are sent to the operator.
+// Config values that reference an external secret are resolved here and never stored, so the manifests can
+// contain secrets and only the kots token can read them
+func GetDeployManifests(w http.ResponseWriter, r *http.Request) {
+	if err := requireValidKOTSToken(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	sequence, err := strconv.ParseInt(mux.Vars(r)["sequence"], 10, 64)
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(400)
+		return
+	}
+
+	a, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+
+	archiveDir, err := version.GetAppVersionArchive(a.ID, sequence)
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+	defer os.RemoveAll(archiveDir)
+
+	registrySettings, err := registry.GetRegistrySettingsForApp(a.ID)
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+
+	if err := render.RenderDirForDeploy(archiveDir, a.ID, registrySettings); err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+
+	manifests, err := downstream.KustomizeBuild(archiveDir, mux.Vars(r)["downstreamName"], kotsKinds.KustomizeVersion())
+	if err != nil {
+		logger.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.WriteHeader(200)
+	w.Write(manifests)
+}
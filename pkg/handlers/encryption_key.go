@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+)
+
+type RotateEncryptionKeyRequest struct {
+	OldKey string `json:"oldKey,omitempty"`
+	NewKey string `json:"newKey,omitempty"`
+}
+
+type RotateEncryptionKeyResponse struct {
+	Success bool                          `json:"success"`
+	Error   string                        `json:"error,omitempty"`
+	Result  *encryptionkey.RotationResult `json:"result,omitempty"`
+}
+
+type ListEncryptionKeyVersionsResponse struct {
+	Success     bool                       `json:"success"`
+	Error       string                     `json:"error,omitempty"`
+	KeyVersions []encryptionkey.KeyVersion `json:"keyVersions"`
+}
+
+// RotateEncryptionKey re-encrypts stored secrets with the new key. This is limited to the kots cli, and
+// the keys default to the ones the api was started with
+func RotateEncryptionKey(w http.ResponseWriter, r *http.Request) {
+	rotateEncryptionKeyResponse := RotateEncryptionKeyResponse{
+		Success: false,
+	}
+
+	if err := requireValidKOTSToken(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	rotateEncryptionKeyRequest := RotateEncryptionKeyRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&rotateEncryptionKeyRequest); err != nil {
+			logger.Error(err)
+			rotateEncryptionKeyResponse.Error = "failed to decode request body"
+			JSON(w, 400, rotateEncryptionKeyResponse)
+			return
+		}
+	}
+
+	oldKey := rotateEncryptionKeyRequest.OldKey
+	if oldKey == "" {
+		oldKey = os.Getenv(encryptionkey.PreviousKeyEnv)
+	}
+	newKey := rotateEncryptionKeyRequest.NewKey
+	if newKey == "" {
+		newKey = os.Getenv(encryptionkey.CurrentKeyEnv)
+	}
+
+	result, err := encryptionkey.Rotate(oldKey, newKey)
+	if err != nil {
+		logger.Error(err)
+		rotateEncryptionKeyResponse.Error = errors.Cause(err).Error()
+		JSON(w, 500, rotateEncryptionKeyResponse)
+		return
+	}
+
+	rotateEncryptionKeyResponse.Success = true
+	rotateEncryptionKeyResponse.Result = result
+	JSON(w, 200, rotateEncryptionKeyResponse)
+}
+
+func ListEncryptionKeyVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	listEncryptionKeyVersionsResponse := ListEncryptionKeyVersionsResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	keyVersions, err := encryptionkey.ListKeyVersions()
+	if err != nil {
+		logger.Error(err)
+		listEncryptionKeyVersionsResponse.Error = "failed to list key versions"
+		JSON(w, 500, listEncryptionKeyVersionsResponse)
+		return
+	}
+
+	listEncryptionKeyVersionsResponse.Success = true
+	listEncryptionKeyVersionsResponse.KeyVersions = keyVersions
+	JSON(w, 200, listEncryptionKeyVersionsResponse)
+}
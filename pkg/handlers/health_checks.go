@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/preflight"
+)
+
+const defaultHealthCheckRunsLimit = 50
+
+type GetHealthChecksResponse struct {
+	Success  bool                           `json:"success"`
+	Error    string                         `json:"error,omitempty"`
+	Settings *preflight.HealthCheckSettings `json:"settings,omitempty"`
+	Runs     []*preflight.HealthCheckRun    `json:"runs"`
+}
+
+type SetHealthCheckSettingsResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type RunHealthChecksResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// GetHealthChecks returns the health check settings of an app, and the latest runs. The number of runs
+// can be set with the limit query param
+func GetHealthChecks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getHealthChecksResponse := GetHealthChecksResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	limit := defaultHealthCheckRunsLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 1 {
+			getHealthChecksResponse.Error = "limit must be a positive number"
+			JSON(w, 400, getHealthChecksResponse)
+			return
+		}
+		limit = l
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getHealthChecksResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getHealthChecksResponse)
+		return
+	}
+
+	settings, err := preflight.GetHealthCheckSettings(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		getHealthChecksResponse.Error = "failed to get health check settings"
+		JSON(w, 500, getHealthChecksResponse)
+		return
+	}
+
+	runs, err := preflight.ListHealthCheckRuns(foundApp.ID, limit)
+	if err != nil {
+		logger.Error(err)
+		getHealthChecksResponse.Error = "failed to list health check runs"
+		JSON(w, 500, getHealthChecksResponse)
+		return
+	}
+
+	getHealthChecksResponse.Success = true
+	getHealthChecksResponse.Settings = settings
+	getHealthChecksResponse.Runs = runs
+	JSON(w, 200, getHealthChecksResponse)
+}
+
+func SetHealthCheckSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	setHealthCheckSettingsResponse := SetHealthCheckSettingsResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	settings := preflight.HealthCheckSettings{}
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		logger.Error(err)
+		setHealthCheckSettingsResponse.Error = "failed to decode request body"
+		JSON(w, 400, setHealthCheckSettingsResponse)
+		return
+	}
+
+	if settings.IntervalMinutes < 0 {
+		setHealthCheckSettingsResponse.Error = "interval must be at least 1 minute"
+		JSON(w, 400, setHealthCheckSettingsResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		setHealthCheckSettingsResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, setHealthCheckSettingsResponse)
+		return
+	}
+
+	if err := preflight.SetHealthCheckSettings(foundApp.ID, &settings); err != nil {
+		logger.Error(err)
+		setHealthCheckSettingsResponse.Error = "failed to set health check settings"
+		JSON(w, 500, setHealthCheckSettingsResponse)
+		return
+	}
+
+	setHealthCheckSettingsResponse.Success = true
+	JSON(w, 200, setHealthCheckSettingsResponse)
+}
+
+// RunHealthChecks starts the health checks of an app without waiting for the next interval
+func RunHealthChecks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	runHealthChecksResponse := RunHealthChecksResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		runHealthChecksResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, runHealthChecksResponse)
+		return
+	}
+
+	if !preflight.StartHealthChecks(foundApp.ID) {
+		runHealthChecksResponse.Error = "health checks are already running"
+		JSON(w, 409, runHealthChecksResponse)
+		return
+	}
+
+	runHealthChecksResponse.Success = true
+	JSON(w, 200, runHealthChecksResponse)
+}
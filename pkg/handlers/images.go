@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/registry"
+)
+
+type GetAppVersionImagesResponse struct {
+	Success   bool                     `json:"success"`
+	Error     string                   `json:"error,omitempty"`
+	Inventory *registry.ImageInventory `json:"inventory,omitempty"`
+}
+
+// GetAppVersionImages lists the images of an app version, and whether they are in the registry they will be pulled from
+func GetAppVersionImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getAppVersionImagesResponse := GetAppVersionImagesResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	sequence, err := strconv.ParseInt(mux.Vars(r)["sequence"], 10, 64)
+	if err != nil {
+		logger.Error(err)
+		getAppVersionImagesResponse.Error = "failed to parse sequence"
+		JSON(w, 400, getAppVersionImagesResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getAppVersionImagesResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getAppVersionImagesResponse)
+		return
+	}
+
+	inventory, err := registry.GetImageInventory(foundApp.ID, sequence)
+	if err != nil {
+		logger.Error(err)
+		getAppVersionImagesResponse.Error = "failed to get image inventory"
+		JSON(w, 500, getAppVersionImagesResponse)
+		return
+	}
+
+	getAppVersionImagesResponse.Success = true
+	getAppVersionImagesResponse.Inventory = inventory
+	JSON(w, 200, getAppVersionImagesResponse)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
 	"github.com/replicatedhq/kotsadm/pkg/license"
 	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/notification"
 	"github.com/replicatedhq/kotsadm/pkg/online"
 	"github.com/replicatedhq/kotsadm/pkg/registry"
 	"github.com/replicatedhq/kotsadm/pkg/session"
@@ -332,3 +334,118 @@ func ResumeInstallOnline(w http.ResponseWriter, r *http.Request) {
 
 	JSON(w, 200, resumeInstallOnlineResponse)
 }
+
+type GetLicenseStatusResponse struct {
+	Success       bool                         `json:"success"`
+	Error         string                       `json:"error,omitempty"`
+	LicenseStatus *license.LicenseStatus       `json:"licenseStatus"`
+	Notifications []*notification.Notification `json:"notifications"`
+}
+
+func GetLicenseStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getLicenseStatusResponse := GetLicenseStatusResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getLicenseStatusResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getLicenseStatusResponse)
+		return
+	}
+
+	licenseStatus, err := license.GetLicenseStatus(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		getLicenseStatusResponse.Error = "failed to get license status"
+		JSON(w, 500, getLicenseStatusResponse)
+		return
+	}
+
+	notifications, err := notification.List(foundApp.ID, false)
+	if err != nil {
+		logger.Error(err)
+		getLicenseStatusResponse.Error = "failed to list notifications"
+		JSON(w, 500, getLicenseStatusResponse)
+		return
+	}
+
+	getLicenseStatusResponse.Notifications = []*notification.Notification{}
+	for _, n := range notifications {
+		if strings.HasPrefix(n.Kind, "license-") {
+			getLicenseStatusResponse.Notifications = append(getLicenseStatusResponse.Notifications, n)
+		}
+	}
+
+	getLicenseStatusResponse.Success = true
+	getLicenseStatusResponse.LicenseStatus = licenseStatus
+	JSON(w, 200, getLicenseStatusResponse)
+}
+
+type GetLicenseDiffResponse struct {
+	Success bool                 `json:"success"`
+	Error   string               `json:"error,omitempty"`
+	Diff    *license.LicenseDiff `json:"diff"`
+}
+
+// GetLicenseDiff returns what changed in the license for versions that were created by a license change
+func GetLicenseDiff(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getLicenseDiffResponse := GetLicenseDiffResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	sequence, err := strconv.ParseInt(mux.Vars(r)["sequence"], 10, 64)
+	if err != nil {
+		logger.Error(err)
+		getLicenseDiffResponse.Error = "failed to parse sequence"
+		JSON(w, 400, getLicenseDiffResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getLicenseDiffResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getLicenseDiffResponse)
+		return
+	}
+
+	diff, err := license.GetLicenseDiff(foundApp.ID, sequence)
+	if err != nil {
+		logger.Error(err)
+		getLicenseDiffResponse.Error = "failed to get license diff"
+		JSON(w, 500, getLicenseDiffResponse)
+		return
+	}
+
+	getLicenseDiffResponse.Success = true
+	getLicenseDiffResponse.Diff = diff
+	JSON(w, 200, getLicenseDiffResponse)
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/maintenance"
+	"github.com/replicatedhq/kotsadm/pkg/preflightgate"
+	"github.com/replicatedhq/kotsadm/pkg/session"
+)
+
+type GetMaintenanceWindowsResponse struct {
+	Success  bool                 `json:"success"`
+	Error    string               `json:"error,omitempty"`
+	Windows  *maintenance.Windows `json:"windows,omitempty"`
+	IsOpen   bool                 `json:"isOpen"`
+	NextOpen *time.Time           `json:"nextOpen,omitempty"`
+}
+
+type SetMaintenanceWindowsResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ListQueuedDeploysResponse struct {
+	Success       bool                        `json:"success"`
+	Error         string                      `json:"error,omitempty"`
+	QueuedDeploys []*maintenance.QueuedDeploy `json:"queuedDeploys"`
+}
+
+type QueuedDeployActionResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type DeployAppVersionRequest struct {
+	// Override deploys even when no maintenance window is open
+	Override bool `json:"override"`
+	// PreflightOverrideJustification deploys a version that the preflight gating policy blocks, and is
+	// stored in the audit trail
+	PreflightOverrideJustification string `json:"preflightOverrideJustification,omitempty"`
+}
+
+type DeployAppVersionResponse struct {
+	Success        bool                      `json:"success"`
+	Error          string                    `json:"error,omitempty"`
+	QueuedDeploy   *maintenance.QueuedDeploy `json:"queuedDeploy,omitempty"`
+	BlockedReasons []string                  `json:"blockedReasons,omitempty"`
+}
+
+func GetMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getMaintenanceWindowsResponse := GetMaintenanceWindowsResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getMaintenanceWindowsResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getMaintenanceWindowsResponse)
+		return
+	}
+
+	windows, err := maintenance.GetWindows(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		getMaintenanceWindowsResponse.Error = "failed to get maintenance windows"
+		JSON(w, 500, getMaintenanceWindowsResponse)
+		return
+	}
+
+	now := time.Now()
+	isOpen, err := windows.IsOpen(now)
+	if err != nil {
+		logger.Error(err)
+		getMaintenanceWindowsResponse.Error = "failed to check maintenance windows"
+		JSON(w, 500, getMaintenanceWindowsResponse)
+		return
+	}
+
+	if !isOpen {
+		nextOpen, err := windows.NextOpen(now)
+		if err != nil {
+			logger.Error(err)
+			getMaintenanceWindowsResponse.Error = "failed to find next maintenance window"
+			JSON(w, 500, getMaintenanceWindowsResponse)
+			return
+		}
+		getMaintenanceWindowsResponse.NextOpen = &nextOpen
+	}
+
+	getMaintenanceWindowsResponse.Success = true
+	getMaintenanceWindowsResponse.Windows = windows
+	getMaintenanceWindowsResponse.IsOpen = isOpen
+
+	JSON(w, 200, getMaintenanceWindowsResponse)
+}
+
+func SetMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	setMaintenanceWindowsResponse := SetMaintenanceWindowsResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	windows := maintenance.Windows{}
+	if err := json.NewDecoder(r.Body).Decode(&windows); err != nil {
+		logger.Error(err)
+		setMaintenanceWindowsResponse.Error = "failed to decode request body"
+		JSON(w, 400, setMaintenanceWindowsResponse)
+		return
+	}
+
+	if err := windows.Validate(); err != nil {
+		logger.Error(err)
+		setMaintenanceWindowsResponse.Error = err.Error()
+		JSON(w, 400, setMaintenanceWindowsResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		setMaintenanceWindowsResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, setMaintenanceWindowsResponse)
+		return
+	}
+
+	if err := maintenance.SetWindows(foundApp.ID, &windows); err != nil {
+		logger.Error(err)
+		setMaintenanceWindowsResponse.Error = "failed to set maintenance windows"
+		JSON(w, 500, setMaintenanceWindowsResponse)
+		return
+	}
+
+	setMaintenanceWindowsResponse.Success = true
+
+	JSON(w, 200, setMaintenanceWindowsResponse)
+}
+
+func ListQueuedDeploys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	listQueuedDeploysResponse := ListQueuedDeploysResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		listQueuedDeploysResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, listQueuedDeploysResponse)
+		return
+	}
+
+	includeCompleted, _ := strconv.ParseBool(r.URL.Query().Get("includeCompleted"))
+	queuedDeploys, err := maintenance.ListQueuedDeploys(foundApp.ID, includeCompleted)
+	if err != nil {
+		logger.Error(err)
+		listQueuedDeploysResponse.Error = "failed to list queued deploys"
+		JSON(w, 500, listQueuedDeploysResponse)
+		return
+	}
+
+	listQueuedDeploysResponse.Success = true
+	listQueuedDeploysResponse.QueuedDeploys = queuedDeploys
+
+	JSON(w, 200, listQueuedDeploysResponse)
+}
+
+// DeployQueuedDeploy is the admin override for a deploy that is waiting for a maintenance window
+func DeployQueuedDeploy(w http.ResponseWriter, r *http.Request) {
+	queuedDeployAction(w, r, maintenance.DeployQueued)
+}
+
+func CancelQueuedDeploy(w http.ResponseWriter, r *http.Request) {
+	queuedDeployAction(w, r, maintenance.CancelQueuedDeploy)
+}
+
+func queuedDeployAction(w http.ResponseWriter, r *http.Request, action func(appID string, id string) error) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	queuedDeployActionResponse := QueuedDeployActionResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		queuedDeployActionResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, queuedDeployActionResponse)
+		return
+	}
+
+	if err := action(foundApp.ID, mux.Vars(r)["queuedDeployId"]); err != nil {
+		logger.Error(err)
+		queuedDeployActionResponse.Error = errors.Cause(err).Error()
+		JSON(w, 500, queuedDeployActionResponse)
+		return
+	}
+
+	queuedDeployActionResponse.Success = true
+
+	JSON(w, 200, queuedDeployActionResponse)
+}
+
+// DeployAppVersion deploys a version, or queues it until the next maintenance window
+func DeployAppVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	deployAppVersionResponse := DeployAppVersionResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	deployAppVersionRequest := DeployAppVersionRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&deployAppVersionRequest); err != nil {
+			logger.Error(err)
+			deployAppVersionResponse.Error = "failed to decode request body"
+			JSON(w, 400, deployAppVersionResponse)
+			return
+		}
+	}
+
+	sequence, err := strconv.ParseInt(mux.Vars(r)["sequence"], 10, 64)
+	if err != nil {
+		logger.Error(err)
+		deployAppVersionResponse.Error = "failed to parse sequence number"
+		JSON(w, 400, deployAppVersionResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		deployAppVersionResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, deployAppVersionResponse)
+		return
+	}
+
+	var preflightOverride *preflightgate.Override
+	if deployAppVersionRequest.PreflightOverrideJustification != "" {
+		sess, err := session.Parse(r.Header.Get("Authorization"))
+		if err != nil {
+			logger.Error(err)
+			deployAppVersionResponse.Error = "failed to parse authorization header"
+			JSON(w, 401, deployAppVersionResponse)
+			return
+		}
+
+		preflightOverride = &preflightgate.Override{
+			Justification: deployAppVersionRequest.PreflightOverrideJustification,
+			UserID:        sess.UserID,
+		}
+		if err := preflightOverride.Validate(); err != nil {
+			deployAppVersionResponse.Error = err.Error()
+			JSON(w, 400, deployAppVersionResponse)
+			return
+		}
+	}
+
+	queuedDeploy, err := maintenance.RequestDeploy(foundApp.ID, sequence, "manual", deployAppVersionRequest.Override, preflightOverride)
+	if blockedErr, ok := err.(*preflightgate.BlockedError); ok {
+		deployAppVersionResponse.Error = blockedErr.Error()
+		deployAppVersionResponse.BlockedReasons = blockedErr.Decision.Reasons
+		JSON(w, 409, deployAppVersionResponse)
+		return
+	}
+	if err != nil {
+		logger.Error(err)
+		deployAppVersionResponse.Error = "failed to deploy version"
+		JSON(w, 500, deployAppVersionResponse)
+		return
+	}
+
+	deployAppVersionResponse.Success = true
+	deployAppVersionResponse.QueuedDeploy = queuedDeploy
+
+	JSON(w, 200, deployAppVersionResponse)
+}
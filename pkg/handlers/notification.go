@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/notification"
+)
+
+type ListNotificationsResponse struct {
+	Success       bool                         `json:"success"`
+	Error         string                       `json:"error,omitempty"`
+	Notifications []*notification.Notification `json:"notifications"`
+}
+
+type DismissNotificationResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+func ListNotifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	listNotificationsResponse := ListNotificationsResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		listNotificationsResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, listNotificationsResponse)
+		return
+	}
+
+	includeDismissed := r.URL.Query().Get("includeDismissed") == "true"
+	notifications, err := notification.List(foundApp.ID, includeDismissed)
+	if err != nil {
+		logger.Error(err)
+		listNotificationsResponse.Error = "failed to list notifications"
+		JSON(w, 500, listNotificationsResponse)
+		return
+	}
+
+	listNotificationsResponse.Success = true
+	listNotificationsResponse.Notifications = notifications
+	JSON(w, 200, listNotificationsResponse)
+}
+
+func DismissNotification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	dismissNotificationResponse := DismissNotificationResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		dismissNotificationResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, dismissNotificationResponse)
+		return
+	}
+
+	if err := notification.Dismiss(foundApp.ID, mux.Vars(r)["notificationId"]); err != nil {
+		logger.Error(err)
+		dismissNotificationResponse.Error = "failed to dismiss notification"
+		JSON(w, 500, dismissNotificationResponse)
+		return
+	}
+
+	dismissNotificationResponse.Success = true
+	JSON(w, 200, dismissNotificationResponse)
+}
@@ -58,7 +58,7 @@ func IgnorePreflightRBACErrors(w http.ResponseWriter, r *http.Request) {
 
 	go func() {
 		defer os.RemoveAll(archiveDir)
-		if err := preflight.Run(foundApp.ID, int64(sequence), archiveDir); err != nil {
+		if err := preflight.Run(foundApp.ID, int64(sequence), archiveDir, preflight.TriggerIgnoreRBAC); err != nil {
 			logger.Error(err)
 			return
 		}
@@ -99,7 +99,7 @@ func StartPreflightChecks(w http.ResponseWriter, r *http.Request) {
 
 	go func() {
 		defer os.RemoveAll(archiveDir)
-		if err := preflight.Run(foundApp.ID, foundApp.CurrentSequence, archiveDir); err != nil {
+		if err := preflight.Run(foundApp.ID, foundApp.CurrentSequence, archiveDir, preflight.TriggerManual); err != nil {
 			logger.Error(err)
 			return
 		}
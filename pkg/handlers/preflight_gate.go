@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/preflightgate"
+	"github.com/replicatedhq/kotsadm/pkg/session"
+)
+
+type GetPreflightGatingPolicyResponse struct {
+	Success bool                  `json:"success"`
+	Error   string                `json:"error,omitempty"`
+	Policy  *preflightgate.Policy `json:"policy,omitempty"`
+}
+
+type SetPreflightGatingPolicyResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type GetPreflightGateResponse struct {
+	Success  bool                    `json:"success"`
+	Error    string                  `json:"error,omitempty"`
+	Decision *preflightgate.Decision `json:"decision,omitempty"`
+}
+
+type ListPreflightGateEventsResponse struct {
+	Success bool                   `json:"success"`
+	Error   string                 `json:"error,omitempty"`
+	Events  []*preflightgate.Event `json:"events"`
+}
+
+func GetPreflightGatingPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getPreflightGatingPolicyResponse := GetPreflightGatingPolicyResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getPreflightGatingPolicyResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getPreflightGatingPolicyResponse)
+		return
+	}
+
+	policy, err := preflightgate.GetPolicy(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		getPreflightGatingPolicyResponse.Error = "failed to get preflight gating policy"
+		JSON(w, 500, getPreflightGatingPolicyResponse)
+		return
+	}
+
+	getPreflightGatingPolicyResponse.Success = true
+	getPreflightGatingPolicyResponse.Policy = policy
+	JSON(w, 200, getPreflightGatingPolicyResponse)
+}
+
+func SetPreflightGatingPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	setPreflightGatingPolicyResponse := SetPreflightGatingPolicyResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	policy := preflightgate.Policy{}
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		logger.Error(err)
+		setPreflightGatingPolicyResponse.Error = "failed to decode request body"
+		JSON(w, 400, setPreflightGatingPolicyResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		setPreflightGatingPolicyResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, setPreflightGatingPolicyResponse)
+		return
+	}
+
+	sess, err := session.Parse(r.Header.Get("Authorization"))
+	if err != nil {
+		logger.Error(err)
+		setPreflightGatingPolicyResponse.Error = "failed to parse authorization header"
+		JSON(w, 401, setPreflightGatingPolicyResponse)
+		return
+	}
+
+	if err := preflightgate.SetPolicy(foundApp.ID, &policy, sess.UserID); err != nil {
+		logger.Error(err)
+		setPreflightGatingPolicyResponse.Error = "failed to set preflight gating policy"
+		JSON(w, 500, setPreflightGatingPolicyResponse)
+		return
+	}
+
+	setPreflightGatingPolicyResponse.Success = true
+	JSON(w, 200, setPreflightGatingPolicyResponse)
+}
+
+// GetPreflightGate returns whether the preflight gating policy blocks deploying a sequence, so that the
+// justification for an override can be asked for before deploying
+func GetPreflightGate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getPreflightGateResponse := GetPreflightGateResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	sequence, err := strconv.ParseInt(mux.Vars(r)["sequence"], 10, 64)
+	if err != nil {
+		logger.Error(err)
+		getPreflightGateResponse.Error = "failed to parse sequence number"
+		JSON(w, 400, getPreflightGateResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getPreflightGateResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getPreflightGateResponse)
+		return
+	}
+
+	decision, err := preflightgate.Evaluate(foundApp.ID, sequence)
+	if err != nil {
+		logger.Error(err)
+		getPreflightGateResponse.Error = "failed to evaluate preflight gating policy"
+		JSON(w, 500, getPreflightGateResponse)
+		return
+	}
+
+	getPreflightGateResponse.Success = true
+	getPreflightGateResponse.Decision = decision
+	JSON(w, 200, getPreflightGateResponse)
+}
+
+// ListPreflightGateEvents returns the audit trail of deploys that the preflight gating policy blocked, of
+// overrides with their justification, and of changes to the policy
+func ListPreflightGateEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	listPreflightGateEventsResponse := ListPreflightGateEventsResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		listPreflightGateEventsResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, listPreflightGateEventsResponse)
+		return
+	}
+
+	events, err := preflightgate.ListEvents(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		listPreflightGateEventsResponse.Error = "failed to list preflight gate events"
+		JSON(w, 500, listPreflightGateEventsResponse)
+		return
+	}
+
+	listPreflightGateEventsResponse.Success = true
+	listPreflightGateEventsResponse.Events = events
+	JSON(w, 200, listPreflightGateEventsResponse)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/preflight"
+)
+
+type ListPreflightRunsResponse struct {
+	Success bool                      `json:"success"`
+	Error   string                    `json:"error,omitempty"`
+	Runs    []*preflight.PreflightRun `json:"runs"`
+}
+
+type GetPreflightRunResponse struct {
+	Success bool                    `json:"success"`
+	Error   string                  `json:"error,omitempty"`
+	Run     *preflight.PreflightRun `json:"run,omitempty"`
+}
+
+type DiffPreflightRunsResponse struct {
+	Success bool                        `json:"success"`
+	Error   string                      `json:"error,omitempty"`
+	Diff    *preflight.PreflightRunDiff `json:"diff,omitempty"`
+}
+
+// ListPreflightRuns lists the preflight runs of an app, optionally only those of the sequence query param
+func ListPreflightRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	listPreflightRunsResponse := ListPreflightRunsResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	var sequence *int64
+	if sequenceStr := r.URL.Query().Get("sequence"); sequenceStr != "" {
+		s, err := strconv.ParseInt(sequenceStr, 10, 64)
+		if err != nil {
+			logger.Error(err)
+			listPreflightRunsResponse.Error = "failed to parse sequence"
+			JSON(w, 400, listPreflightRunsResponse)
+			return
+		}
+		sequence = &s
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		listPreflightRunsResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, listPreflightRunsResponse)
+		return
+	}
+
+	runs, err := preflight.ListRuns(foundApp.ID, sequence)
+	if err != nil {
+		logger.Error(err)
+		listPreflightRunsResponse.Error = "failed to list preflight runs"
+		JSON(w, 500, listPreflightRunsResponse)
+		return
+	}
+
+	listPreflightRunsResponse.Success = true
+	listPreflightRunsResponse.Runs = runs
+	JSON(w, 200, listPreflightRunsResponse)
+}
+
+func GetPreflightRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getPreflightRunResponse := GetPreflightRunResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getPreflightRunResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getPreflightRunResponse)
+		return
+	}
+
+	run, err := preflight.GetRun(foundApp.ID, mux.Vars(r)["runId"])
+	if errors.Cause(err) == sql.ErrNoRows {
+		getPreflightRunResponse.Error = "preflight run not found"
+		JSON(w, 404, getPreflightRunResponse)
+		return
+	}
+	if err != nil {
+		logger.Error(err)
+		getPreflightRunResponse.Error = "failed to get preflight run"
+		JSON(w, 500, getPreflightRunResponse)
+		return
+	}
+
+	getPreflightRunResponse.Success = true
+	getPreflightRunResponse.Run = run
+	JSON(w, 200, getPreflightRunResponse)
+}
+
+// DiffPreflightRuns compares the checks of the runs in the from and to query params. Without to, the newest
+// run is used, and without from, the last run before it that had no failing checks
+func DiffPreflightRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	diffPreflightRunsResponse := DiffPreflightRunsResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		diffPreflightRunsResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, diffPreflightRunsResponse)
+		return
+	}
+
+	var toRun *preflight.PreflightRun
+	if toID := r.URL.Query().Get("to"); toID != "" {
+		toRun, err = preflight.GetRun(foundApp.ID, toID)
+	} else {
+		var runs []*preflight.PreflightRun
+		runs, err = preflight.ListRuns(foundApp.ID, nil)
+		if err == nil && len(runs) > 0 {
+			toRun = runs[0]
+		}
+	}
+	if errors.Cause(err) == sql.ErrNoRows || (err == nil && toRun == nil) {
+		diffPreflightRunsResponse.Error = "preflight run to compare not found"
+		JSON(w, 404, diffPreflightRunsResponse)
+		return
+	}
+	if err != nil {
+		logger.Error(err)
+		diffPreflightRunsResponse.Error = "failed to get preflight run to compare"
+		JSON(w, 500, diffPreflightRunsResponse)
+		return
+	}
+
+	var fromRun *preflight.PreflightRun
+	if fromID := r.URL.Query().Get("from"); fromID != "" {
+		fromRun, err = preflight.GetRun(foundApp.ID, fromID)
+	} else {
+		fromRun, err = preflight.GetLastPassingRun(foundApp.ID, toRun)
+	}
+	if errors.Cause(err) == sql.ErrNoRows || (err == nil && fromRun == nil) {
+		diffPreflightRunsResponse.Error = "preflight run to compare with not found"
+		JSON(w, 404, diffPreflightRunsResponse)
+		return
+	}
+	if err != nil {
+		logger.Error(err)
+		diffPreflightRunsResponse.Error = "failed to get preflight run to compare with"
+		JSON(w, 500, diffPreflightRunsResponse)
+		return
+	}
+
+	diffPreflightRunsResponse.Success = true
+	diffPreflightRunsResponse.Diff = preflight.DiffRuns(fromRun, toRun)
+	JSON(w, 200, diffPreflightRunsResponse)
+}
@@ -27,6 +27,18 @@ type UpdateAppRegistryResponse struct {
 	Namespace string `json:"namespace"`
 }
 
+type TestAppRegistryRequest struct {
+	Hostname  string `json:"hostname"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Namespace string `json:"namespace"`
+}
+
+type TestAppRegistryResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
 func UpdateAppRegistry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
@@ -86,11 +98,6 @@ func UpdateAppRegistry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updateAppRegistryResponse.Hostname = updateAppRegistryRequest.Hostname
-	updateAppRegistryResponse.Username = updateAppRegistryRequest.Username
-	updateAppRegistryResponse.Namespace = updateAppRegistryRequest.Namespace
-
-	// if hostname and namespace have not changed, we don't need to re-push
 	registrySettings, err := registry.GetRegistrySettingsForApp(foundApp.ID)
 	if err != nil {
 		logger.Error(err)
@@ -99,6 +106,29 @@ func UpdateAppRegistry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the ui sends the mask back when the password field was not edited
+	password, err := registry.ResolvePassword(registrySettings, updateAppRegistryRequest.Password)
+	if err != nil {
+		logger.Error(err)
+		updateAppRegistryResponse.Error = err.Error()
+		JSON(w, 500, updateAppRegistryResponse)
+		return
+	}
+	updateAppRegistryRequest.Password = password
+
+	// catch typos in the hostname or credentials before images are pushed
+	if err := registry.CheckRegistryAccess(updateAppRegistryRequest.Hostname, updateAppRegistryRequest.Username, updateAppRegistryRequest.Password, updateAppRegistryRequest.Namespace); err != nil {
+		logger.Error(err)
+		updateAppRegistryResponse.Error = err.Error()
+		JSON(w, 400, updateAppRegistryResponse)
+		return
+	}
+
+	updateAppRegistryResponse.Hostname = updateAppRegistryRequest.Hostname
+	updateAppRegistryResponse.Username = updateAppRegistryRequest.Username
+	updateAppRegistryResponse.Namespace = updateAppRegistryRequest.Namespace
+
+	// if hostname and namespace have not changed, we don't need to re-push
 	if registrySettings != nil {
 		if registrySettings.Hostname == updateAppRegistryRequest.Hostname {
 			if registrySettings.Namespace == updateAppRegistryRequest.Namespace {
@@ -138,6 +168,68 @@ func UpdateAppRegistry(w http.ResponseWriter, r *http.Request) {
 	JSON(w, 200, updateAppRegistryResponse)
 }
 
+// TestAppRegistry checks that the registry settings in the request can be used to push images, without saving them
+func TestAppRegistry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	testAppRegistryResponse := TestAppRegistryResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	testAppRegistryRequest := TestAppRegistryRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&testAppRegistryRequest); err != nil {
+		logger.Error(err)
+		testAppRegistryResponse.Error = "failed to decode request body"
+		JSON(w, 400, testAppRegistryResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		testAppRegistryResponse.Error = "failed to get app"
+		JSON(w, 404, testAppRegistryResponse)
+		return
+	}
+
+	registrySettings, err := registry.GetRegistrySettingsForApp(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		testAppRegistryResponse.Error = "failed to get registry settings"
+		JSON(w, 500, testAppRegistryResponse)
+		return
+	}
+
+	password, err := registry.ResolvePassword(registrySettings, testAppRegistryRequest.Password)
+	if err != nil {
+		logger.Error(err)
+		testAppRegistryResponse.Error = "failed to decrypt registry password"
+		JSON(w, 500, testAppRegistryResponse)
+		return
+	}
+	testAppRegistryRequest.Password = password
+
+	if err := registry.CheckRegistryAccess(testAppRegistryRequest.Hostname, testAppRegistryRequest.Username, testAppRegistryRequest.Password, testAppRegistryRequest.Namespace); err != nil {
+		testAppRegistryResponse.Error = err.Error()
+		JSON(w, 200, testAppRegistryResponse)
+		return
+	}
+
+	testAppRegistryResponse.Success = true
+	JSON(w, 200, testAppRegistryResponse)
+}
+
 func GetAppRegistry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/registry"
+)
+
+type GarbageCollectImagesResponse struct {
+	Success bool               `json:"success"`
+	Error   string             `json:"error,omitempty"`
+	Report  *registry.GCReport `json:"report,omitempty"`
+}
+
+// GarbageCollectImages reports the images in the app registry namespace that are no longer referenced on GET,
+// and deletes them on POST. The retainPrevious query param sets how many versions before the deployed one are kept
+func GarbageCollectImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	garbageCollectImagesResponse := GarbageCollectImagesResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	retainPrevious := registry.DefaultGCRetainPrevious
+	if r.URL.Query().Get("retainPrevious") != "" {
+		n, err := strconv.Atoi(r.URL.Query().Get("retainPrevious"))
+		if err != nil || n < 0 {
+			garbageCollectImagesResponse.Error = "retainPrevious must be a non-negative number"
+			JSON(w, 400, garbageCollectImagesResponse)
+			return
+		}
+		retainPrevious = n
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		garbageCollectImagesResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, garbageCollectImagesResponse)
+		return
+	}
+
+	dryRun := r.Method != "POST"
+	report, err := registry.GarbageCollectImages(foundApp.ID, retainPrevious, dryRun)
+	if err != nil {
+		logger.Error(err)
+		garbageCollectImagesResponse.Error = errors.Cause(err).Error()
+		JSON(w, 500, garbageCollectImagesResponse)
+		return
+	}
+
+	garbageCollectImagesResponse.Success = true
+	garbageCollectImagesResponse.Report = report
+	JSON(w, 200, garbageCollectImagesResponse)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/registry"
+)
+
+type ListRegistryTLSResponse struct {
+	Success    bool                    `json:"success"`
+	Error      string                  `json:"error,omitempty"`
+	Registries []*registry.RegistryTLS `json:"registries"`
+}
+
+type SetRegistryTLSRequest struct {
+	Hostname string `json:"hostname"`
+	CACert   string `json:"caCert"`
+	Insecure bool   `json:"insecure"`
+}
+
+type SetRegistryTLSResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+func ListRegistryTLS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	listRegistryTLSResponse := ListRegistryTLSResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	registries, err := registry.ListRegistryTLS()
+	if err != nil {
+		logger.Error(err)
+		listRegistryTLSResponse.Error = "failed to list registry tls settings"
+		JSON(w, 500, listRegistryTLSResponse)
+		return
+	}
+
+	listRegistryTLSResponse.Success = true
+	listRegistryTLSResponse.Registries = registries
+	JSON(w, 200, listRegistryTLSResponse)
+}
+
+// SetRegistryTLS saves the CA certificates and insecure opt-in for a registry hostname
+func SetRegistryTLS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	setRegistryTLSResponse := SetRegistryTLSResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	setRegistryTLSRequest := SetRegistryTLSRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&setRegistryTLSRequest); err != nil {
+		logger.Error(err)
+		setRegistryTLSResponse.Error = "failed to decode request body"
+		JSON(w, 400, setRegistryTLSResponse)
+		return
+	}
+
+	if setRegistryTLSRequest.Hostname == "" {
+		setRegistryTLSResponse.Error = "hostname is required"
+		JSON(w, 400, setRegistryTLSResponse)
+		return
+	}
+
+	if err := registry.SetRegistryTLS(setRegistryTLSRequest.Hostname, setRegistryTLSRequest.CACert, setRegistryTLSRequest.Insecure); err != nil {
+		logger.Error(err)
+		setRegistryTLSResponse.Error = errors.Cause(err).Error()
+		JSON(w, 400, setRegistryTLSResponse)
+		return
+	}
+
+	setRegistryTLSResponse.Success = true
+	JSON(w, 200, setRegistryTLSResponse)
+}
+
+func DeleteRegistryTLS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	deleteRegistryTLSResponse := SetRegistryTLSResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	if err := registry.DeleteRegistryTLS(mux.Vars(r)["hostname"]); err != nil {
+		logger.Error(err)
+		deleteRegistryTLSResponse.Error = "failed to delete registry tls settings"
+		JSON(w, 500, deleteRegistryTLSResponse)
+		return
+	}
+
+	deleteRegistryTLSResponse.Success = true
+	JSON(w, 200, deleteRegistryTLSResponse)
+}
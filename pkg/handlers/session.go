@@ -35,6 +35,21 @@ func requireValidSession(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// isConsoleSession returns true when the request is made by a user that logged in to the admin console.
+// There are no roles, so every console session counts as an admin. The kots cli token is a valid session
+// too, but it can't make admin decisions
+func isConsoleSession(r *http.Request) bool {
+	sess, err := session.Parse(r.Header.Get("Authorization"))
+	if err != nil {
+		logger.Error(err)
+		return false
+	}
+	if sess == nil || sess.ID == "" {
+		return false
+	}
+	return sess.UserID != "kots-cli"
+}
+
 func requireValidKOTSToken(w http.ResponseWriter, r *http.Request) error {
 	if r.Header.Get("Authorization") == "" {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -43,20 +58,24 @@ func requireValidKOTSToken(w http.ResponseWriter, r *http.Request) error {
 
 	config, err := rest.InClusterConfig()
 	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		return errors.Wrap(err, "failed to get in cluster config")
 	}
 
 	client, err := kubernetes.NewForConfig(config)
 	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		return errors.Wrap(err, "Failed to create kubernetes clientset")
 	}
 
 	secret, err := client.CoreV1().Secrets(os.Getenv("POD_NAMESPACE")).Get("kotsadm-authstring", metav1.GetOptions{})
 	if kuberneteserrors.IsNotFound(err) {
+		w.WriteHeader(http.StatusUnauthorized)
 		return errors.New("no authstring found in cluster")
 	}
 
 	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		return errors.Wrap(err, "failed to read auth string")
 	}
 
@@ -64,5 +83,6 @@ func requireValidKOTSToken(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
+	w.WriteHeader(http.StatusUnauthorized)
 	return errors.New("invalid auth")
 }
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/registry"
+	registrytypes "github.com/replicatedhq/kotsadm/pkg/registry/types"
+	"github.com/replicatedhq/kotsadm/pkg/render"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+)
+
+// templateFilename is the name that template errors are reported against
+const templateFilename = "template"
+
+type RenderAppTemplateRequest struct {
+	Template     string                     `json:"template"`
+	ConfigGroups []*kotsv1beta1.ConfigGroup `json:"configGroups,omitempty"`
+}
+
+type RenderAppTemplateResponse struct {
+	Success       bool                  `json:"success"`
+	Error         string                `json:"error,omitempty"`
+	Output        string                `json:"output"`
+	TemplateError *render.TemplateError `json:"templateError,omitempty"`
+}
+
+// RenderAppTemplate renders arbitrary template text with the config values, license, registry settings and
+// installation of a sequence. Config groups in the request are applied to the config values first, without
+// storing them. The text is rendered as is, so the positions of template errors match the request.
+// Any session can render, so passwords and the registry password are masked and secret references are not resolved
+func RenderAppTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	renderAppTemplateResponse := RenderAppTemplateResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	renderAppTemplateRequest := RenderAppTemplateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&renderAppTemplateRequest); err != nil {
+		logger.Error(err)
+		renderAppTemplateResponse.Error = "failed to decode request body"
+		JSON(w, 400, renderAppTemplateResponse)
+		return
+	}
+
+	sequence, err := strconv.ParseInt(mux.Vars(r)["sequence"], 10, 64)
+	if err != nil {
+		logger.Error(err)
+		renderAppTemplateResponse.Error = "failed to parse sequence"
+		JSON(w, 400, renderAppTemplateResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		renderAppTemplateResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, renderAppTemplateResponse)
+		return
+	}
+
+	output, err := renderAppTemplate(foundApp, sequence, renderAppTemplateRequest)
+	if templateErr, ok := errors.Cause(err).(*render.TemplateError); ok {
+		renderAppTemplateResponse.Error = templateErr.Error()
+		renderAppTemplateResponse.TemplateError = templateErr
+		JSON(w, 400, renderAppTemplateResponse)
+		return
+	}
+	if err != nil {
+		logger.Error(err)
+		renderAppTemplateResponse.Error = errors.Cause(err).Error()
+		JSON(w, 500, renderAppTemplateResponse)
+		return
+	}
+
+	renderAppTemplateResponse.Success = true
+	renderAppTemplateResponse.Output = string(output)
+	JSON(w, 200, renderAppTemplateResponse)
+}
+
+func renderAppTemplate(a *app.App, sequence int64, req RenderAppTemplateRequest) ([]byte, error) {
+	archiveDir, err := version.GetAppVersionArchive(a.ID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get app version archive")
+	}
+	defer os.RemoveAll(archiveDir)
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load kots kinds from path")
+	}
+
+	registrySettings, err := registry.GetRegistrySettingsForApp(a.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get registry settings")
+	}
+
+	return renderTemplateMasked(kotsKinds, registrySettings, req)
+}
+
+func renderTemplateMasked(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.RegistrySettings, req RenderAppTemplateRequest) ([]byte, error) {
+	if len(req.ConfigGroups) > 0 {
+		if kotsKinds.ConfigValues == nil {
+			return nil, errors.New("no config values found")
+		}
+		values, err := updatedConfigValues(kotsKinds, req.ConfigGroups)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to update config values")
+		}
+		kotsKinds.ConfigValues.Spec.Values = values
+	}
+
+	rendered, err := render.RenderNamedFileMasked(kotsKinds, registrySettings, templateFilename, []byte(req.Template))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render template")
+	}
+
+	return rendered, nil
+}
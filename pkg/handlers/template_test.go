@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/kotskinds/multitype"
+	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	registrytypes "github.com/replicatedhq/kotsadm/pkg/registry/types"
+	"github.com/replicatedhq/kotsadm/pkg/render"
+	"github.com/replicatedhq/kotsadm/pkg/secretprovider"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_RenderAppTemplate(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		expectedCode int
+	}{
+		{
+			name:         "preflight request",
+			method:       "OPTIONS",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "no session",
+			method:       "POST",
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			r := httptest.NewRequest(test.method, "/api/v1/app/my-app/sequence/0/template", strings.NewReader(`{"template": "{{repl ConfigOption \"db_password\"}}"}`))
+			w := httptest.NewRecorder()
+
+			RenderAppTemplate(w, r)
+			req.Equal(test.expectedCode, w.Code)
+		})
+	}
+}
+
+func Test_renderTemplateMasked(t *testing.T) {
+	provider := secretprovider.NewMemoryProvider()
+	provider.SetSecret("secret/data/myapp", "api_key", "abc123")
+	secretprovider.SetProvider("vault", provider)
+	defer secretprovider.SetProvider("vault", &secretprovider.VaultProvider{})
+
+	appCipher, err := crypto.NewAESCipher()
+	require.NoError(t, err)
+
+	newKotsKinds := func() *kotsutil.KotsKinds {
+		return &kotsutil.KotsKinds{
+			Installation: kotsv1beta1.Installation{
+				Spec: kotsv1beta1.InstallationSpec{EncryptionKey: appCipher.ToString()},
+			},
+			License: &kotsv1beta1.License{},
+			Config: &kotsv1beta1.Config{
+				Spec: kotsv1beta1.ConfigSpec{
+					Groups: []kotsv1beta1.ConfigGroup{
+						{
+							Name: "settings",
+							Items: []kotsv1beta1.ConfigItem{
+								{Name: "db_host", Type: "text"},
+								{Name: "db_password", Type: "password"},
+								{Name: "api_key", Type: "text"},
+							},
+						},
+					},
+				},
+			},
+			ConfigValues: &kotsv1beta1.ConfigValues{
+				Spec: kotsv1beta1.ConfigValuesSpec{
+					Values: map[string]kotsv1beta1.ConfigValue{
+						"db_host":     {Value: "postgres"},
+						"db_password": {Value: base64.StdEncoding.EncodeToString(appCipher.Encrypt([]byte("hunter2")))},
+						"api_key":     {Value: "vault://secret/data/myapp#api_key"},
+					},
+				},
+			},
+		}
+	}
+
+	// the registry password is not decrypted, so an invalid one doesn't fail the render
+	registrySettings := &registrytypes.RegistrySettings{
+		Hostname:    "registry.example.com",
+		Username:    "admin",
+		PasswordEnc: "not-encrypted",
+		Namespace:   "app",
+	}
+
+	tests := []struct {
+		name        string
+		request     RenderAppTemplateRequest
+		expected    string
+		notExpected []string
+	}{
+		{
+			name: "text item",
+			request: RenderAppTemplateRequest{
+				Template: `host={{repl ConfigOption "db_host"}}`,
+			},
+			expected: "host=postgres",
+		},
+		{
+			name: "stored password",
+			request: RenderAppTemplateRequest{
+				Template: `password={{repl ConfigOption "db_password"}}`,
+			},
+			expected:    "password=" + render.MaskedValue,
+			notExpected: []string{"hunter2"},
+		},
+		{
+			name: "secret reference",
+			request: RenderAppTemplateRequest{
+				Template: `key={{repl ConfigOption "api_key"}}`,
+			},
+			expected:    "key=vault://secret/data/myapp#api_key",
+			notExpected: []string{"abc123"},
+		},
+		{
+			name: "password from the request",
+			request: RenderAppTemplateRequest{
+				Template: `password={{repl ConfigOption "db_password"}}`,
+				ConfigGroups: []*kotsv1beta1.ConfigGroup{
+					{
+						Name: "settings",
+						Items: []kotsv1beta1.ConfigItem{
+							{Name: "db_password", Type: "text", Value: multitype.BoolOrString{Type: multitype.String, StrVal: "letmein"}},
+						},
+					},
+				},
+			},
+			expected:    "password=" + render.MaskedValue,
+			notExpected: []string{"letmein"},
+		},
+		{
+			name: "registry",
+			request: RenderAppTemplateRequest{
+				Template: `registry={{repl LocalRegistryHost}}`,
+			},
+			expected: "registry=registry.example.com",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			output, err := renderTemplateMasked(newKotsKinds(), registrySettings, test.request)
+			req.NoError(err)
+			req.Equal(test.expected, string(output))
+			for _, notExpected := range test.notExpected {
+				req.NotContains(string(output), notExpected)
+			}
+		})
+	}
+}
@@ -1,23 +1,16 @@
 package handlers
 
 import (
-	"fmt"
+	"encoding/json"
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
-	kotspull "github.com/replicatedhq/kots/pkg/pull"
 	"github.com/replicatedhq/kots/pkg/util"
 	"github.com/replicatedhq/kotsadm/pkg/app"
-	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
-	"github.com/replicatedhq/kotsadm/pkg/license"
 	"github.com/replicatedhq/kotsadm/pkg/logger"
 	"github.com/replicatedhq/kotsadm/pkg/session"
-	"github.com/replicatedhq/kotsadm/pkg/task"
-	"github.com/replicatedhq/kotsadm/pkg/upstream"
-	"github.com/replicatedhq/kotsadm/pkg/version"
+	"github.com/replicatedhq/kotsadm/pkg/updatechecker"
 )
 
 type AppUpdateCheckRequest struct {
@@ -27,6 +20,8 @@ type AppUpdateCheckResponse struct {
 	AvailableUpdates int64 `json:"availableUpdates"`
 }
 
+// AppUpdateCheck checks for updates and downloads every available update, unless the update check schedule of the
+// app selects updates. Then the updates are only listed, and ListAvailableUpdates and DownloadUpdate let the user pick one
 func AppUpdateCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
@@ -56,108 +51,132 @@ func AppUpdateCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentStatus, err := task.GetTaskStatus("update-download")
+	availableUpdates, err := updatechecker.CheckForUpdates(foundApp.ID)
 	if err != nil {
 		logger.Error(err)
-		w.WriteHeader(500)
+		cause := errors.Cause(err)
+		if _, ok := cause.(util.ActionableError); ok {
+			w.WriteHeader(500)
+			w.Write([]byte(cause.Error()))
+		} else {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		}
 		return
 	}
 
 	appUpdateCheckResponse := AppUpdateCheckResponse{
-		AvailableUpdates: 0,
+		AvailableUpdates: availableUpdates,
 	}
 
-	if currentStatus == "running" {
-		logger.Debug("update-download is already running, not starting a new one")
-		JSON(w, 200, appUpdateCheckResponse)
+	JSON(w, 200, appUpdateCheckResponse)
+}
+
+type ListAvailableUpdatesResponse struct {
+	Success bool                            `json:"success"`
+	Error   string                          `json:"error,omitempty"`
+	Updates []updatechecker.AvailableUpdate `json:"updates"`
+}
+
+type DownloadUpdateRequest struct {
+	Cursor string `json:"cursor"`
+}
+
+type DownloadUpdateResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ListAvailableUpdates lists the releases that can be downloaded, without downloading them
+func ListAvailableUpdates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
 		return
 	}
 
-	if err := task.ClearTaskStatus("update-download"); err != nil {
-		logger.Error(err)
-		w.WriteHeader(500)
-		return
+	listAvailableUpdatesResponse := ListAvailableUpdatesResponse{
+		Success: false,
 	}
 
-	// sync license, this method is only called when online
-	_, err = license.Sync(foundApp, "")
-	if err != nil {
+	if err := requireValidSession(w, r); err != nil {
 		logger.Error(err)
-		w.WriteHeader(500)
 		return
 	}
 
-	// reload app because license sync could have created a new release
-	foundApp, err = app.Get(foundApp.ID)
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
 	if err != nil {
 		logger.Error(err)
-		w.WriteHeader(500)
+		listAvailableUpdatesResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, listAvailableUpdatesResponse)
 		return
 	}
 
-	// download the app
-	archiveDir, err := version.GetAppVersionArchive(foundApp.ID, foundApp.CurrentSequence)
+	updates, err := updatechecker.ListAvailableUpdates(foundApp.ID)
 	if err != nil {
 		logger.Error(err)
-		w.WriteHeader(500)
+		listAvailableUpdatesResponse.Error = errors.Cause(err).Error()
+		JSON(w, 500, listAvailableUpdatesResponse)
 		return
 	}
 
-	// we need a few objects from the app to check for updates
-	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
-	if err != nil {
-		logger.Error(err)
-		w.WriteHeader(500)
+	listAvailableUpdatesResponse.Success = true
+	listAvailableUpdatesResponse.Updates = updates
+
+	JSON(w, 200, listAvailableUpdatesResponse)
+}
+
+// DownloadUpdate downloads the one release at the requested cursor
+func DownloadUpdate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
 		return
 	}
 
-	getUpdatesOptions := kotspull.GetUpdatesOptions{
-		LicenseFile:    filepath.Join(archiveDir, "upstream", "userdata", "license.yaml"),
-		CurrentCursor:  kotsKinds.Installation.Spec.UpdateCursor,
-		CurrentChannel: kotsKinds.Installation.Spec.ChannelName,
-		Silent:         false,
+	downloadUpdateResponse := DownloadUpdateResponse{
+		Success: false,
 	}
 
-	updates, err := kotspull.GetUpdates(fmt.Sprintf("replicated://%s", kotsKinds.License.Spec.AppSlug), getUpdatesOptions)
-	if err != nil {
+	if err := requireValidSession(w, r); err != nil {
 		logger.Error(err)
-		cause := errors.Cause(err)
-		if _, ok := cause.(util.ActionableError); ok {
-			w.WriteHeader(500)
-			w.Write([]byte(cause.Error()))
-		} else {
-			w.WriteHeader(500)
-			w.Write([]byte(err.Error()))
-		}
 		return
 	}
 
-	// update last updated at time
-	t := app.LastUpdateAtTime(foundApp.ID)
-	if t != nil {
-		logger.Error(t)
-		w.WriteHeader(500)
+	downloadUpdateRequest := DownloadUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&downloadUpdateRequest); err != nil {
+		logger.Error(err)
+		downloadUpdateResponse.Error = "failed to decode request body"
+		JSON(w, 400, downloadUpdateResponse)
 		return
 	}
 
-	// if there are updates, go routine it
-	if len(updates) == 0 {
-		JSON(w, 200, appUpdateCheckResponse)
+	if downloadUpdateRequest.Cursor == "" {
+		downloadUpdateResponse.Error = "cursor is required"
+		JSON(w, 400, downloadUpdateResponse)
 		return
 	}
 
-	appUpdateCheckResponse.AvailableUpdates = int64(len(updates))
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		downloadUpdateResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, downloadUpdateResponse)
+		return
+	}
 
-	go func() {
-		defer os.RemoveAll(archiveDir)
-		for _, update := range updates {
-			// the latest version is in archive dir
-			if err := upstream.DownloadUpdate(foundApp.ID, archiveDir, update.Cursor); err != nil {
-				logger.Error(err)
-			}
+	if err := updatechecker.DownloadAvailableUpdate(foundApp.ID, downloadUpdateRequest.Cursor); err != nil {
+		logger.Error(err)
+		downloadUpdateResponse.Error = errors.Cause(err).Error()
+		JSON(w, 500, downloadUpdateResponse)
+		return
+	}
 
-		}
-	}()
+	downloadUpdateResponse.Success = true
 
-	JSON(w, 200, appUpdateCheckResponse)
+	JSON(w, 200, downloadUpdateResponse)
 }
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/updatechecker"
+)
+
+type GetUpdateCheckScheduleResponse struct {
+	Success             bool                               `json:"success"`
+	Error               string                             `json:"error,omitempty"`
+	UpdateCheckSchedule *updatechecker.UpdateCheckSchedule `json:"updateCheckSchedule,omitempty"`
+	NextCheckAt         *time.Time                         `json:"nextCheckAt,omitempty"`
+}
+
+type SetUpdateCheckScheduleRequest struct {
+	Schedule      string `json:"schedule"`
+	JitterSeconds int64  `json:"jitterSeconds"`
+	SelectUpdates bool   `json:"selectUpdates"`
+}
+
+type SetUpdateCheckScheduleResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+func GetUpdateCheckSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	getUpdateCheckScheduleResponse := GetUpdateCheckScheduleResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		getUpdateCheckScheduleResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, getUpdateCheckScheduleResponse)
+		return
+	}
+
+	updateCheckSchedule, err := updatechecker.GetSchedule(foundApp.ID)
+	if err != nil {
+		logger.Error(err)
+		getUpdateCheckScheduleResponse.Error = "failed to get update check schedule"
+		JSON(w, 500, getUpdateCheckScheduleResponse)
+		return
+	}
+
+	getUpdateCheckScheduleResponse.Success = true
+	getUpdateCheckScheduleResponse.UpdateCheckSchedule = updateCheckSchedule
+	getUpdateCheckScheduleResponse.NextCheckAt = updatechecker.NextCheckAt(foundApp.ID)
+
+	JSON(w, 200, getUpdateCheckScheduleResponse)
+}
+
+func SetUpdateCheckSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "content-type, origin, accept, authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(200)
+		return
+	}
+
+	setUpdateCheckScheduleResponse := SetUpdateCheckScheduleResponse{
+		Success: false,
+	}
+
+	if err := requireValidSession(w, r); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	setUpdateCheckScheduleRequest := SetUpdateCheckScheduleRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&setUpdateCheckScheduleRequest); err != nil {
+		logger.Error(err)
+		setUpdateCheckScheduleResponse.Error = "failed to decode request body"
+		JSON(w, 400, setUpdateCheckScheduleResponse)
+		return
+	}
+
+	foundApp, err := app.GetFromSlug(mux.Vars(r)["appSlug"])
+	if err != nil {
+		logger.Error(err)
+		setUpdateCheckScheduleResponse.Error = "failed to get app from app slug"
+		JSON(w, 500, setUpdateCheckScheduleResponse)
+		return
+	}
+
+	if foundApp.IsAirgap && setUpdateCheckScheduleRequest.Schedule != "" {
+		setUpdateCheckScheduleResponse.Error = "airgap apps can't check for updates"
+		JSON(w, 400, setUpdateCheckScheduleResponse)
+		return
+	}
+
+	if setUpdateCheckScheduleRequest.Schedule != "" {
+		if _, err := updatechecker.ParseCron(setUpdateCheckScheduleRequest.Schedule); err != nil {
+			logger.Error(err)
+			setUpdateCheckScheduleResponse.Error = errors.Wrap(err, "invalid schedule").Error()
+			JSON(w, 400, setUpdateCheckScheduleResponse)
+			return
+		}
+	}
+
+	if err := updatechecker.SetSchedule(foundApp.ID, setUpdateCheckScheduleRequest.Schedule, setUpdateCheckScheduleRequest.JitterSeconds, setUpdateCheckScheduleRequest.SelectUpdates); err != nil {
+		logger.Error(err)
+		setUpdateCheckScheduleResponse.Error = errors.Cause(err).Error()
+		JSON(w, 500, setUpdateCheckScheduleResponse)
+		return
+	}
+
+	setUpdateCheckScheduleResponse.Success = true
+
+	JSON(w, 200, setUpdateCheckScheduleResponse)
+}
@@ -116,7 +116,7 @@ func UploadExistingApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := preflight.Run(a.ID, newSequence, archiveDir); err != nil {
+	if err := preflight.Run(a.ID, newSequence, archiveDir, preflight.TriggerUpload); err != nil {
 		logger.Error(err)
 		w.WriteHeader(500)
 		return
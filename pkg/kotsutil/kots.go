@@ -384,6 +384,10 @@ func LoadConfigValuesFromFile(configValuesFilePath string) (*kotsv1beta1.ConfigV
 		return nil, errors.Wrap(err, "failed to read configvalues file")
 	}
 
+	return LoadConfigValuesFromContents(configValuesData)
+}
+
+func LoadConfigValuesFromContents(configValuesData []byte) (*kotsv1beta1.ConfigValues, error) {
 	decode := scheme.Codecs.UniversalDeserializer().Decode
 	obj, gvk, err := decode([]byte(configValuesData), nil, nil)
 	if err != nil {
@@ -397,6 +401,20 @@ func LoadConfigValuesFromFile(configValuesFilePath string) (*kotsv1beta1.ConfigV
 	return obj.(*kotsv1beta1.ConfigValues), nil
 }
 
+func LoadConfigFromContents(content []byte) (*kotsv1beta1.Config, error) {
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, gvk, err := decode(content, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode config data")
+	}
+
+	if gvk.Group != "kots.io" || gvk.Version != "v1beta1" || gvk.Kind != "Config" {
+		return nil, errors.Errorf("unexpected GVK: %s", gvk.String())
+	}
+
+	return obj.(*kotsv1beta1.Config), nil
+}
+
 func LoadPreflightFromContents(content []byte) (*troubleshootv1beta1.Preflight, error) {
 	decode := scheme.Codecs.UniversalDeserializer().Decode
 
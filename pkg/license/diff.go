@@ -0,0 +1,212 @@
+package license
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+)
+
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+type ValueChange struct {
+	OldValue string `json:"oldValue"`
+	NewValue string `json:"newValue"`
+}
+
+type EntitlementChange struct {
+	Name     string `json:"name"`
+	Title    string `json:"title"`
+	Change   string `json:"change"`
+	OldValue string `json:"oldValue,omitempty"`
+	NewValue string `json:"newValue,omitempty"`
+}
+
+// LicenseDiff describes what changed between two licenses. Flags are the boolean fields on the license
+// spec, such as isAirgapSupported
+type LicenseDiff struct {
+	OldLicenseSequence int64               `json:"oldLicenseSequence"`
+	NewLicenseSequence int64               `json:"newLicenseSequence"`
+	ChannelName        *ValueChange        `json:"channelName,omitempty"`
+	LicenseType        *ValueChange        `json:"licenseType,omitempty"`
+	ExpiresAt          *ValueChange        `json:"expiresAt,omitempty"`
+	Entitlements       []EntitlementChange `json:"entitlements"`
+	Flags              []EntitlementChange `json:"flags"`
+}
+
+// DiffLicenses compares the license that was in use with the license that replaces it
+func DiffLicenses(oldLicense *kotsv1beta1.License, newLicense *kotsv1beta1.License) *LicenseDiff {
+	diff := LicenseDiff{
+		OldLicenseSequence: oldLicense.Spec.LicenseSequence,
+		NewLicenseSequence: newLicense.Spec.LicenseSequence,
+		ChannelName:        diffValue(oldLicense.Spec.ChannelName, newLicense.Spec.ChannelName),
+		LicenseType:        diffValue(oldLicense.Spec.LicenseType, newLicense.Spec.LicenseType),
+		ExpiresAt:          diffValue(expiresAtValue(oldLicense), expiresAtValue(newLicense)),
+	}
+
+	titles := map[string]string{}
+	for name, entitlement := range oldLicense.Spec.Entitlements {
+		titles[name] = entitlement.Title
+	}
+	for name, entitlement := range newLicense.Spec.Entitlements {
+		titles[name] = entitlement.Title
+	}
+
+	oldEntitlements := entitlementValues(oldLicense)
+	newEntitlements := entitlementValues(newLicense)
+	// expiration is reported on its own
+	delete(oldEntitlements, "expires_at")
+	delete(newEntitlements, "expires_at")
+	diff.Entitlements = diffEntitlements(oldEntitlements, newEntitlements, titles)
+
+	diff.Flags = diffEntitlements(licenseFlags(oldLicense), licenseFlags(newLicense), map[string]string{
+		"isAirgapSupported": "Airgap Supported",
+		"isGitOpsSupported": "GitOps Supported",
+	})
+
+	return &diff
+}
+
+// Summary returns a line for every change
+func (d *LicenseDiff) Summary() []string {
+	lines := []string{}
+
+	if d.ChannelName != nil {
+		lines = append(lines, fmt.Sprintf("Channel changed from %q to %q", d.ChannelName.OldValue, d.ChannelName.NewValue))
+	}
+	if d.LicenseType != nil {
+		lines = append(lines, fmt.Sprintf("License type changed from %q to %q", d.LicenseType.OldValue, d.LicenseType.NewValue))
+	}
+	if d.ExpiresAt != nil {
+		lines = append(lines, fmt.Sprintf("Expiration changed from %q to %q", d.ExpiresAt.OldValue, d.ExpiresAt.NewValue))
+	}
+
+	for _, changes := range [][]EntitlementChange{d.Entitlements, d.Flags} {
+		for _, change := range changes {
+			switch change.Change {
+			case ChangeAdded:
+				lines = append(lines, fmt.Sprintf("Entitlement %q added with value %q", change.Name, change.NewValue))
+			case ChangeRemoved:
+				lines = append(lines, fmt.Sprintf("Entitlement %q removed", change.Name))
+			case ChangeModified:
+				lines = append(lines, fmt.Sprintf("Entitlement %q changed from %q to %q", change.Name, change.OldValue, change.NewValue))
+			}
+		}
+	}
+
+	return lines
+}
+
+func diffValue(oldValue string, newValue string) *ValueChange {
+	if oldValue == newValue {
+		return nil
+	}
+	return &ValueChange{
+		OldValue: oldValue,
+		NewValue: newValue,
+	}
+}
+
+func diffEntitlements(oldValues map[string]string, newValues map[string]string, titles map[string]string) []EntitlementChange {
+	names := []string{}
+	for name := range oldValues {
+		names = append(names, name)
+	}
+	for name := range newValues {
+		if _, ok := oldValues[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []EntitlementChange{}
+	for _, name := range names {
+		oldValue, hadValue := oldValues[name]
+		newValue, hasValue := newValues[name]
+
+		change := EntitlementChange{
+			Name:     name,
+			Title:    titles[name],
+			OldValue: oldValue,
+			NewValue: newValue,
+		}
+		switch {
+		case !hadValue:
+			change.Change = ChangeAdded
+		case !hasValue:
+			change.Change = ChangeRemoved
+		case oldValue != newValue:
+			change.Change = ChangeModified
+		default:
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+func expiresAtValue(license *kotsv1beta1.License) string {
+	entitlement, ok := license.Spec.Entitlements["expires_at"]
+	if !ok {
+		return ""
+	}
+	return entitlement.Value.StrVal
+}
+
+func licenseFlags(license *kotsv1beta1.License) map[string]string {
+	return map[string]string{
+		"isAirgapSupported": strconv.FormatBool(license.Spec.IsAirgapSupported),
+		"isGitOpsSupported": strconv.FormatBool(license.Spec.IsGitOpsSupported),
+	}
+}
+
+// SetLicenseDiff stores the diff with the version that the license change created
+func SetLicenseDiff(appID string, sequence int64, diff *LicenseDiff) error {
+	marshalled, err := json.Marshal(diff)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal license diff")
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `update app_version set license_diff = $1 where app_id = $2 and sequence = $3`
+	_, err = db.Exec(query, string(marshalled), appID, sequence)
+	if err != nil {
+		return errors.Wrap(err, "failed to set license diff")
+	}
+
+	return nil
+}
+
+// GetLicenseDiff returns the license diff of a version, or nil if the version was not created by a license change
+func GetLicenseDiff(appID string, sequence int64) (*LicenseDiff, error) {
+	db := persistence.MustGetPGSession()
+	query := `select license_diff from app_version where app_id = $1 and sequence = $2`
+	row := db.QueryRow(query, appID, sequence)
+
+	var marshalled sql.NullString
+	if err := row.Scan(&marshalled); err != nil {
+		return nil, errors.Wrap(err, "failed to scan license diff")
+	}
+
+	if marshalled.String == "" {
+		return nil, nil
+	}
+
+	diff := LicenseDiff{}
+	if err := json.Unmarshal([]byte(marshalled.String), &diff); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal license diff")
+	}
+
+	return &diff, nil
+}
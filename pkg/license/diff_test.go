@@ -0,0 +1,92 @@
+package license
+
+import (
+	"testing"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func diffTestLicense(sequence int64, channelName string, entitlements map[string]string, isAirgapSupported bool) *kotsv1beta1.License {
+	license := &kotsv1beta1.License{
+		Spec: kotsv1beta1.LicenseSpec{
+			LicenseSequence:   sequence,
+			ChannelName:       channelName,
+			LicenseType:       "prod",
+			IsAirgapSupported: isAirgapSupported,
+			Entitlements:      map[string]kotsv1beta1.EntitlementField{},
+		},
+	}
+	for name, value := range entitlements {
+		license.Spec.Entitlements[name] = kotsv1beta1.EntitlementField{
+			Title: name + " title",
+			Value: kotsv1beta1.EntitlementValue{StrVal: value},
+		}
+	}
+	return license
+}
+
+func Test_DiffLicenses(t *testing.T) {
+	tests := []struct {
+		name                 string
+		oldLicense           *kotsv1beta1.License
+		newLicense           *kotsv1beta1.License
+		expectedChannelName  *ValueChange
+		expectedExpiresAt    *ValueChange
+		expectedEntitlements []EntitlementChange
+		expectedFlags        []EntitlementChange
+	}{
+		{
+			name:                 "no changes",
+			oldLicense:           diffTestLicense(1, "Stable", map[string]string{"seats": "10"}, false),
+			newLicense:           diffTestLicense(2, "Stable", map[string]string{"seats": "10"}, false),
+			expectedEntitlements: []EntitlementChange{},
+			expectedFlags:        []EntitlementChange{},
+		},
+		{
+			name:       "entitlement added, removed and changed",
+			oldLicense: diffTestLicense(1, "Stable", map[string]string{"seats": "10", "beta": "false"}, false),
+			newLicense: diffTestLicense(2, "Stable", map[string]string{"seats": "25", "sso": "true"}, false),
+			expectedEntitlements: []EntitlementChange{
+				{Name: "beta", Title: "beta title", Change: ChangeRemoved, OldValue: "false"},
+				{Name: "seats", Title: "seats title", Change: ChangeModified, OldValue: "10", NewValue: "25"},
+				{Name: "sso", Title: "sso title", Change: ChangeAdded, NewValue: "true"},
+			},
+			expectedFlags: []EntitlementChange{},
+		},
+		{
+			name:                 "expiration is reported on its own",
+			oldLicense:           diffTestLicense(1, "Stable", map[string]string{"expires_at": "2020-06-01T00:00:00Z"}, false),
+			newLicense:           diffTestLicense(2, "Stable", map[string]string{"expires_at": "2021-06-01T00:00:00Z"}, false),
+			expectedExpiresAt:    &ValueChange{OldValue: "2020-06-01T00:00:00Z", NewValue: "2021-06-01T00:00:00Z"},
+			expectedEntitlements: []EntitlementChange{},
+			expectedFlags:        []EntitlementChange{},
+		},
+		{
+			name:                 "channel and flag changes",
+			oldLicense:           diffTestLicense(1, "Stable", map[string]string{}, false),
+			newLicense:           diffTestLicense(2, "Beta", map[string]string{}, true),
+			expectedChannelName:  &ValueChange{OldValue: "Stable", NewValue: "Beta"},
+			expectedEntitlements: []EntitlementChange{},
+			expectedFlags: []EntitlementChange{
+				{Name: "isAirgapSupported", Title: "Airgap Supported", Change: ChangeModified, OldValue: "false", NewValue: "true"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			diff := DiffLicenses(test.oldLicense, test.newLicense)
+			req.Equal(int64(1), diff.OldLicenseSequence)
+			req.Equal(int64(2), diff.NewLicenseSequence)
+			req.Equal(test.expectedChannelName, diff.ChannelName)
+			req.Nil(diff.LicenseType)
+			req.Equal(test.expectedExpiresAt, diff.ExpiresAt)
+			req.Equal(test.expectedEntitlements, diff.Entitlements)
+			req.Equal(test.expectedFlags, diff.Flags)
+		})
+	}
+}
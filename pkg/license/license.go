@@ -12,6 +12,7 @@ import (
 	kotspull "github.com/replicatedhq/kots/pkg/pull"
 	"github.com/replicatedhq/kotsadm/pkg/app"
 	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
 	"github.com/replicatedhq/kotsadm/pkg/preflight"
 	"github.com/replicatedhq/kotsadm/pkg/registry"
 	"github.com/replicatedhq/kotsadm/pkg/render"
@@ -62,6 +63,8 @@ func Sync(a *app.App, licenseData string) (*kotsv1beta1.License, error) {
 
 	// Save and make a new version if the sequence has changed
 	if latestLicense.Spec.LicenseSequence != kotsKinds.License.Spec.LicenseSequence {
+		licenseDiff := DiffLicenses(kotsKinds.License, latestLicense)
+
 		s := serializer.NewYAMLSerializer(serializer.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
 		var b bytes.Buffer
 		if err := s.Encode(latestLicense, &b); err != nil {
@@ -94,11 +97,19 @@ func Sync(a *app.App, licenseData string) (*kotsv1beta1.License, error) {
 			return nil, errors.Wrap(err, "failed to upload")
 		}
 
-		if err := preflight.Run(a.ID, newSequence, archiveDir); err != nil {
+		if err := SetLicenseDiff(a.ID, newSequence, licenseDiff); err != nil {
+			return nil, errors.Wrap(err, "failed to set license diff")
+		}
+
+		if err := preflight.Run(a.ID, newSequence, archiveDir, preflight.TriggerLicense); err != nil {
 			return nil, errors.Wrap(err, "failed to run preflights")
 		}
 	}
 
+	if _, err := updateLicenseStatus(a, latestLicense, licenseData == ""); err != nil {
+		logger.Error(errors.Wrap(err, "failed to update license status"))
+	}
+
 	return latestLicense, nil
 }
 
@@ -0,0 +1,76 @@
+package license
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+)
+
+const defaultMonitorInterval = 4 * time.Hour
+
+// StartMonitor syncs the licenses of online apps in the background, on the interval in LICENSE_SYNC_INTERVAL.
+// The licenses of airgap apps can't be synced, but they are still checked for expiration
+func StartMonitor() {
+	interval := defaultMonitorInterval
+	if os.Getenv("LICENSE_SYNC_INTERVAL") != "" {
+		parsed, err := time.ParseDuration(os.Getenv("LICENSE_SYNC_INTERVAL"))
+		if err != nil {
+			logger.Error(errors.Wrap(err, "failed to parse LICENSE_SYNC_INTERVAL, using the default"))
+		} else {
+			interval = parsed
+		}
+	}
+
+	go func() {
+		for {
+			checkLicenses()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func checkLicenses() {
+	apps, err := app.ListInstalled()
+	if err != nil {
+		logger.Error(errors.Wrap(err, "failed to list apps to check licenses"))
+		return
+	}
+
+	for _, a := range apps {
+		if err := checkLicense(a); err != nil {
+			logger.Error(errors.Wrapf(err, "failed to check license for app %s", a.Slug))
+		}
+	}
+}
+
+func checkLicense(a *app.App) error {
+	if !a.IsAirgap {
+		if _, err := Sync(a, ""); err != nil {
+			if err := setLicenseSyncError(a, err); err != nil {
+				logger.Error(err)
+			}
+			return errors.Wrap(err, "failed to sync license")
+		}
+		return nil
+	}
+
+	licenseData, err := app.GetLicenseDataFromDatabase(a.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get license")
+	}
+
+	license, err := kotsutil.LoadLicenseFromBytes([]byte(licenseData))
+	if err != nil {
+		return errors.Wrap(err, "failed to load license")
+	}
+
+	if _, err := updateLicenseStatus(a, license, false); err != nil {
+		return errors.Wrap(err, "failed to update license status")
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package license
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/notification"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+)
+
+const (
+	StatusValid    = "valid"
+	StatusExpiring = "expiring"
+	StatusExpired  = "expired"
+
+	// ExpirationWarningPeriod is how long before the license expires that it's reported as expiring
+	ExpirationWarningPeriod = 30 * 24 * time.Hour
+
+	notificationKindExpiration = "license-expiration"
+	notificationKindChange     = "license-change"
+	notificationKindSyncError  = "license-sync-error"
+)
+
+type LicenseStatus struct {
+	AppID           string     `json:"appId"`
+	LicenseID       string     `json:"licenseId"`
+	LicenseSequence int64      `json:"licenseSequence"`
+	ChannelName     string     `json:"channelName"`
+	ExpiresAt       *time.Time `json:"expiresAt,omitempty"`
+	Status          string     `json:"status"`
+	LastSyncedAt    *time.Time `json:"lastSyncedAt,omitempty"`
+	LastSyncError   string     `json:"lastSyncError,omitempty"`
+
+	// entitlements are the values of the entitlements when the license was last seen, to detect changes
+	entitlements map[string]string
+}
+
+// GetExpiration returns when the license expires, or nil if it does not expire
+func GetExpiration(license *kotsv1beta1.License) (*time.Time, error) {
+	entitlement, ok := license.Spec.Entitlements["expires_at"]
+	if !ok || entitlement.Value.StrVal == "" {
+		return nil, nil
+	}
+
+	expiration, err := time.Parse(time.RFC3339, entitlement.Value.StrVal)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse expiration")
+	}
+
+	return &expiration, nil
+}
+
+// GetStatus returns valid, expiring or expired for a license that expires at expiresAt
+func GetStatus(expiresAt *time.Time, now time.Time) string {
+	if expiresAt == nil {
+		return StatusValid
+	}
+	if !now.Before(*expiresAt) {
+		return StatusExpired
+	}
+	if expiresAt.Sub(now) <= ExpirationWarningPeriod {
+		return StatusExpiring
+	}
+	return StatusValid
+}
+
+func GetLicenseStatus(appID string) (*LicenseStatus, error) {
+	db := persistence.MustGetPGSession()
+	query := `select license_id, license_sequence, channel_name, expires_at, entitlements, last_synced_at, last_sync_error
+from app_license_status where app_id = $1`
+	row := db.QueryRow(query, appID)
+
+	var licenseID sql.NullString
+	var licenseSequence sql.NullInt64
+	var channelName sql.NullString
+	var expiresAt sql.NullTime
+	var entitlements sql.NullString
+	var lastSyncedAt sql.NullTime
+	var lastSyncError sql.NullString
+	if err := row.Scan(&licenseID, &licenseSequence, &channelName, &expiresAt, &entitlements, &lastSyncedAt, &lastSyncError); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to scan license status")
+	}
+
+	licenseStatus := LicenseStatus{
+		AppID:           appID,
+		LicenseID:       licenseID.String,
+		LicenseSequence: licenseSequence.Int64,
+		ChannelName:     channelName.String,
+		LastSyncError:   lastSyncError.String,
+		entitlements:    map[string]string{},
+	}
+	if expiresAt.Valid {
+		licenseStatus.ExpiresAt = &expiresAt.Time
+	}
+	if lastSyncedAt.Valid {
+		licenseStatus.LastSyncedAt = &lastSyncedAt.Time
+	}
+	if entitlements.String != "" {
+		if err := json.Unmarshal([]byte(entitlements.String), &licenseStatus.entitlements); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal entitlements")
+		}
+	}
+	licenseStatus.Status = GetStatus(licenseStatus.ExpiresAt, time.Now())
+
+	return &licenseStatus, nil
+}
+
+// updateLicenseStatus compares the license with the one that was seen last, notifies about changes and
+// upcoming expiration, and stores it as the last seen license. synced is false when the license was not
+// fetched from the vendor, for example for airgap apps
+func updateLicenseStatus(a *app.App, license *kotsv1beta1.License, synced bool) (*LicenseStatus, error) {
+	previous, err := GetLicenseStatus(a.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get previous license status")
+	}
+
+	expiresAt, err := GetExpiration(license)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get license expiration")
+	}
+
+	now := time.Now()
+	current := LicenseStatus{
+		AppID:           a.ID,
+		LicenseID:       license.Spec.LicenseID,
+		LicenseSequence: license.Spec.LicenseSequence,
+		ChannelName:     license.Spec.ChannelName,
+		ExpiresAt:       expiresAt,
+		Status:          GetStatus(expiresAt, now),
+		entitlements:    entitlementValues(license),
+	}
+	if synced {
+		current.LastSyncedAt = &now
+	} else if previous != nil {
+		current.LastSyncedAt = previous.LastSyncedAt
+	}
+
+	// a status without a license id only holds a sync error, there is nothing to compare with
+	if previous != nil && previous.LicenseID != "" {
+		if changes := describeLicenseChanges(previous, &current); len(changes) > 0 {
+			title := fmt.Sprintf("The license for %s has changed", a.Name)
+			dedupeKey := fmt.Sprintf("%s-%d", notificationKindChange, current.LicenseSequence)
+			if err := notification.Create(a.ID, notificationKindChange, dedupeKey, notification.SeverityInfo, title, strings.Join(changes, "\n")); err != nil {
+				logger.Error(errors.Wrap(err, "failed to create license change notification"))
+			}
+		}
+	}
+
+	if err := notifyExpiration(a, &current); err != nil {
+		logger.Error(errors.Wrap(err, "failed to create license expiration notification"))
+	}
+
+	if synced {
+		if err := notification.ResolveKind(a.ID, notificationKindSyncError); err != nil {
+			logger.Error(errors.Wrap(err, "failed to resolve license sync error notifications"))
+		}
+	}
+
+	entitlements, err := json.Marshal(current.entitlements)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal entitlements")
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `insert into app_license_status (app_id, license_id, license_sequence, channel_name, expires_at, entitlements, last_synced_at, last_sync_error, updated_at)
+values ($1, $2, $3, $4, $5, $6, $7, null, $8)
+on conflict(app_id) do update set license_id = EXCLUDED.license_id, license_sequence = EXCLUDED.license_sequence,
+channel_name = EXCLUDED.channel_name, expires_at = EXCLUDED.expires_at, entitlements = EXCLUDED.entitlements,
+last_synced_at = EXCLUDED.last_synced_at, last_sync_error = EXCLUDED.last_sync_error, updated_at = EXCLUDED.updated_at`
+	_, err = db.Exec(query, a.ID, current.LicenseID, current.LicenseSequence, current.ChannelName, current.ExpiresAt, string(entitlements), current.LastSyncedAt, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to update license status")
+	}
+
+	return &current, nil
+}
+
+// setLicenseSyncError records that the license could not be synced, the last seen license is kept
+func setLicenseSyncError(a *app.App, syncErr error) error {
+	db := persistence.MustGetPGSession()
+	query := `insert into app_license_status (app_id, last_sync_error, updated_at) values ($1, $2, $3)
+on conflict(app_id) do update set last_sync_error = EXCLUDED.last_sync_error, updated_at = EXCLUDED.updated_at`
+	_, err := db.Exec(query, a.ID, syncErr.Error(), time.Now())
+	if err != nil {
+		return errors.Wrap(err, "failed to set license sync error")
+	}
+
+	title := fmt.Sprintf("The license for %s could not be synced", a.Name)
+	if err := notification.Create(a.ID, notificationKindSyncError, notificationKindSyncError, notification.SeverityWarning, title, syncErr.Error()); err != nil {
+		return errors.Wrap(err, "failed to create notification")
+	}
+
+	return nil
+}
+
+func notifyExpiration(a *app.App, licenseStatus *LicenseStatus) error {
+	if licenseStatus.Status == StatusValid {
+		return notification.ResolveKind(a.ID, notificationKindExpiration)
+	}
+
+	expiresAt := licenseStatus.ExpiresAt.UTC().Format("2006-01-02")
+
+	// the key includes the status and expiration so that extending the license, or the license going from
+	// expiring to expired, notifies again
+	dedupeKey := fmt.Sprintf("%s-%s-%s", notificationKindExpiration, licenseStatus.Status, expiresAt)
+	if licenseStatus.Status == StatusExpired {
+		title := fmt.Sprintf("The license for %s expired on %s", a.Name, expiresAt)
+		return notification.Create(a.ID, notificationKindExpiration, dedupeKey, notification.SeverityError, title, "Contact your vendor to renew the license.")
+	}
+
+	days := int(time.Until(*licenseStatus.ExpiresAt).Hours() / 24)
+	title := fmt.Sprintf("The license for %s expires on %s", a.Name, expiresAt)
+	message := fmt.Sprintf("The license expires in %d days. Contact your vendor to renew the license.", days)
+	return notification.Create(a.ID, notificationKindExpiration, dedupeKey, notification.SeverityWarning, title, message)
+}
+
+func entitlementValues(license *kotsv1beta1.License) map[string]string {
+	values := map[string]string{}
+	for name, entitlement := range license.Spec.Entitlements {
+		values[name] = fmt.Sprintf("%v", entitlement.Value.Value())
+	}
+	return values
+}
+
+// describeLicenseChanges returns a line for every change between two license statuses
+func describeLicenseChanges(previous *LicenseStatus, current *LicenseStatus) []string {
+	diff := LicenseDiff{
+		Entitlements: diffEntitlements(previous.entitlements, current.entitlements, map[string]string{}),
+	}
+	if previous.ChannelName != "" {
+		diff.ChannelName = diffValue(previous.ChannelName, current.ChannelName)
+	}
+
+	return diff.Summary()
+}
@@ -0,0 +1,51 @@
+package license
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_GetStatus(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	inAYear := now.AddDate(1, 0, 0)
+	inAWeek := now.AddDate(0, 0, 7)
+	lastWeek := now.AddDate(0, 0, -7)
+
+	req := require.New(t)
+	req.Equal(StatusValid, GetStatus(nil, now))
+	req.Equal(StatusValid, GetStatus(&inAYear, now))
+	req.Equal(StatusExpiring, GetStatus(&inAWeek, now))
+	req.Equal(StatusExpired, GetStatus(&lastWeek, now))
+	req.Equal(StatusExpired, GetStatus(&now, now))
+}
+
+func Test_describeLicenseChanges(t *testing.T) {
+	previous := &LicenseStatus{
+		ChannelName: "Stable",
+		entitlements: map[string]string{
+			"expires_at": "2020-06-01T00:00:00Z",
+			"seats":      "10",
+			"beta":       "false",
+		},
+	}
+	current := &LicenseStatus{
+		ChannelName: "Beta",
+		entitlements: map[string]string{
+			"expires_at": "2020-06-01T00:00:00Z",
+			"seats":      "25",
+			"sso":        "true",
+		},
+	}
+
+	req := require.New(t)
+	req.Equal([]string{
+		`Channel changed from "Stable" to "Beta"`,
+		`Entitlement "beta" removed`,
+		`Entitlement "seats" changed from "10" to "25"`,
+		`Entitlement "sso" added with value "true"`,
+	}, describeLicenseChanges(previous, current))
+	req.Empty(describeLicenseChanges(current, current))
+}
@@ -0,0 +1,394 @@
+package maintenance
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	"github.com/replicatedhq/kotsadm/pkg/preflightgate"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	QueuedDeployStatusQueued     = "queued"
+	QueuedDeployStatusDeployed   = "deployed"
+	QueuedDeployStatusSuperseded = "superseded"
+	QueuedDeployStatusCancelled  = "cancelled"
+	QueuedDeployStatusFailed     = "failed"
+
+	queueInterval = time.Minute
+)
+
+type QueuedDeploy struct {
+	ID           string     `json:"id"`
+	AppID        string     `json:"appId"`
+	Sequence     int64      `json:"sequence"`
+	Source       string     `json:"source"`
+	Status       string     `json:"status"`
+	RequestedAt  time.Time  `json:"requestedAt"`
+	ScheduledFor time.Time  `json:"scheduledFor"`
+	DeployedAt   *time.Time `json:"deployedAt,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// GetWindows returns the maintenance windows of an app. Apps without windows get an empty list, and can be deployed at any time
+func GetWindows(appID string) (*Windows, error) {
+	db := persistence.MustGetPGSession()
+	query := `select maintenance_windows from app where id = $1`
+	row := db.QueryRow(query, appID)
+
+	var marshalled sql.NullString
+	if err := row.Scan(&marshalled); err != nil {
+		return nil, errors.Wrap(err, "failed to scan maintenance windows")
+	}
+
+	windows := Windows{
+		Timezone: "UTC",
+		Windows:  []Window{},
+	}
+	if marshalled.String == "" {
+		return &windows, nil
+	}
+
+	if err := json.Unmarshal([]byte(marshalled.String), &windows); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal maintenance windows")
+	}
+
+	return &windows, nil
+}
+
+func SetWindows(appID string, windows *Windows) error {
+	if err := windows.Validate(); err != nil {
+		return errors.Wrap(err, "invalid maintenance windows")
+	}
+
+	marshalled, err := json.Marshal(windows)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal maintenance windows")
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `update app set maintenance_windows = $1 where id = $2`
+	if _, err := db.Exec(query, string(marshalled), appID); err != nil {
+		return errors.Wrap(err, "failed to set maintenance windows")
+	}
+
+	return nil
+}
+
+// RequestDeploy deploys the sequence if a maintenance window of the app is open, or if override is set.
+// Otherwise the deploy is queued until the next window opens, replacing any deploy that was already queued,
+// and the queued deploy is returned. source describes what requested the deploy, such as manual or auto.
+// A deploy that the preflight gating policy blocks returns a *preflightgate.BlockedError, unless there is a
+// preflight override, which is then recorded in the audit trail with the deploy
+func RequestDeploy(appID string, sequence int64, source string, override bool, preflightOverride *preflightgate.Override) (*QueuedDeploy, error) {
+	decision, err := preflightgate.Evaluate(appID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to evaluate preflight gating policy")
+	}
+
+	if decision.Blocked {
+		if preflightOverride == nil {
+			if err := preflightgate.RecordEvent(appID, sequence, source, preflightgate.ActionBlocked, decision, nil, ""); err != nil {
+				logger.Error(err)
+			}
+			return nil, &preflightgate.BlockedError{Decision: decision}
+		}
+		if err := preflightOverride.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	queuedDeploy, err := requestDeploy(appID, sequence, source, override)
+	if err != nil {
+		return nil, err
+	}
+
+	if decision.Blocked {
+		queuedDeployID := ""
+		if queuedDeploy != nil {
+			queuedDeployID = queuedDeploy.ID
+		}
+		if err := preflightgate.RecordEvent(appID, sequence, source, preflightgate.ActionOverridden, decision, preflightOverride, queuedDeployID); err != nil {
+			logger.Error(err)
+		}
+	}
+
+	return queuedDeploy, nil
+}
+
+func requestDeploy(appID string, sequence int64, source string, override bool) (*QueuedDeploy, error) {
+	windows, err := GetWindows(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get maintenance windows")
+	}
+
+	now := time.Now()
+	isOpen, err := windows.IsOpen(now)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check maintenance windows")
+	}
+
+	if isOpen || override {
+		if err := deployNow(appID, sequence); err != nil {
+			return nil, errors.Wrap(err, "failed to deploy version")
+		}
+		return nil, nil
+	}
+
+	nextOpen, err := windows.NextOpen(now)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find next maintenance window")
+	}
+
+	queuedDeploy := QueuedDeploy{
+		ID:           ksuid.New().String(),
+		AppID:        appID,
+		Sequence:     sequence,
+		Source:       source,
+		Status:       QueuedDeployStatusQueued,
+		RequestedAt:  now,
+		ScheduledFor: nextOpen.UTC(),
+	}
+
+	db := persistence.MustGetPGSession()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin")
+	}
+	defer tx.Rollback()
+
+	// only the latest request is deployed when the window opens
+	query := `update app_queued_deploy set status = $1 where app_id = $2 and status = $3`
+	if _, err := tx.Exec(query, QueuedDeployStatusSuperseded, appID, QueuedDeployStatusQueued); err != nil {
+		return nil, errors.Wrap(err, "failed to supersede queued deploys")
+	}
+
+	query = `insert into app_queued_deploy (id, app_id, sequence, source, status, requested_at, scheduled_for) values ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := tx.Exec(query, queuedDeploy.ID, appID, sequence, source, queuedDeploy.Status, queuedDeploy.RequestedAt, queuedDeploy.ScheduledFor); err != nil {
+		return nil, errors.Wrap(err, "failed to insert queued deploy")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to commit")
+	}
+
+	return &queuedDeploy, nil
+}
+
+// deployNow deploys the sequence, and supersedes the deploys that are queued for the app in the same transaction,
+// so that an older queued version is not deployed over it when the next window opens
+func deployNow(appID string, sequence int64) error {
+	db := persistence.MustGetPGSession()
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin")
+	}
+	defer tx.Rollback()
+
+	if err := downstream.DeployVersionTx(tx, appID, sequence); err != nil {
+		return err
+	}
+
+	query := `update app_queued_deploy set status = $1 where app_id = $2 and status = $3`
+	if _, err := tx.Exec(query, QueuedDeployStatusSuperseded, appID, QueuedDeployStatusQueued); err != nil {
+		return errors.Wrap(err, "failed to supersede queued deploys")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit")
+	}
+
+	return nil
+}
+
+// ListQueuedDeploys returns the deploys of an app that were queued for a maintenance window, newest first.
+// Only deploys that are still waiting are returned unless includeCompleted is set
+func ListQueuedDeploys(appID string, includeCompleted bool) ([]*QueuedDeploy, error) {
+	db := persistence.MustGetPGSession()
+	query := `select id, app_id, sequence, source, status, requested_at, scheduled_for, deployed_at, error
+from app_queued_deploy where app_id = $1 and ($2 or status = $3) order by requested_at desc`
+	rows, err := db.Query(query, appID, includeCompleted, QueuedDeployStatusQueued)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query queued deploys")
+	}
+	defer rows.Close()
+
+	return scanQueuedDeploys(rows)
+}
+
+// CancelQueuedDeploy cancels a deploy that is waiting for a maintenance window
+func CancelQueuedDeploy(appID string, id string) error {
+	db := persistence.MustGetPGSession()
+	query := `update app_queued_deploy set status = $1 where app_id = $2 and id = $3 and status = $4`
+	result, err := db.Exec(query, QueuedDeployStatusCancelled, appID, id, QueuedDeployStatusQueued)
+	if err != nil {
+		return errors.Wrap(err, "failed to cancel queued deploy")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get rows affected")
+	}
+	if rowsAffected == 0 {
+		return errors.Errorf("queued deploy %s not found", id)
+	}
+
+	return nil
+}
+
+// StartQueueProcessor deploys queued deploys in the background once their maintenance window opens
+func StartQueueProcessor() {
+	go func() {
+		for {
+			if err := processQueuedDeploys(time.Now()); err != nil {
+				logger.Error(errors.Wrap(err, "failed to process queued deploys"))
+			}
+			time.Sleep(queueInterval)
+		}
+	}()
+}
+
+func processQueuedDeploys(now time.Time) error {
+	db := persistence.MustGetPGSession()
+	query := `select id, app_id, sequence, source, status, requested_at, scheduled_for, deployed_at, error
+from app_queued_deploy where status = $1 and scheduled_for <= $2 order by requested_at`
+	rows, err := db.Query(query, QueuedDeployStatusQueued, now)
+	if err != nil {
+		return errors.Wrap(err, "failed to query queued deploys")
+	}
+	queuedDeploys, err := scanQueuedDeploys(rows)
+	rows.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to scan queued deploys")
+	}
+
+	for _, queuedDeploy := range queuedDeploys {
+		windows, err := GetWindows(queuedDeploy.AppID)
+		if err != nil {
+			logger.Error(errors.Wrapf(err, "failed to get maintenance windows for app %s", queuedDeploy.AppID))
+			continue
+		}
+
+		// the windows may have changed since the deploy was queued
+		isOpen, err := windows.IsOpen(now)
+		if err != nil {
+			logger.Error(errors.Wrapf(err, "failed to check maintenance windows for app %s", queuedDeploy.AppID))
+			continue
+		}
+		if !isOpen {
+			nextOpen, err := windows.NextOpen(now)
+			if err != nil {
+				logger.Error(errors.Wrapf(err, "failed to find next maintenance window for app %s", queuedDeploy.AppID))
+				continue
+			}
+			query := `update app_queued_deploy set scheduled_for = $1 where id = $2`
+			if _, err := db.Exec(query, nextOpen.UTC(), queuedDeploy.ID); err != nil {
+				logger.Error(errors.Wrap(err, "failed to reschedule queued deploy"))
+			}
+			continue
+		}
+
+		if err := DeployQueued(queuedDeploy.AppID, queuedDeploy.ID); err != nil {
+			logger.Error(errors.Wrapf(err, "failed to deploy queued deploy %s", queuedDeploy.ID))
+		}
+	}
+
+	return nil
+}
+
+// DeployQueued deploys a queued deploy now, regardless of the maintenance windows. A queued deploy of a version
+// that is not newer than the deployed version is superseded instead, since deploying it would roll the app back
+func DeployQueued(appID string, id string) error {
+	db := persistence.MustGetPGSession()
+	query := `select sequence from app_queued_deploy where app_id = $1 and id = $2 and status = $3`
+	row := db.QueryRow(query, appID, id, QueuedDeployStatusQueued)
+
+	var sequence int64
+	if err := row.Scan(&sequence); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Errorf("queued deploy %s not found", id)
+		}
+		return errors.Wrap(err, "failed to scan queued deploy")
+	}
+
+	currentSequence, err := deployedSequence(appID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get current sequence")
+	}
+	if !isNewerSequence(sequence, currentSequence) {
+		query = `update app_queued_deploy set status = $1 where id = $2`
+		if _, err := db.Exec(query, QueuedDeployStatusSuperseded, id); err != nil {
+			return errors.Wrap(err, "failed to supersede queued deploy")
+		}
+		return errors.Errorf("sequence %d is not newer than the deployed sequence %d", sequence, currentSequence)
+	}
+
+	deployErr := downstream.DeployVersion(appID, sequence)
+
+	status := QueuedDeployStatusDeployed
+	var errorMessage *string
+	if deployErr != nil {
+		status = QueuedDeployStatusFailed
+		message := errors.Cause(deployErr).Error()
+		errorMessage = &message
+	}
+
+	query = `update app_queued_deploy set status = $1, deployed_at = $2, error = $3 where id = $4`
+	if _, err := db.Exec(query, status, time.Now(), errorMessage, id); err != nil {
+		return errors.Wrap(err, "failed to update queued deploy")
+	}
+
+	if deployErr != nil {
+		return errors.Wrap(deployErr, "failed to deploy version")
+	}
+
+	return nil
+}
+
+// deployedSequence returns the sequence that is deployed to the downstreams of the app, or -1
+func deployedSequence(appID string) (int64, error) {
+	downstreams, err := downstream.ListDownstreamsForApp(appID)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to list downstreams")
+	}
+
+	current := int64(-1)
+	for _, d := range downstreams {
+		if d.CurrentSequence > current {
+			current = d.CurrentSequence
+		}
+	}
+
+	return current, nil
+}
+
+// isNewerSequence returns true when a queued sequence can be deployed over the current sequence
+func isNewerSequence(sequence int64, currentSequence int64) bool {
+	return sequence > currentSequence
+}
+
+func scanQueuedDeploys(rows *sql.Rows) ([]*QueuedDeploy, error) {
+	queuedDeploys := []*QueuedDeploy{}
+	for rows.Next() {
+		queuedDeploy := QueuedDeploy{}
+		var deployedAt sql.NullTime
+		var errorMessage sql.NullString
+		if err := rows.Scan(&queuedDeploy.ID, &queuedDeploy.AppID, &queuedDeploy.Sequence, &queuedDeploy.Source, &queuedDeploy.Status,
+			&queuedDeploy.RequestedAt, &queuedDeploy.ScheduledFor, &deployedAt, &errorMessage); err != nil {
+			return nil, errors.Wrap(err, "failed to scan queued deploy")
+		}
+		if deployedAt.Valid {
+			queuedDeploy.DeployedAt = &deployedAt.Time
+		}
+		queuedDeploy.Error = errorMessage.String
+
+		queuedDeploys = append(queuedDeploys, &queuedDeploy)
+	}
+
+	return queuedDeploys, nil
+}
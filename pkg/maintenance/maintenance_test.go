@@ -0,0 +1,49 @@
+package maintenance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_isNewerSequence(t *testing.T) {
+	tests := []struct {
+		name            string
+		sequence        int64
+		currentSequence int64
+		expected        bool
+	}{
+		{
+			name:            "nothing deployed",
+			sequence:        0,
+			currentSequence: -1,
+			expected:        true,
+		},
+		{
+			name:            "newer than the deployed version",
+			sequence:        3,
+			currentSequence: 2,
+			expected:        true,
+		},
+		{
+			name:            "already deployed",
+			sequence:        3,
+			currentSequence: 3,
+			expected:        false,
+		},
+		{
+			// v2 was queued, then v3 was deployed with an override
+			name:            "older than the deployed version",
+			sequence:        2,
+			currentSequence: 3,
+			expected:        false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			req.Equal(test.expected, isNewerSequence(test.sequence, test.currentSequence))
+		})
+	}
+}
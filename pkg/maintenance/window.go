@@ -0,0 +1,157 @@
+package maintenance
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a recurring time range. It opens at Start on each of the Days, and closes at End.
+// A window that ends at or before its start time closes on the following day
+type Window struct {
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// Windows are the maintenance windows of an app, with the times interpreted in Timezone.
+// An app without windows can be deployed at any time
+type Windows struct {
+	Timezone string   `json:"timezone"`
+	Windows  []Window `json:"windows"`
+}
+
+func (w *Windows) Validate() error {
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return errors.Wrapf(err, "invalid timezone %q", w.Timezone)
+	}
+
+	for i, window := range w.Windows {
+		if len(window.Days) == 0 {
+			return errors.Errorf("window %d has no days", i)
+		}
+		for _, day := range window.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return errors.Errorf("window %d has an invalid day %q", i, day)
+			}
+		}
+		if _, err := parseTimeOfDay(window.Start); err != nil {
+			return errors.Wrapf(err, "window %d has an invalid start", i)
+		}
+		if _, err := parseTimeOfDay(window.End); err != nil {
+			return errors.Wrapf(err, "window %d has an invalid end", i)
+		}
+	}
+
+	return nil
+}
+
+// IsOpen returns true if now is inside one of the windows, or if there are no windows
+func (w *Windows) IsOpen(now time.Time) (bool, error) {
+	if len(w.Windows) == 0 {
+		return true, nil
+	}
+
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to load timezone")
+	}
+	now = now.In(loc)
+
+	// a window that started yesterday may still be open
+	for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+		for _, window := range w.Windows {
+			start, end, ok, err := window.occurrence(day)
+			if err != nil {
+				return false, err
+			}
+			if ok && !now.Before(start) && now.Before(end) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// NextOpen returns now if a window is open, or when the next window opens
+func (w *Windows) NextOpen(now time.Time) (time.Time, error) {
+	isOpen, err := w.IsOpen(now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if isOpen {
+		return now, nil
+	}
+
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to load timezone")
+	}
+	local := now.In(loc)
+
+	var next time.Time
+	for i := 0; i <= 7; i++ {
+		day := local.AddDate(0, 0, i)
+		for _, window := range w.Windows {
+			start, _, ok, err := window.occurrence(day)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if ok && start.After(now) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			return next, nil
+		}
+	}
+
+	return time.Time{}, errors.New("no maintenance window opens in the next week")
+}
+
+// occurrence returns when the window opens and closes if it opens on the day of t
+func (w Window) occurrence(t time.Time) (time.Time, time.Time, bool, error) {
+	opensToday := false
+	for _, day := range w.Days {
+		if weekdays[strings.ToLower(day)] == t.Weekday() {
+			opensToday = true
+			break
+		}
+	}
+	if !opensToday {
+		return time.Time{}, time.Time{}, false, nil
+	}
+
+	startOfDay, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, errors.Wrap(err, "failed to parse start")
+	}
+	endOfDay, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, errors.Wrap(err, "failed to parse end")
+	}
+
+	start := time.Date(t.Year(), t.Month(), t.Day(), startOfDay.Hour(), startOfDay.Minute(), 0, 0, t.Location())
+	end := time.Date(t.Year(), t.Month(), t.Day(), endOfDay.Hour(), endOfDay.Minute(), 0, 0, t.Location())
+	if !end.After(start) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, endOfDay.Hour(), endOfDay.Minute(), 0, 0, t.Location())
+	}
+
+	return start, end, true, nil
+}
+
+func parseTimeOfDay(value string) (time.Time, error) {
+	return time.Parse("15:04", value)
+}
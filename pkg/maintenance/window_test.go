@@ -0,0 +1,93 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_Windows(t *testing.T) {
+	req := require.New(t)
+
+	loc, err := time.LoadLocation("America/New_York")
+	req.NoError(err)
+
+	windows := Windows{
+		Timezone: "America/New_York",
+		Windows: []Window{
+			{Days: []string{"tue", "thu"}, Start: "22:00", End: "02:00"},
+			{Days: []string{"sat"}, Start: "09:00", End: "12:00"},
+		},
+	}
+	req.NoError(windows.Validate())
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		isOpen   bool
+		nextOpen time.Time
+	}{
+		{
+			name:     "monday afternoon",
+			now:      time.Date(2020, 6, 1, 15, 0, 0, 0, loc),
+			isOpen:   false,
+			nextOpen: time.Date(2020, 6, 2, 22, 0, 0, 0, loc),
+		},
+		{
+			name:   "tuesday night",
+			now:    time.Date(2020, 6, 2, 23, 30, 0, 0, loc),
+			isOpen: true,
+		},
+		{
+			name:   "after midnight into wednesday",
+			now:    time.Date(2020, 6, 3, 1, 59, 0, 0, loc),
+			isOpen: true,
+		},
+		{
+			name:     "window closed on wednesday",
+			now:      time.Date(2020, 6, 3, 2, 0, 0, 0, loc),
+			isOpen:   false,
+			nextOpen: time.Date(2020, 6, 4, 22, 0, 0, 0, loc),
+		},
+		{
+			name:     "sunday in utc",
+			now:      time.Date(2020, 6, 7, 12, 0, 0, 0, time.UTC),
+			isOpen:   false,
+			nextOpen: time.Date(2020, 6, 9, 22, 0, 0, 0, loc),
+		},
+		{
+			name:     "friday",
+			now:      time.Date(2020, 6, 5, 12, 0, 0, 0, loc),
+			isOpen:   false,
+			nextOpen: time.Date(2020, 6, 6, 9, 0, 0, 0, loc),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			isOpen, err := windows.IsOpen(test.now)
+			req.NoError(err)
+			req.Equal(test.isOpen, isOpen)
+
+			nextOpen, err := windows.NextOpen(test.now)
+			req.NoError(err)
+			if test.isOpen {
+				req.Equal(test.now, nextOpen)
+			} else {
+				req.True(test.nextOpen.Equal(nextOpen), "expected %s, got %s", test.nextOpen, nextOpen)
+			}
+		})
+	}
+}
+
+func Test_WindowsWithoutWindowsAreOpen(t *testing.T) {
+	req := require.New(t)
+
+	windows := Windows{Timezone: "UTC"}
+	isOpen, err := windows.IsOpen(time.Now())
+	req.NoError(err)
+	req.True(isOpen)
+}
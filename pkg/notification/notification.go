@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+type Notification struct {
+	ID          string     `json:"id"`
+	AppID       string     `json:"appId"`
+	Kind        string     `json:"kind"`
+	Severity    string     `json:"severity"`
+	Title       string     `json:"title"`
+	Message     string     `json:"message"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	DismissedAt *time.Time `json:"dismissedAt,omitempty"`
+}
+
+// Create adds a notification for the app. When dedupeKey is set and there already is a notification with
+// the same key that has not been resolved, nothing is created, so that checks that run on a schedule
+// don't notify about the same thing over and over. This includes notifications that the admin dismissed,
+// they are only created again once the condition has cleared and ResolveKind was called
+func Create(appID string, kind string, dedupeKey string, severity string, title string, message string) error {
+	db := persistence.MustGetPGSession()
+
+	if dedupeKey != "" {
+		query := `select count(1) from app_notification where app_id = $1 and dedupe_key = $2 and resolved_at is null`
+		row := db.QueryRow(query, appID, dedupeKey)
+		count := 0
+		if err := row.Scan(&count); err != nil {
+			return errors.Wrap(err, "failed to scan existing notifications")
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+
+	query := `insert into app_notification (id, app_id, kind, dedupe_key, severity, title, message, created_at) values ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := db.Exec(query, ksuid.New().String(), appID, kind, dedupeKey, severity, title, message, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "failed to insert notification")
+	}
+
+	return nil
+}
+
+// List returns the notifications of the app, newest first
+func List(appID string, includeDismissed bool) ([]*Notification, error) {
+	db := persistence.MustGetPGSession()
+	query := `select id, app_id, kind, severity, title, message, created_at, dismissed_at from app_notification where app_id = $1`
+	if !includeDismissed {
+		query += ` and dismissed_at is null`
+	}
+	query += ` order by created_at desc`
+
+	rows, err := db.Query(query, appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query notifications")
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n := Notification{}
+		var message sql.NullString
+		var dismissedAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.AppID, &n.Kind, &n.Severity, &n.Title, &message, &n.CreatedAt, &dismissedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan notification")
+		}
+		n.Message = message.String
+		if dismissedAt.Valid {
+			n.DismissedAt = &dismissedAt.Time
+		}
+
+		notifications = append(notifications, &n)
+	}
+
+	return notifications, nil
+}
+
+func Dismiss(appID string, id string) error {
+	db := persistence.MustGetPGSession()
+	query := `update app_notification set dismissed_at = $1 where app_id = $2 and id = $3 and dismissed_at is null`
+	_, err := db.Exec(query, time.Now(), appID, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to dismiss notification")
+	}
+
+	return nil
+}
+
+// ResolveKind dismisses the notifications of a kind and marks them resolved, for when the condition they describe
+// has cleared. Notifications with the same dedupe key can be created again after this
+func ResolveKind(appID string, kind string) error {
+	db := persistence.MustGetPGSession()
+	now := time.Now()
+	query := `update app_notification set dismissed_at = coalesce(dismissed_at, $1), resolved_at = $1 where app_id = $2 and kind = $3 and resolved_at is null`
+	_, err := db.Exec(query, now, appID, kind)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve notifications")
+	}
+
+	return nil
+}
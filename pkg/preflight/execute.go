@@ -15,30 +15,87 @@ import (
 	"k8s.io/client-go/rest"
 )
 
-// execute will execute the preflights using spec in preflightSpec.
+// execute will execute the preflights using spec in preflightSpec, and store the results in the run.
 // This spec should be rendered, no template functions remaining
-func execute(appID string, sequence int64, preflightSpec *troubleshootv1beta1.Preflight, ignorePermissionErrors bool) error {
+func execute(appID string, sequence int64, runID string, preflightSpec *troubleshootv1beta1.Preflight, ignorePermissionErrors bool) (finalErr error) {
 	logger.Debug("executing preflight checks",
 		zap.String("appID", appID),
 		zap.Int64("sequence", sequence))
 
+	tracker := newProgressTracker(preflightSpec, time.Now())
+	saveProgress := func() {
+		b, err := tracker.marshal()
+		if err != nil {
+			logger.Error(errors.Wrap(err, "failed to marshal preflight progress"))
+			return
+		}
+		if err := setRunProgress(runID, b); err != nil {
+			logger.Error(err)
+		}
+	}
+	saveProgress()
+
 	progressChan := make(chan interface{}, 0) // non-zero buffer will result in missed messages
-	defer close(progressChan)
+	progressDone := make(chan struct{})
+	defer func() {
+		close(progressChan)
+		<-progressDone
+
+		if finalErr != nil {
+			tracker.finish(PhaseFailed, time.Now())
+		} else {
+			tracker.finish(PhaseCompleted, time.Now())
+		}
+		saveProgress()
+	}()
 
 	go func() {
+		defer close(progressDone)
 		for {
 			msg, ok := <-progressChan
 			if ok {
 				logger.Debugf("%v", msg)
+				tracker.handleMessage(msg, time.Now())
+				saveProgress()
 			} else {
 				return
 			}
 		}
 	}()
 
+	uploadPreflightResults, err := collectAndAnalyze(preflightSpec, ignorePermissionErrors, progressChan, tracker, saveProgress)
+	if err != nil {
+		return errors.Wrap(err, "failed to run preflight checks")
+	}
+
+	logger.Debug("preflight marshalling")
+	b, err := json.Marshal(uploadPreflightResults)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal results")
+	}
+	db := persistence.MustGetPGSession()
+	query := `update app_downstream_version set preflight_result = $1, preflight_result_created_at = $2,
+status = (case when status = 'deployed' then 'deployed' else 'pending' end)
+where app_id = $3 and parent_sequence = $4`
+
+	_, err = db.Exec(query, b, time.Now(), appID, sequence)
+	if err != nil {
+		return errors.Wrap(err, "failed to write preflight results")
+	}
+
+	if err := completeRun(runID, b); err != nil {
+		return errors.Wrap(err, "failed to complete preflight run")
+	}
+
+	return nil
+}
+
+// collectAndAnalyze runs the collectors and analyzers of the spec. When collection stops for RBAC errors, the
+// errors are returned in the results instead of the analysis
+func collectAndAnalyze(preflightSpec *troubleshootv1beta1.Preflight, ignorePermissionErrors bool, progressChan chan interface{}, tracker *progressTracker, saveProgress func()) (*troubleshootpreflight.UploadPreflightResults, error) {
 	restConfig, err := rest.InClusterConfig()
 	if err != nil {
-		return errors.Wrap(err, "failed to read in cluster config")
+		return nil, errors.Wrap(err, "failed to read in cluster config")
 	}
 
 	collectOpts := troubleshootpreflight.CollectOpts{
@@ -50,8 +107,11 @@ func execute(appID string, sequence int64, preflightSpec *troubleshootv1beta1.Pr
 
 	logger.Debug("preflight collect phase")
 	collectResults, err := troubleshootpreflight.Collect(collectOpts, preflightSpec)
+	if collectResults != nil {
+		tracker.collectDone(collectResults.Collectors, time.Now())
+	}
 	if err != nil && !isPermissionsError(err) {
-		return errors.Wrap(err, "failed to collect")
+		return nil, errors.Wrap(err, "failed to collect")
 	}
 
 	uploadPreflightResults := &troubleshootpreflight.UploadPreflightResults{}
@@ -68,6 +128,8 @@ func execute(appID string, sequence int64, preflightSpec *troubleshootv1beta1.Pr
 		uploadPreflightResults.Errors = rbacErrors
 	} else {
 		logger.Debug("preflight analyze phase")
+		tracker.analyzeStarted(time.Now())
+		saveProgress()
 		analyzeResults := collectResults.Analyze()
 
 		// the typescript api added some flair to this result
@@ -89,22 +151,7 @@ func execute(appID string, sequence int64, preflightSpec *troubleshootv1beta1.Pr
 		uploadPreflightResults.Results = results
 	}
 
-	logger.Debug("preflight marshalling")
-	b, err := json.Marshal(uploadPreflightResults)
-	if err != nil {
-		return errors.Wrap(err, "failed to marshal results")
-	}
-	db := persistence.MustGetPGSession()
-	query := `update app_downstream_version set preflight_result = $1, preflight_result_created_at = $2,
-status = (case when status = 'deployed' then 'deployed' else 'pending' end)
-where app_id = $3 and parent_sequence = $4`
-
-	_, err = db.Exec(query, b, time.Now(), appID, sequence)
-	if err != nil {
-		return errors.Wrap(err, "failed to write preflight results")
-	}
-
-	return nil
+	return uploadPreflightResults, nil
 }
 
 func isPermissionsError(err error) bool {
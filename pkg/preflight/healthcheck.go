@@ -0,0 +1,520 @@
+package preflight
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/notification"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+	troubleshootv1beta1 "github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta1"
+	troubleshootpreflight "github.com/replicatedhq/troubleshoot/pkg/preflight"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	// HealthChecksAnnotation on the Preflight spec lists the check names of the analyzers that the vendor wants
+	// to keep running against the live cluster after deploy, separated by commas
+	HealthChecksAnnotation = "kots.io/health-checks"
+
+	DefaultHealthCheckIntervalMinutes = 15
+
+	healthCheckRetention        = 30 * 24 * time.Hour
+	healthCheckNotificationKind = "health_check"
+)
+
+// HealthCheckSettings are the health check choices of the admin of an app
+type HealthCheckSettings struct {
+	// Checks are the check names of analyzers to run as health checks, in addition to the ones the vendor marked
+	Checks          []string `json:"checks"`
+	IntervalMinutes int      `json:"intervalMinutes"`
+	// Disabled stops all health checks, including the ones the vendor marked
+	Disabled bool `json:"disabled"`
+}
+
+// HealthCheckRun is a single run of the health checks of the deployed version of an app
+type HealthCheckRun struct {
+	ID        string                                        `json:"id"`
+	AppID     string                                        `json:"appId"`
+	Sequence  int64                                         `json:"sequence"`
+	Status    string                                        `json:"status"`
+	Result    *troubleshootpreflight.UploadPreflightResults `json:"result,omitempty"`
+	Error     string                                        `json:"error,omitempty"`
+	CreatedAt time.Time                                     `json:"createdAt"`
+}
+
+func GetHealthCheckSettings(appID string) (*HealthCheckSettings, error) {
+	db := persistence.MustGetPGSession()
+	query := `select health_checks from app where id = $1`
+	row := db.QueryRow(query, appID)
+
+	var marshalled sql.NullString
+	if err := row.Scan(&marshalled); err != nil {
+		return nil, errors.Wrap(err, "failed to scan health check settings")
+	}
+
+	settings := HealthCheckSettings{
+		Checks:          []string{},
+		IntervalMinutes: DefaultHealthCheckIntervalMinutes,
+	}
+	if marshalled.String == "" {
+		return &settings, nil
+	}
+
+	if err := json.Unmarshal([]byte(marshalled.String), &settings); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal health check settings")
+	}
+	if settings.IntervalMinutes <= 0 {
+		settings.IntervalMinutes = DefaultHealthCheckIntervalMinutes
+	}
+
+	return &settings, nil
+}
+
+func SetHealthCheckSettings(appID string, settings *HealthCheckSettings) error {
+	if settings.IntervalMinutes < 0 {
+		return errors.New("interval must be at least 1 minute")
+	}
+	if settings.IntervalMinutes == 0 {
+		settings.IntervalMinutes = DefaultHealthCheckIntervalMinutes
+	}
+	if settings.Checks == nil {
+		settings.Checks = []string{}
+	}
+
+	marshalled, err := json.Marshal(settings)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal health check settings")
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `update app set health_checks = $1 where id = $2`
+	if _, err := db.Exec(query, string(marshalled), appID); err != nil {
+		return errors.Wrap(err, "failed to set health check settings")
+	}
+
+	return nil
+}
+
+// RunHealthChecks runs the health checks of the deployed version of the app against the live cluster, stores the
+// results and replaces the notifications of checks whose status changed since the last completed run. Nil is
+// returned when the app has nothing deployed or no health checks
+func RunHealthChecks(appID string) (*HealthCheckRun, error) {
+	settings, err := GetHealthCheckSettings(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get health check settings")
+	}
+	if settings.Disabled {
+		return nil, nil
+	}
+
+	sequence, err := deployedSequence(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get deployed sequence")
+	}
+	if sequence == -1 {
+		return nil, nil
+	}
+
+	archiveDir, err := version.GetAppVersionArchive(appID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get app version archive")
+	}
+	defer os.RemoveAll(archiveDir)
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load kots kinds")
+	}
+	if kotsKinds.Preflight == nil {
+		return nil, nil
+	}
+
+	preflightSpec, _, err := renderPreflight(appID, kotsKinds)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render preflight")
+	}
+
+	checks := healthChecks(preflightSpec, settings)
+	if len(checks) == 0 {
+		return nil, nil
+	}
+
+	healthSpec, err := healthCheckSpec(preflightSpec, checks)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build health check spec")
+	}
+
+	// checks are compared to the last run that completed, a run that failed has no results to compare to
+	previousRun, err := getLatestCompletedHealthCheckRun(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get previous health check run")
+	}
+
+	run := HealthCheckRun{
+		ID:        ksuid.New().String(),
+		AppID:     appID,
+		Sequence:  sequence,
+		Status:    RunStatusCompleted,
+		CreatedAt: time.Now(),
+	}
+
+	uploadPreflightResults, err := collectAndAnalyzeHealthChecks(healthSpec)
+	if err != nil {
+		logger.Error(errors.Wrapf(err, "failed to run health checks for app %s", appID))
+		run.Status = RunStatusFailed
+		run.Error = errors.Cause(err).Error()
+	} else {
+		run.Result = filterChecks(uploadPreflightResults, checks)
+	}
+
+	if err := insertHealthCheckRun(&run); err != nil {
+		return nil, errors.Wrap(err, "failed to insert health check run")
+	}
+
+	if run.Status == RunStatusCompleted {
+		var previous *troubleshootpreflight.UploadPreflightResults
+		if previousRun != nil {
+			previous = previousRun.Result
+		}
+		if err := notifyHealthCheckChanges(appID, previous, run.Result); err != nil {
+			logger.Error(errors.Wrapf(err, "failed to notify about health checks for app %s", appID))
+		}
+	}
+
+	if err := pruneHealthCheckRuns(appID, time.Now().Add(-healthCheckRetention)); err != nil {
+		logger.Error(errors.Wrapf(err, "failed to prune health check runs for app %s", appID))
+	}
+
+	return &run, nil
+}
+
+// ListHealthCheckRuns returns the latest health check runs of the app, newest first
+func ListHealthCheckRuns(appID string, limit int) ([]*HealthCheckRun, error) {
+	db := persistence.MustGetPGSession()
+	query := `select id, app_id, sequence, status, result, error, created_at from health_check_run where app_id = $1 order by created_at desc limit $2`
+	rows, err := db.Query(query, appID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query health check runs")
+	}
+	defer rows.Close()
+
+	runs := []*HealthCheckRun{}
+	for rows.Next() {
+		run, err := scanHealthCheckRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// VendorHealthChecks returns the check names that the vendor marked as health checks in the preflight spec
+func VendorHealthChecks(preflightSpec *troubleshootv1beta1.Preflight) []string {
+	checks := []string{}
+	for _, check := range strings.Split(preflightSpec.Annotations[HealthChecksAnnotation], ",") {
+		check = strings.TrimSpace(check)
+		if check != "" {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// healthChecks returns the check names marked by the vendor and chosen by the admin
+func healthChecks(preflightSpec *troubleshootv1beta1.Preflight, settings *HealthCheckSettings) []string {
+	checks := []string{}
+	seen := map[string]bool{}
+	for _, check := range append(VendorHealthChecks(preflightSpec), settings.Checks...) {
+		if check == "" || seen[check] {
+			continue
+		}
+		seen[check] = true
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// filterChecks keeps the results of the health checks. Errors are kept, since they affect all checks
+func filterChecks(uploadPreflightResults *troubleshootpreflight.UploadPreflightResults, checks []string) *troubleshootpreflight.UploadPreflightResults {
+	isHealthCheck := map[string]bool{}
+	for _, check := range checks {
+		isHealthCheck[check] = true
+	}
+
+	filtered := &troubleshootpreflight.UploadPreflightResults{
+		Results: []*troubleshootpreflight.UploadPreflightResult{},
+		Errors:  uploadPreflightResults.Errors,
+	}
+	for _, result := range uploadPreflightResults.Results {
+		if isHealthCheck[result.Title] {
+			filtered.Results = append(filtered.Results, result)
+		}
+	}
+
+	return filtered
+}
+
+// healthCheckSpec returns a copy of the preflight spec with only the analyzers of the health checks and the
+// collectors that those analyzers read, so that run pod, copy and http collectors don't run on every interval.
+// Analyzers without a check name are kept, since their title is only known once they run. Troubleshoot always
+// adds the cluster info and cluster resources collectors
+func healthCheckSpec(preflightSpec *troubleshootv1beta1.Preflight, checks []string) (*troubleshootv1beta1.Preflight, error) {
+	isHealthCheck := map[string]bool{}
+	for _, check := range checks {
+		isHealthCheck[check] = true
+	}
+
+	spec := preflightSpec.DeepCopy()
+	analyzers := spec.Spec.Analyzers
+	collectors := spec.Spec.Collectors
+	spec.Spec.Analyzers = []*troubleshootv1beta1.Analyze{}
+	spec.Spec.Collectors = []*troubleshootv1beta1.Collect{}
+
+	collectorNames := map[string]bool{}
+	secrets := map[string]bool{}
+	for _, analyze := range analyzers {
+		kind, fields, err := specFields(analyze)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read analyzer")
+		}
+
+		checkName := stringField(fields, "checkName")
+		if checkName != "" && !isHealthCheck[checkName] {
+			continue
+		}
+		spec.Spec.Analyzers = append(spec.Spec.Analyzers, analyze)
+
+		if collectorName := stringField(fields, "collectorName"); collectorName != "" {
+			collectorNames[collectorName] = true
+		}
+		if kind == "secret" {
+			secrets[fmt.Sprintf("%s/%s", stringField(fields, "namespace"), stringField(fields, "secretName"))] = true
+		}
+	}
+
+	for _, collect := range collectors {
+		kind, fields, err := specFields(collect)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read collector")
+		}
+
+		needed := false
+		switch kind {
+		case "clusterInfo", "clusterResources":
+			needed = true
+		case "secret":
+			needed = secrets[fmt.Sprintf("%s/%s", stringField(fields, "namespace"), stringField(fields, "name"))]
+		default:
+			needed = collectorNames[stringField(fields, "collectorName")] || collectorNames[stringField(fields, "name")]
+		}
+		if needed {
+			spec.Spec.Collectors = append(spec.Spec.Collectors, collect)
+		}
+	}
+
+	return spec, nil
+}
+
+// specFields returns the type of an analyzer or collector, like textAnalyze or run, and its fields
+func specFields(spec interface{}) (string, map[string]interface{}, error) {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to marshal spec")
+	}
+	kinds := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &kinds); err != nil {
+		return "", nil, errors.Wrap(err, "failed to unmarshal spec")
+	}
+
+	for kind, value := range kinds {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(value, &fields); err != nil || fields == nil {
+			continue
+		}
+		return kind, fields, nil
+	}
+
+	return "", map[string]interface{}{}, nil
+}
+
+func stringField(fields map[string]interface{}, key string) string {
+	value, _ := fields[key].(string)
+	return value
+}
+
+// collectAndAnalyzeHealthChecks runs the preflight spec. Permission errors are ignored, so that the checks
+// that can run still report
+func collectAndAnalyzeHealthChecks(preflightSpec *troubleshootv1beta1.Preflight) (*troubleshootpreflight.UploadPreflightResults, error) {
+	progressChan := make(chan interface{}, 0) // non-zero buffer will result in missed messages
+	defer close(progressChan)
+
+	go func() {
+		for {
+			msg, ok := <-progressChan
+			if ok {
+				logger.Debugf("%v", msg)
+			} else {
+				return
+			}
+		}
+	}()
+
+	tracker := newProgressTracker(preflightSpec, time.Now())
+	return collectAndAnalyze(preflightSpec, true, progressChan, tracker, func() {})
+}
+
+// healthCheckChanges returns the checks whose status is different from the previous run. The previous status is
+// empty for checks that were not in the previous run, or when there is no previous run
+func healthCheckChanges(previous *troubleshootpreflight.UploadPreflightResults, current *troubleshootpreflight.UploadPreflightResults) []*PreflightCheckChange {
+	previousChecks := checkStatuses(previous)
+
+	changes := []*PreflightCheckChange{}
+	for _, result := range resultsOf(current) {
+		change := &PreflightCheckChange{
+			Title:      result.Title,
+			FromStatus: checkStatus(previousChecks[result.Title]),
+			ToStatus:   checkStatus(result),
+			Message:    result.Message,
+		}
+		if change.ToStatus == "" || change.ToStatus == change.FromStatus {
+			continue
+		}
+		if change.FromStatus == "" && change.ToStatus == CheckStatusPass {
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// notifyHealthCheckChanges replaces the notification of every check whose status changed, so that a check
+// that went from fail to warn no longer shows as failing. Checks that pass again only have theirs resolved
+func notifyHealthCheckChanges(appID string, previous *troubleshootpreflight.UploadPreflightResults, current *troubleshootpreflight.UploadPreflightResults) error {
+	for _, change := range healthCheckChanges(previous, current) {
+		kind := healthCheckKind(change.Title)
+
+		if err := notification.ResolveKind(appID, kind); err != nil {
+			return errors.Wrap(err, "failed to resolve health check notifications")
+		}
+
+		if change.ToStatus == CheckStatusPass {
+			continue
+		}
+
+		severity := notification.SeverityWarning
+		title := fmt.Sprintf("Health check %q has a warning", change.Title)
+		if change.ToStatus == CheckStatusFail {
+			severity = notification.SeverityError
+			title = fmt.Sprintf("Health check %q is failing", change.Title)
+		}
+
+		if err := notification.Create(appID, kind, fmt.Sprintf("%s:%s", kind, change.ToStatus), severity, title, change.Message); err != nil {
+			return errors.Wrap(err, "failed to create health check notification")
+		}
+	}
+
+	return nil
+}
+
+func healthCheckKind(title string) string {
+	return fmt.Sprintf("%s:%s", healthCheckNotificationKind, title)
+}
+
+// deployedSequence returns the sequence that is deployed to the downstream of the app, or -1
+func deployedSequence(appID string) (int64, error) {
+	downstreams, err := downstream.ListDownstreamsForApp(appID)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to list downstreams")
+	}
+
+	for _, d := range downstreams {
+		if d.CurrentSequence != -1 {
+			return d.CurrentSequence, nil
+		}
+	}
+
+	return -1, nil
+}
+
+func getLatestCompletedHealthCheckRun(appID string) (*HealthCheckRun, error) {
+	db := persistence.MustGetPGSession()
+	query := `select id, app_id, sequence, status, result, error, created_at from health_check_run where app_id = $1 and status = $2 order by created_at desc limit 1`
+	row := db.QueryRow(query, appID, RunStatusCompleted)
+
+	run, err := scanHealthCheckRun(row)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func insertHealthCheckRun(run *HealthCheckRun) error {
+	var result []byte
+	if run.Result != nil {
+		b, err := json.Marshal(run.Result)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal health check results")
+		}
+		result = b
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `insert into health_check_run (id, app_id, sequence, status, result, error, created_at) values ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := db.Exec(query, run.ID, run.AppID, run.Sequence, run.Status, string(result), run.Error, run.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert health check run")
+	}
+
+	return nil
+}
+
+func pruneHealthCheckRuns(appID string, before time.Time) error {
+	db := persistence.MustGetPGSession()
+	query := `delete from health_check_run where app_id = $1 and created_at < $2`
+	_, err := db.Exec(query, appID, before)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete health check runs")
+	}
+
+	return nil
+}
+
+func scanHealthCheckRun(row scanner) (*HealthCheckRun, error) {
+	run := HealthCheckRun{}
+
+	var status sql.NullString
+	var result sql.NullString
+	var runError sql.NullString
+	if err := row.Scan(&run.ID, &run.AppID, &run.Sequence, &status, &result, &runError, &run.CreatedAt); err != nil {
+		return nil, errors.Wrap(err, "failed to scan health check run")
+	}
+
+	run.Status = status.String
+	run.Error = runError.String
+
+	if result.String != "" {
+		uploadPreflightResults := troubleshootpreflight.UploadPreflightResults{}
+		if err := json.Unmarshal([]byte(result.String), &uploadPreflightResults); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal health check results")
+		}
+		run.Result = &uploadPreflightResults
+	}
+
+	return &run, nil
+}
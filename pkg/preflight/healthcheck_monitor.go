@@ -0,0 +1,96 @@
+package preflight
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+)
+
+const healthCheckMonitorInterval = time.Minute
+
+var (
+	lastHealthChecks    = map[string]time.Time{}
+	runningHealthChecks = map[string]bool{}
+	healthChecksMu      sync.Mutex
+)
+
+// StartHealthCheckMonitor runs the health checks of every installed app in the background, on the interval
+// in the health check settings of the app
+func StartHealthCheckMonitor() {
+	go func() {
+		for {
+			runDueHealthChecks(time.Now())
+			time.Sleep(healthCheckMonitorInterval)
+		}
+	}()
+}
+
+// StartHealthChecks runs the health checks of the app now, unless they are already running
+func StartHealthChecks(appID string) bool {
+	if !startHealthCheck(appID, time.Now()) {
+		return false
+	}
+
+	go runHealthChecks(appID)
+	return true
+}
+
+func runDueHealthChecks(now time.Time) {
+	apps, err := app.ListInstalled()
+	if err != nil {
+		logger.Error(errors.Wrap(err, "failed to list apps to run health checks"))
+		return
+	}
+
+	for _, a := range apps {
+		settings, err := GetHealthCheckSettings(a.ID)
+		if err != nil {
+			logger.Error(errors.Wrapf(err, "failed to get health check settings for app %s", a.Slug))
+			continue
+		}
+		if settings.Disabled {
+			continue
+		}
+
+		healthChecksMu.Lock()
+		lastHealthCheck, ok := lastHealthChecks[a.ID]
+		isDue := !ok || now.Sub(lastHealthCheck) >= time.Duration(settings.IntervalMinutes)*time.Minute
+		healthChecksMu.Unlock()
+		if !isDue {
+			continue
+		}
+
+		if !startHealthCheck(a.ID, now) {
+			logger.Debugf("health checks for app %s are still running, skipping", a.Slug)
+			continue
+		}
+		go runHealthChecks(a.ID)
+	}
+}
+
+func startHealthCheck(appID string, now time.Time) bool {
+	healthChecksMu.Lock()
+	defer healthChecksMu.Unlock()
+
+	if runningHealthChecks[appID] {
+		return false
+	}
+	runningHealthChecks[appID] = true
+	lastHealthChecks[appID] = now
+	return true
+}
+
+func runHealthChecks(appID string) {
+	defer func() {
+		healthChecksMu.Lock()
+		delete(runningHealthChecks, appID)
+		healthChecksMu.Unlock()
+	}()
+
+	if _, err := RunHealthChecks(appID); err != nil {
+		logger.Error(errors.Wrapf(err, "failed to run health checks for app %s", appID))
+	}
+}
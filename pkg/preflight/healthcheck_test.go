@@ -0,0 +1,121 @@
+package preflight
+
+import (
+	"testing"
+
+	troubleshootv1beta1 "github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta1"
+	troubleshootpreflight "github.com/replicatedhq/troubleshoot/pkg/preflight"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_healthChecks(t *testing.T) {
+	req := require.New(t)
+
+	preflightSpec := &troubleshootv1beta1.Preflight{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				HealthChecksAnnotation: "Disk pressure, Certificate expiry,",
+			},
+		},
+	}
+	settings := &HealthCheckSettings{
+		Checks: []string{"Memory", "Disk pressure"},
+	}
+
+	req.Equal([]string{"Disk pressure", "Certificate expiry", "Memory"}, healthChecks(preflightSpec, settings))
+	req.Empty(healthChecks(&troubleshootv1beta1.Preflight{}, &HealthCheckSettings{}))
+}
+
+func Test_filterChecks(t *testing.T) {
+	req := require.New(t)
+
+	uploadPreflightResults := &troubleshootpreflight.UploadPreflightResults{
+		Results: []*troubleshootpreflight.UploadPreflightResult{
+			{Title: "Disk pressure", IsPass: true},
+			{Title: "Kubernetes version", IsPass: true},
+		},
+		Errors: []*troubleshootpreflight.UploadPreflightError{
+			{Error: "cannot list nodes"},
+		},
+	}
+
+	filtered := filterChecks(uploadPreflightResults, []string{"Disk pressure"})
+	req.Equal([]*troubleshootpreflight.UploadPreflightResult{
+		{Title: "Disk pressure", IsPass: true},
+	}, filtered.Results)
+	req.Equal(uploadPreflightResults.Errors, filtered.Errors)
+}
+
+func Test_healthCheckChanges(t *testing.T) {
+	req := require.New(t)
+
+	previous := &troubleshootpreflight.UploadPreflightResults{
+		Results: []*troubleshootpreflight.UploadPreflightResult{
+			{Title: "Disk pressure", IsPass: true},
+			{Title: "Certificate expiry", IsWarn: true},
+			{Title: "Memory", IsFail: true},
+			{Title: "Nodes", IsPass: true},
+		},
+	}
+	current := &troubleshootpreflight.UploadPreflightResults{
+		Results: []*troubleshootpreflight.UploadPreflightResult{
+			{Title: "Disk pressure", IsWarn: true, Message: "disk is 85% full"},
+			{Title: "Certificate expiry", IsFail: true, Message: "expires in 2 days"},
+			{Title: "Memory", IsPass: true, Message: "enough memory"},
+			{Title: "Nodes", IsPass: true},
+			{Title: "New", IsFail: true},
+		},
+	}
+
+	req.Equal([]*PreflightCheckChange{
+		{Title: "Disk pressure", FromStatus: CheckStatusPass, ToStatus: CheckStatusWarn, Message: "disk is 85% full"},
+		{Title: "Certificate expiry", FromStatus: CheckStatusWarn, ToStatus: CheckStatusFail, Message: "expires in 2 days"},
+		{Title: "Memory", FromStatus: CheckStatusFail, ToStatus: CheckStatusPass, Message: "enough memory"},
+		{Title: "New", FromStatus: "", ToStatus: CheckStatusFail},
+	}, healthCheckChanges(previous, current))
+
+	// fail to warn replaces the failing notification
+	req.Equal([]*PreflightCheckChange{
+		{Title: "Certificate expiry", FromStatus: CheckStatusFail, ToStatus: CheckStatusWarn, Message: "expires in 20 days"},
+	}, healthCheckChanges(current, &troubleshootpreflight.UploadPreflightResults{
+		Results: []*troubleshootpreflight.UploadPreflightResult{
+			{Title: "Certificate expiry", IsWarn: true, Message: "expires in 20 days"},
+		},
+	}))
+
+	// without a previous run, checks that don't pass are new
+	req.Equal([]*PreflightCheckChange{
+		{Title: "Disk pressure", FromStatus: "", ToStatus: CheckStatusWarn, Message: "disk is 85% full"},
+		{Title: "Certificate expiry", FromStatus: "", ToStatus: CheckStatusFail, Message: "expires in 2 days"},
+		{Title: "New", FromStatus: "", ToStatus: CheckStatusFail},
+	}, healthCheckChanges(nil, current))
+}
+
+func Test_healthCheckSpec(t *testing.T) {
+	req := require.New(t)
+
+	preflightSpec := &troubleshootv1beta1.Preflight{
+		Spec: troubleshootv1beta1.PreflightSpec{
+			Collectors: []*troubleshootv1beta1.Collect{
+				{ClusterResources: &troubleshootv1beta1.ClusterResources{}},
+				{Run: &troubleshootv1beta1.Run{CollectorMeta: troubleshootv1beta1.CollectorMeta{CollectorName: "ping"}, Image: "busybox"}},
+				{Run: &troubleshootv1beta1.Run{CollectorMeta: troubleshootv1beta1.CollectorMeta{CollectorName: "disk"}, Image: "busybox"}},
+				{HTTP: &troubleshootv1beta1.HTTP{CollectorMeta: troubleshootv1beta1.CollectorMeta{CollectorName: "healthz"}}},
+			},
+			Analyzers: []*troubleshootv1beta1.Analyze{
+				{ClusterVersion: &troubleshootv1beta1.ClusterVersion{AnalyzeMeta: troubleshootv1beta1.AnalyzeMeta{CheckName: "Kubernetes version"}}},
+				{TextAnalyze: &troubleshootv1beta1.TextAnalyze{AnalyzeMeta: troubleshootv1beta1.AnalyzeMeta{CheckName: "Disk pressure"}, CollectorName: "disk"}},
+				{TextAnalyze: &troubleshootv1beta1.TextAnalyze{AnalyzeMeta: troubleshootv1beta1.AnalyzeMeta{CheckName: "Healthz"}, CollectorName: "healthz"}},
+			},
+		},
+	}
+
+	spec, err := healthCheckSpec(preflightSpec, []string{"Disk pressure"})
+	req.NoError(err)
+
+	req.Equal([]*troubleshootv1beta1.Analyze{preflightSpec.Spec.Analyzers[1]}, spec.Spec.Analyzers)
+	req.Equal([]*troubleshootv1beta1.Collect{preflightSpec.Spec.Collectors[0], preflightSpec.Spec.Collectors[2]}, spec.Spec.Collectors)
+	req.Len(preflightSpec.Spec.Analyzers, 3)
+}
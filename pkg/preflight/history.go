@@ -0,0 +1,301 @@
+package preflight
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	troubleshootpreflight "github.com/replicatedhq/troubleshoot/pkg/preflight"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	TriggerUpdate     = "update"
+	TriggerUpload     = "upload"
+	TriggerAirgap     = "airgap"
+	TriggerConfig     = "config"
+	TriggerLicense    = "license"
+	TriggerRegistry   = "registry"
+	TriggerManual     = "manual"
+	TriggerIgnoreRBAC = "ignore_rbac"
+	TriggerCLI        = "cli" // results uploaded by the kots cli, recorded by the node api
+
+	RunStatusRunning   = "running"
+	RunStatusCompleted = "completed"
+	RunStatusFailed    = "failed"
+
+	CheckStatusPass = "pass"
+	CheckStatusWarn = "warn"
+	CheckStatusFail = "fail"
+)
+
+// PreflightRun is a single run of the preflight checks of an app version
+type PreflightRun struct {
+	ID          string                                        `json:"id"`
+	AppID       string                                        `json:"appId"`
+	Sequence    int64                                         `json:"sequence"`
+	Trigger     string                                        `json:"trigger"`
+	SpecDigest  string                                        `json:"specDigest"`
+	Status      string                                        `json:"status"`
+	Result      *troubleshootpreflight.UploadPreflightResults `json:"result,omitempty"`
+	Error       string                                        `json:"error,omitempty"`
+	Progress    *RunProgress                                  `json:"progress,omitempty"`
+	StartedAt   time.Time                                     `json:"startedAt"`
+	CompletedAt *time.Time                                    `json:"completedAt,omitempty"`
+}
+
+// PreflightCheckChange is a check whose status is different between two runs. The status is empty
+// when the check was not in the run
+type PreflightCheckChange struct {
+	Title      string `json:"title"`
+	FromStatus string `json:"fromStatus"`
+	ToStatus   string `json:"toStatus"`
+	Message    string `json:"message"`
+}
+
+type PreflightRunDiff struct {
+	FromRun    *PreflightRun           `json:"fromRun"`
+	ToRun      *PreflightRun           `json:"toRun"`
+	PassToFail []*PreflightCheckChange `json:"passToFail"`
+	FailToPass []*PreflightCheckChange `json:"failToPass"`
+	Other      []*PreflightCheckChange `json:"other"`
+}
+
+func createRun(appID string, sequence int64, trigger string, specDigest string) (string, error) {
+	id := ksuid.New().String()
+
+	db := persistence.MustGetPGSession()
+	query := `insert into preflight_run (id, app_id, sequence, trigger, spec_digest, status, started_at) values ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := db.Exec(query, id, appID, sequence, trigger, specDigest, RunStatusRunning, time.Now())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to insert preflight run")
+	}
+
+	return id, nil
+}
+
+func completeRun(runID string, result []byte) error {
+	db := persistence.MustGetPGSession()
+	query := `update preflight_run set status = $1, result = $2, completed_at = $3 where id = $4`
+	_, err := db.Exec(query, RunStatusCompleted, string(result), time.Now(), runID)
+	if err != nil {
+		return errors.Wrap(err, "failed to complete preflight run")
+	}
+
+	return nil
+}
+
+func failRun(runID string, runErr error) error {
+	db := persistence.MustGetPGSession()
+	query := `update preflight_run set status = $1, error = $2, completed_at = $3 where id = $4`
+	_, err := db.Exec(query, RunStatusFailed, errors.Cause(runErr).Error(), time.Now(), runID)
+	if err != nil {
+		return errors.Wrap(err, "failed to fail preflight run")
+	}
+
+	return nil
+}
+
+// ListRuns returns the preflight runs of the app, newest first. When sequence is not nil, only the runs of
+// that sequence are returned
+func ListRuns(appID string, sequence *int64) ([]*PreflightRun, error) {
+	db := persistence.MustGetPGSession()
+	query := `select id, app_id, sequence, trigger, spec_digest, status, result, error, progress, started_at, completed_at
+from preflight_run where app_id = $1 and ($2::integer is null or sequence = $2) order by started_at desc`
+	rows, err := db.Query(query, appID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query preflight runs")
+	}
+	defer rows.Close()
+
+	runs := []*PreflightRun{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+func GetRun(appID string, runID string) (*PreflightRun, error) {
+	db := persistence.MustGetPGSession()
+	query := `select id, app_id, sequence, trigger, spec_digest, status, result, error, progress, started_at, completed_at
+from preflight_run where app_id = $1 and id = $2`
+	row := db.QueryRow(query, appID, runID)
+
+	return scanRun(row)
+}
+
+// GetLastPassingRun returns the newest completed run without failing checks or errors that started before
+// the given run, or nil if there is none
+func GetLastPassingRun(appID string, before *PreflightRun) (*PreflightRun, error) {
+	runs, err := ListRuns(appID, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list preflight runs")
+	}
+
+	for _, run := range runs {
+		if !run.StartedAt.Before(before.StartedAt) {
+			continue
+		}
+		if run.Status == RunStatusCompleted && !hasFailures(run.Result) {
+			return run, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// DiffRuns compares the checks of two runs, matching checks by title
+func DiffRuns(fromRun *PreflightRun, toRun *PreflightRun) *PreflightRunDiff {
+	diff := PreflightRunDiff{
+		FromRun:    fromRun,
+		ToRun:      toRun,
+		PassToFail: []*PreflightCheckChange{},
+		FailToPass: []*PreflightCheckChange{},
+		Other:      []*PreflightCheckChange{},
+	}
+
+	fromChecks := checkStatuses(fromRun.Result)
+	toChecks := checkStatuses(toRun.Result)
+
+	titles := []string{}
+	for _, result := range resultsOf(toRun.Result) {
+		titles = append(titles, result.Title)
+	}
+	for _, result := range resultsOf(fromRun.Result) {
+		if _, ok := toChecks[result.Title]; !ok {
+			titles = append(titles, result.Title)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, title := range titles {
+		if seen[title] {
+			continue
+		}
+		seen[title] = true
+
+		from, to := fromChecks[title], toChecks[title]
+		fromStatus, toStatus := checkStatus(from), checkStatus(to)
+		if fromStatus == toStatus {
+			continue
+		}
+
+		change := &PreflightCheckChange{
+			Title:      title,
+			FromStatus: fromStatus,
+			ToStatus:   toStatus,
+		}
+		if to != nil {
+			change.Message = to.Message
+		} else {
+			change.Message = from.Message
+		}
+
+		switch {
+		case fromStatus == CheckStatusPass && toStatus == CheckStatusFail:
+			diff.PassToFail = append(diff.PassToFail, change)
+		case fromStatus == CheckStatusFail && toStatus == CheckStatusPass:
+			diff.FailToPass = append(diff.FailToPass, change)
+		default:
+			diff.Other = append(diff.Other, change)
+		}
+	}
+
+	return &diff
+}
+
+func resultsOf(uploadPreflightResults *troubleshootpreflight.UploadPreflightResults) []*troubleshootpreflight.UploadPreflightResult {
+	if uploadPreflightResults == nil {
+		return nil
+	}
+	return uploadPreflightResults.Results
+}
+
+func checkStatuses(uploadPreflightResults *troubleshootpreflight.UploadPreflightResults) map[string]*troubleshootpreflight.UploadPreflightResult {
+	checks := map[string]*troubleshootpreflight.UploadPreflightResult{}
+	for _, result := range resultsOf(uploadPreflightResults) {
+		checks[result.Title] = result
+	}
+	return checks
+}
+
+func checkStatus(result *troubleshootpreflight.UploadPreflightResult) string {
+	switch {
+	case result == nil:
+		return ""
+	case result.IsFail:
+		return CheckStatusFail
+	case result.IsWarn:
+		return CheckStatusWarn
+	case result.IsPass:
+		return CheckStatusPass
+	}
+	return ""
+}
+
+func hasFailures(uploadPreflightResults *troubleshootpreflight.UploadPreflightResults) bool {
+	if uploadPreflightResults == nil {
+		return false
+	}
+	if len(uploadPreflightResults.Errors) > 0 {
+		return true
+	}
+	for _, result := range uploadPreflightResults.Results {
+		if result.IsFail {
+			return true
+		}
+	}
+	return false
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRun(row scanner) (*PreflightRun, error) {
+	run := PreflightRun{}
+
+	var trigger sql.NullString
+	var specDigest sql.NullString
+	var status sql.NullString
+	var result sql.NullString
+	var runError sql.NullString
+	var progress sql.NullString
+	var completedAt sql.NullTime
+	if err := row.Scan(&run.ID, &run.AppID, &run.Sequence, &trigger, &specDigest, &status, &result, &runError, &progress, &run.StartedAt, &completedAt); err != nil {
+		return nil, errors.Wrap(err, "failed to scan preflight run")
+	}
+
+	run.Trigger = trigger.String
+	run.SpecDigest = specDigest.String
+	run.Status = status.String
+	run.Error = runError.String
+	if completedAt.Valid {
+		run.CompletedAt = &completedAt.Time
+	}
+
+	if result.String != "" {
+		uploadPreflightResults := troubleshootpreflight.UploadPreflightResults{}
+		if err := json.Unmarshal([]byte(result.String), &uploadPreflightResults); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal preflight result")
+		}
+		run.Result = &uploadPreflightResults
+	}
+
+	if progress.String != "" {
+		runProgress := RunProgress{}
+		if err := json.Unmarshal([]byte(progress.String), &runProgress); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal preflight progress")
+		}
+		run.Progress = &runProgress
+	}
+
+	return &run, nil
+}
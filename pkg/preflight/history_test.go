@@ -0,0 +1,70 @@
+package preflight
+
+import (
+	"testing"
+
+	troubleshootpreflight "github.com/replicatedhq/troubleshoot/pkg/preflight"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_DiffRuns(t *testing.T) {
+	req := require.New(t)
+
+	fromRun := &PreflightRun{
+		ID: "from",
+		Result: &troubleshootpreflight.UploadPreflightResults{
+			Results: []*troubleshootpreflight.UploadPreflightResult{
+				{Title: "Kubernetes version", IsPass: true, Message: "1.18"},
+				{Title: "Memory", IsPass: true, Message: "enough memory"},
+				{Title: "Storage class", IsFail: true, Message: "no default storage class"},
+				{Title: "Ingress", IsPass: true, Message: "found"},
+				{Title: "Removed", IsPass: true, Message: "removed"},
+			},
+		},
+	}
+	toRun := &PreflightRun{
+		ID: "to",
+		Result: &troubleshootpreflight.UploadPreflightResults{
+			Results: []*troubleshootpreflight.UploadPreflightResult{
+				{Title: "Kubernetes version", IsPass: true, Message: "1.18"},
+				{Title: "Memory", IsFail: true, Message: "not enough memory"},
+				{Title: "Storage class", IsPass: true, Message: "found"},
+				{Title: "Ingress", IsWarn: true, Message: "not ready"},
+			},
+		},
+	}
+
+	diff := DiffRuns(fromRun, toRun)
+	req.Equal([]*PreflightCheckChange{
+		{Title: "Memory", FromStatus: CheckStatusPass, ToStatus: CheckStatusFail, Message: "not enough memory"},
+	}, diff.PassToFail)
+	req.Equal([]*PreflightCheckChange{
+		{Title: "Storage class", FromStatus: CheckStatusFail, ToStatus: CheckStatusPass, Message: "found"},
+	}, diff.FailToPass)
+	req.Equal([]*PreflightCheckChange{
+		{Title: "Ingress", FromStatus: CheckStatusPass, ToStatus: CheckStatusWarn, Message: "not ready"},
+		{Title: "Removed", FromStatus: CheckStatusPass, ToStatus: "", Message: "removed"},
+	}, diff.Other)
+}
+
+func Test_DiffRunsWithoutResults(t *testing.T) {
+	req := require.New(t)
+
+	fromRun := &PreflightRun{ID: "from", Status: RunStatusFailed}
+	toRun := &PreflightRun{
+		ID: "to",
+		Result: &troubleshootpreflight.UploadPreflightResults{
+			Results: []*troubleshootpreflight.UploadPreflightResult{
+				{Title: "Memory", IsPass: true},
+			},
+		},
+	}
+
+	diff := DiffRuns(fromRun, toRun)
+	req.Empty(diff.PassToFail)
+	req.Empty(diff.FailToPass)
+	req.Equal([]*PreflightCheckChange{
+		{Title: "Memory", FromStatus: "", ToStatus: CheckStatusPass},
+	}, diff.Other)
+}
@@ -1,19 +1,37 @@
 package preflight
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"fmt"
 
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/autodeploy"
 	"github.com/replicatedhq/kotsadm/pkg/downstream"
 	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
 	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/maintenance"
 	"github.com/replicatedhq/kotsadm/pkg/persistence"
 	registrytypes "github.com/replicatedhq/kotsadm/pkg/registry/types"
 	"github.com/replicatedhq/kotsadm/pkg/render"
+	troubleshootv1beta1 "github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta1"
 	"go.uber.org/zap"
 )
 
-func Run(appID string, sequence int64, archiveDir string) error {
+// Run starts the preflight checks of the sequence in the background. Each run is recorded with the
+// trigger, which describes what started it, such as an update or a config change
+func Run(appID string, sequence int64, archiveDir string, trigger string) error {
+	return run(appID, sequence, archiveDir, trigger, "")
+}
+
+// RunAndDeploy starts the preflight checks like Run, and deploys the sequence once they complete instead of
+// leaving it to the automatic deploy policy. The deploy goes through the preflight gating policy with the
+// results of this run, and is recorded with deploySource
+func RunAndDeploy(appID string, sequence int64, archiveDir string, trigger string, deploySource string) error {
+	return run(appID, sequence, archiveDir, trigger, deploySource)
+}
+
+func run(appID string, sequence int64, archiveDir string, trigger string, deploySource string) error {
 	renderedKotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
 	if err != nil {
 		return errors.Wrap(err, "failed to load rendered kots kinds")
@@ -43,45 +61,81 @@ func Run(appID string, sequence int64, archiveDir string) error {
 			return errors.Wrap(err, "failed to get ignore rbac flag")
 		}
 
-		// render the preflight file
-		// we need to convert to bytes first, so that we can reuse the renderfile function
-		renderedMarshalledPreflights, err := renderedKotsKinds.Marshal("troubleshoot.replicated.com", "v1beta1", "Preflight")
+		p, renderedPreflight, err := renderPreflight(appID, renderedKotsKinds)
 		if err != nil {
-			return errors.Wrap(err, "failed to marshal rendered preflight")
+			return errors.Wrap(err, "failed to render preflight")
 		}
 
-		registrySettings, err := getRegistrySettingsForApp(appID)
+		runID, err := createRun(appID, sequence, trigger, fmt.Sprintf("sha256:%x", sha256.Sum256(renderedPreflight)))
 		if err != nil {
-			return errors.Wrap(err, "failed to get registry settings for app")
-		}
-
-		renderedPreflight, err := render.RenderFile(renderedKotsKinds, registrySettings, []byte(renderedMarshalledPreflights))
-		if err != nil {
-			return errors.Wrap(err, "failed to render preflights")
-		}
-		p, err := kotsutil.LoadPreflightFromContents(renderedPreflight)
-		if err != nil {
-			return errors.Wrap(err, "failed to load rendered preflight")
+			return errors.Wrap(err, "failed to create preflight run")
 		}
 
 		go func() {
 			logger.Debug("preflight checks beginning")
-			if err := execute(appID, sequence, p, ignoreRBAC); err != nil {
+			if err := execute(appID, sequence, runID, p, ignoreRBAC); err != nil {
 				logger.Error(err)
+				if err := failRun(runID, err); err != nil {
+					logger.Error(err)
+				}
 				return
 			}
 
 			logger.Debug("preflight checks completed")
+
+			versionReady(appID, sequence, deploySource)
 		}()
 	} else {
 		if err := downstream.SetDownstreamVersionReady(appID, int64(sequence)); err != nil {
 			return errors.Wrap(err, "failed to set downstream version ready")
 		}
+
+		versionReady(appID, sequence, deploySource)
 	}
 
 	return nil
 }
 
+// versionReady deploys the sequence when the deploy was requested with the preflights, and otherwise
+// evaluates the automatic deploy policy
+func versionReady(appID string, sequence int64, deploySource string) {
+	if deploySource == "" {
+		autodeploy.VersionReady(appID, sequence)
+		return
+	}
+
+	// blocked deploys are recorded in the audit trail of the preflight gating policy
+	if _, err := maintenance.RequestDeploy(appID, sequence, deploySource, false, nil); err != nil {
+		logger.Error(errors.Wrapf(err, "failed to deploy sequence %d after preflights", sequence))
+	}
+}
+
+// renderPreflight renders the template functions in the preflight spec, and returns the spec and the rendered yaml
+func renderPreflight(appID string, renderedKotsKinds *kotsutil.KotsKinds) (*troubleshootv1beta1.Preflight, []byte, error) {
+	// render the preflight file
+	// we need to convert to bytes first, so that we can reuse the renderfile function
+	renderedMarshalledPreflights, err := renderedKotsKinds.Marshal("troubleshoot.replicated.com", "v1beta1", "Preflight")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to marshal rendered preflight")
+	}
+
+	registrySettings, err := getRegistrySettingsForApp(appID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get registry settings for app")
+	}
+
+	renderedPreflight, err := render.RenderFile(renderedKotsKinds, registrySettings, []byte(renderedMarshalledPreflights))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to render preflights")
+	}
+	p, err := kotsutil.LoadPreflightFromContents(renderedPreflight)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to load rendered preflight")
+	}
+
+	return p, renderedPreflight, nil
+}
+
 // this is a copy from registry.  so many import cycles to unwind here, todo
 func getRegistrySettingsForApp(appID string) (*registrytypes.RegistrySettings, error) {
 	db := persistence.MustGetPGSession()
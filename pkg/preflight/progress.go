@@ -0,0 +1,222 @@
+package preflight
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	troubleshootv1beta1 "github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta1"
+	troubleshootcollect "github.com/replicatedhq/troubleshoot/pkg/collect"
+)
+
+const (
+	PhaseCollecting = "collecting"
+	PhaseAnalyzing  = "analyzing"
+	PhaseCompleted  = "completed"
+	PhaseFailed     = "failed"
+
+	CollectorStatusPending   = "pending"
+	CollectorStatusRunning   = "running"
+	CollectorStatusCompleted = "completed"
+	CollectorStatusFailed    = "failed"
+	CollectorStatusSkipped   = "skipped"
+)
+
+// RunProgress is the progress of a preflight run, updated while the collectors and analyzers run
+type RunProgress struct {
+	Phase              string               `json:"phase"`
+	Collectors         []*CollectorProgress `json:"collectors"`
+	Analyzers          int                  `json:"analyzers"`
+	AnalyzeStartedAt   *time.Time           `json:"analyzeStartedAt,omitempty"`
+	AnalyzeCompletedAt *time.Time           `json:"analyzeCompletedAt,omitempty"`
+	Errors             []string             `json:"errors,omitempty"`
+	UpdatedAt          time.Time            `json:"updatedAt"`
+}
+
+type CollectorProgress struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	DurationMs  int64      `json:"durationMs"`
+	Error       string     `json:"error,omitempty"`
+	RBACErrors  []string   `json:"rbacErrors,omitempty"`
+}
+
+// progressTracker turns the messages that troubleshoot sends on the progress channel into the run progress.
+// Collectors run one at a time, and troubleshoot sends the name of each collector before running it,
+// an error when it fails, and a message when it is skipped because of RBAC errors
+type progressTracker struct {
+	mtx      sync.Mutex
+	progress RunProgress
+}
+
+func newProgressTracker(preflightSpec *troubleshootv1beta1.Preflight, now time.Time) *progressTracker {
+	t := &progressTracker{
+		progress: RunProgress{
+			Phase:      PhaseCollecting,
+			Collectors: []*CollectorProgress{},
+			Analyzers:  len(preflightSpec.Spec.Analyzers),
+			UpdatedAt:  now,
+		},
+	}
+
+	for _, collect := range preflightSpec.Spec.Collectors {
+		collector := troubleshootcollect.Collector{Collect: collect}
+		t.collector(collector.GetDisplayName())
+	}
+
+	return t
+}
+
+// handleMessage updates the progress with a message from the progress channel
+func (t *progressTracker) handleMessage(msg interface{}, now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.progress.UpdatedAt = now
+
+	switch msg := msg.(type) {
+	case error:
+		if running := t.running(); running != nil {
+			running.Status = CollectorStatusFailed
+			running.Error = msg.Error()
+			finishCollector(running, now)
+			return
+		}
+		t.progress.Errors = append(t.progress.Errors, msg.Error())
+
+	case string:
+		if name, ok := skippedCollectorName(msg); ok {
+			collector := t.collector(name)
+			collector.Status = CollectorStatusSkipped
+			return
+		}
+
+		t.finishRunning(now)
+
+		collector := t.collector(msg)
+		collector.Status = CollectorStatusRunning
+		collector.StartedAt = &now
+
+	default:
+		t.progress.Errors = append(t.progress.Errors, fmt.Sprintf("%v", msg))
+	}
+}
+
+// collectDone finishes the collect phase, and adds the RBAC errors that the collectors found
+func (t *progressTracker) collectDone(collectors troubleshootcollect.Collectors, now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.progress.UpdatedAt = now
+	t.finishRunning(now)
+
+	for _, c := range collectors {
+		if len(c.RBACErrors) == 0 {
+			continue
+		}
+		collector := t.collector(c.GetDisplayName())
+		for _, rbacError := range c.RBACErrors {
+			collector.RBACErrors = append(collector.RBACErrors, rbacError.Error())
+		}
+	}
+
+	// collectors that never started were skipped, because collection stopped for RBAC errors
+	for _, collector := range t.progress.Collectors {
+		if collector.Status == CollectorStatusPending {
+			collector.Status = CollectorStatusSkipped
+		}
+	}
+}
+
+func (t *progressTracker) analyzeStarted(now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.progress.UpdatedAt = now
+	t.progress.Phase = PhaseAnalyzing
+	t.progress.AnalyzeStartedAt = &now
+}
+
+func (t *progressTracker) finish(phase string, now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.progress.UpdatedAt = now
+	t.progress.Phase = phase
+	t.finishRunning(now)
+	if t.progress.AnalyzeStartedAt != nil && t.progress.AnalyzeCompletedAt == nil {
+		t.progress.AnalyzeCompletedAt = &now
+	}
+}
+
+func (t *progressTracker) marshal() ([]byte, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return json.Marshal(t.progress)
+}
+
+// collector returns the progress of the named collector, adding it if it's not known yet
+func (t *progressTracker) collector(name string) *CollectorProgress {
+	for _, collector := range t.progress.Collectors {
+		if collector.Name == name {
+			return collector
+		}
+	}
+
+	collector := &CollectorProgress{
+		Name:   name,
+		Status: CollectorStatusPending,
+	}
+	t.progress.Collectors = append(t.progress.Collectors, collector)
+	return collector
+}
+
+func (t *progressTracker) running() *CollectorProgress {
+	for _, collector := range t.progress.Collectors {
+		if collector.Status == CollectorStatusRunning {
+			return collector
+		}
+	}
+	return nil
+}
+
+func (t *progressTracker) finishRunning(now time.Time) {
+	if running := t.running(); running != nil {
+		running.Status = CollectorStatusCompleted
+		finishCollector(running, now)
+	}
+}
+
+func finishCollector(collector *CollectorProgress, now time.Time) {
+	collector.CompletedAt = &now
+	if collector.StartedAt != nil {
+		collector.DurationMs = now.Sub(*collector.StartedAt).Milliseconds()
+	}
+}
+
+func skippedCollectorName(msg string) (string, bool) {
+	const prefix = "skipping collector "
+	const suffix = " with insufficient RBAC permissions"
+	if !strings.HasPrefix(msg, prefix) || !strings.HasSuffix(msg, suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(msg, prefix), suffix), true
+}
+
+func setRunProgress(runID string, progress []byte) error {
+	db := persistence.MustGetPGSession()
+	query := `update preflight_run set progress = $1 where id = $2`
+	_, err := db.Exec(query, string(progress), runID)
+	if err != nil {
+		return errors.Wrap(err, "failed to update preflight run progress")
+	}
+
+	return nil
+}
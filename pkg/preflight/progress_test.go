@@ -0,0 +1,63 @@
+package preflight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	troubleshootv1beta1 "github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta1"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_progressTracker(t *testing.T) {
+	req := require.New(t)
+
+	start := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	tracker := newProgressTracker(&troubleshootv1beta1.Preflight{}, start)
+	tracker.handleMessage("cluster-info", at(1))
+	tracker.handleMessage("cluster-resources", at(3))
+	tracker.handleMessage("skipping collector secret with insufficient RBAC permissions", at(4))
+	tracker.handleMessage("run/ping", at(5))
+	tracker.handleMessage(errors.New("failed to run collector run/ping: timeout"), at(9))
+	tracker.collectDone(nil, at(10))
+	tracker.analyzeStarted(at(10))
+	tracker.finish(PhaseCompleted, at(12))
+
+	progress := tracker.progress
+	req.Equal(PhaseCompleted, progress.Phase)
+	req.Equal(at(12), *progress.AnalyzeCompletedAt)
+	req.Empty(progress.Errors)
+	req.Len(progress.Collectors, 4)
+
+	req.Equal("cluster-info", progress.Collectors[0].Name)
+	req.Equal(CollectorStatusCompleted, progress.Collectors[0].Status)
+	req.Equal(int64(2000), progress.Collectors[0].DurationMs)
+
+	req.Equal("cluster-resources", progress.Collectors[1].Name)
+	req.Equal(CollectorStatusCompleted, progress.Collectors[1].Status)
+	req.Equal(int64(2000), progress.Collectors[1].DurationMs)
+
+	req.Equal("secret", progress.Collectors[2].Name)
+	req.Equal(CollectorStatusSkipped, progress.Collectors[2].Status)
+
+	req.Equal("run/ping", progress.Collectors[3].Name)
+	req.Equal(CollectorStatusFailed, progress.Collectors[3].Status)
+	req.Equal("failed to run collector run/ping: timeout", progress.Collectors[3].Error)
+	req.Equal(int64(4000), progress.Collectors[3].DurationMs)
+}
+
+func Test_progressTrackerErrorsBeforeCollectors(t *testing.T) {
+	req := require.New(t)
+
+	now := time.Now()
+	tracker := newProgressTracker(&troubleshootv1beta1.Preflight{}, now)
+	tracker.handleMessage(errors.New("cannot list secrets in namespace default"), now)
+
+	req.Equal([]string{"cannot list secrets in namespace default"}, tracker.progress.Errors)
+	req.Empty(tracker.progress.Collectors)
+}
@@ -0,0 +1,287 @@
+package preflightgate
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	troubleshootpreflight "github.com/replicatedhq/troubleshoot/pkg/preflight"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	ActionBlocked       = "blocked"
+	ActionOverridden    = "overridden"
+	ActionPolicyChanged = "policy_changed"
+
+	sourcePolicy = "policy"
+
+	minJustificationLength = 10
+)
+
+// Policy is the preflight gating policy of an app. Versions are never blocked by default
+type Policy struct {
+	// BlockFailures blocks deploying versions with failing preflight checks
+	BlockFailures bool `json:"blockFailures"`
+	// BlockWarnings also blocks deploying versions with preflight warnings
+	BlockWarnings bool `json:"blockWarnings"`
+	// AllowRBACErrors deploys versions whose preflights could not run all collectors because of RBAC permissions,
+	// either because collection stopped or because the RBAC errors were ignored
+	AllowRBACErrors bool `json:"allowRbacErrors"`
+}
+
+// Decision is whether the policy blocks deploying a version, and why
+type Decision struct {
+	Blocked bool     `json:"blocked"`
+	Reasons []string `json:"reasons"`
+}
+
+// Override lets an admin deploy a version that the policy blocks
+type Override struct {
+	Justification string `json:"justification"`
+	UserID        string `json:"userId"`
+}
+
+// Event is an entry in the audit trail of blocked and overridden deploys, and of changes to the policy
+type Event struct {
+	ID    string `json:"id"`
+	AppID string `json:"appId"`
+	// Sequence is -1 for policy changes
+	Sequence       int64     `json:"sequence"`
+	Source         string    `json:"source"`
+	Action         string    `json:"action"`
+	Reasons        []string  `json:"reasons"`
+	Justification  string    `json:"justification,omitempty"`
+	UserID         string    `json:"userId,omitempty"`
+	QueuedDeployID string    `json:"queuedDeployId,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// BlockedError is returned when the policy blocks a deploy that was not overridden
+type BlockedError struct {
+	Decision *Decision
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("deploy blocked by preflight policy: %s", strings.Join(e.Decision.Reasons, ", "))
+}
+
+func (o *Override) Validate() error {
+	if len(strings.TrimSpace(o.Justification)) < minJustificationLength {
+		return errors.Errorf("a justification of at least %d characters is required to override the preflight policy", minJustificationLength)
+	}
+	return nil
+}
+
+func GetPolicy(appID string) (*Policy, error) {
+	db := persistence.MustGetPGSession()
+	query := `select preflight_gating_policy from app where id = $1`
+	row := db.QueryRow(query, appID)
+
+	var marshalled sql.NullString
+	if err := row.Scan(&marshalled); err != nil {
+		return nil, errors.Wrap(err, "failed to scan preflight gating policy")
+	}
+
+	policy := Policy{}
+	if marshalled.String == "" {
+		return &policy, nil
+	}
+
+	if err := json.Unmarshal([]byte(marshalled.String), &policy); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal preflight gating policy")
+	}
+
+	return &policy, nil
+}
+
+// SetPolicy changes the preflight gating policy of the app, and records the change with the user that made it
+// in the audit trail
+func SetPolicy(appID string, policy *Policy, userID string) error {
+	previous, err := GetPolicy(appID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get previous policy")
+	}
+
+	marshalled, err := json.Marshal(policy)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal preflight gating policy")
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `update app set preflight_gating_policy = $1 where id = $2`
+	if _, err := db.Exec(query, string(marshalled), appID); err != nil {
+		return errors.Wrap(err, "failed to set preflight gating policy")
+	}
+
+	changes := policyChanges(previous, policy)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if err := insertEvent(appID, nil, sourcePolicy, ActionPolicyChanged, changes, "", userID, ""); err != nil {
+		return errors.Wrap(err, "failed to record policy change")
+	}
+
+	return nil
+}
+
+// policyChanges describes the settings that are different between two policies
+func policyChanges(previous *Policy, policy *Policy) []string {
+	changes := []string{}
+	addChange := func(name string, from bool, to bool) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s changed from %t to %t", name, from, to))
+		}
+	}
+
+	addChange("blockFailures", previous.BlockFailures, policy.BlockFailures)
+	addChange("blockWarnings", previous.BlockWarnings, policy.BlockWarnings)
+	addChange("allowRbacErrors", previous.AllowRBACErrors, policy.AllowRBACErrors)
+
+	return changes
+}
+
+// Evaluate returns whether the preflight gating policy of the app blocks deploying the sequence
+func Evaluate(appID string, sequence int64) (*Decision, error) {
+	policy, err := GetPolicy(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get policy")
+	}
+	if !policy.BlockFailures && !policy.BlockWarnings {
+		return &Decision{Reasons: []string{}}, nil
+	}
+
+	status, err := downstream.GetDownstreamVersionStatus(appID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get downstream version status")
+	}
+
+	preflightResult, err := downstream.GetPreflightResult(appID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get preflight result")
+	}
+
+	ignoredRBACErrors, err := downstream.GetIgnoreRBACErrors(appID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get ignore rbac flag")
+	}
+
+	return evaluate(policy, status, preflightResult, ignoredRBACErrors), nil
+}
+
+// evaluate applies the policy to the preflight result of a version. Versions without preflights are not blocked
+func evaluate(policy *Policy, status string, preflightResult string, ignoredRBACErrors bool) *Decision {
+	decision := Decision{
+		Reasons: []string{},
+	}
+
+	blockFailures := policy.BlockFailures || policy.BlockWarnings
+	if !blockFailures {
+		return &decision
+	}
+
+	if status == "pending_preflight" {
+		decision.Reasons = append(decision.Reasons, "preflight checks have not completed")
+	} else if preflightResult != "" {
+		results := troubleshootpreflight.UploadPreflightResults{}
+		if err := json.Unmarshal([]byte(preflightResult), &results); err != nil {
+			decision.Reasons = append(decision.Reasons, "failed to parse preflight results")
+		} else {
+			if !policy.AllowRBACErrors {
+				if len(results.Errors) > 0 {
+					decision.Reasons = append(decision.Reasons, "preflight checks could not run because of permission errors")
+				} else if ignoredRBACErrors {
+					decision.Reasons = append(decision.Reasons, "preflight checks ran without the collectors that lacked permissions")
+				}
+			}
+
+			for _, result := range results.Results {
+				if result.IsFail {
+					decision.Reasons = append(decision.Reasons, fmt.Sprintf("preflight check %q failed", result.Title))
+				} else if result.IsWarn && policy.BlockWarnings {
+					decision.Reasons = append(decision.Reasons, fmt.Sprintf("preflight check %q has a warning", result.Title))
+				}
+			}
+		}
+	}
+
+	decision.Blocked = len(decision.Reasons) > 0
+	return &decision
+}
+
+// RecordEvent adds a blocked or overridden deploy to the audit trail
+func RecordEvent(appID string, sequence int64, source string, action string, decision *Decision, override *Override, queuedDeployID string) error {
+	justification, userID := "", ""
+	if override != nil {
+		justification, userID = override.Justification, override.UserID
+	}
+
+	return insertEvent(appID, sequence, source, action, decision.Reasons, justification, userID, queuedDeployID)
+}
+
+// insertEvent adds an event to the audit trail. The sequence is nil for events that are not about a version
+func insertEvent(appID string, sequence interface{}, source string, action string, reasons []string, justification string, userID string, queuedDeployID string) error {
+	marshalledReasons, err := json.Marshal(reasons)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal reasons")
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `insert into preflight_gate_event (id, app_id, sequence, source, action, reasons, justification, user_id, queued_deploy_id, created_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err = db.Exec(query, ksuid.New().String(), appID, sequence, source, action, string(marshalledReasons), justification, userID, queuedDeployID, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "failed to insert preflight gate event")
+	}
+
+	return nil
+}
+
+// ListEvents returns the audit trail of blocked and overridden deploys and policy changes of the app, newest first
+func ListEvents(appID string) ([]*Event, error) {
+	db := persistence.MustGetPGSession()
+	query := `select id, app_id, sequence, source, action, reasons, justification, user_id, queued_deploy_id, created_at
+from preflight_gate_event where app_id = $1 order by created_at desc`
+	rows, err := db.Query(query, appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query preflight gate events")
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		event := Event{}
+		var sequence sql.NullInt64
+		var reasons sql.NullString
+		var justification sql.NullString
+		var userID sql.NullString
+		var queuedDeployID sql.NullString
+		if err := rows.Scan(&event.ID, &event.AppID, &sequence, &event.Source, &event.Action, &reasons, &justification, &userID, &queuedDeployID, &event.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan preflight gate event")
+		}
+		event.Sequence = -1
+		if sequence.Valid {
+			event.Sequence = sequence.Int64
+		}
+		event.Justification = justification.String
+		event.UserID = userID.String
+		event.QueuedDeployID = queuedDeployID.String
+
+		event.Reasons = []string{}
+		if reasons.String != "" {
+			if err := json.Unmarshal([]byte(reasons.String), &event.Reasons); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal reasons")
+			}
+		}
+
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,130 @@
+package preflightgate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_evaluate(t *testing.T) {
+	passed := `{"results":[{"isPass":true,"title":"Kubernetes version"}]}`
+	warned := `{"results":[{"isPass":true,"title":"Kubernetes version"},{"isWarn":true,"title":"Memory"}]}`
+	failed := `{"results":[{"isFail":true,"title":"Storage class"},{"isWarn":true,"title":"Memory"}]}`
+	rbacErrors := `{"errors":[{"error":"cannot list nodes"}]}`
+
+	tests := []struct {
+		name              string
+		policy            Policy
+		status            string
+		preflightResult   string
+		ignoredRBACErrors bool
+		expectReasons     []string
+	}{
+		{
+			name:            "no policy",
+			policy:          Policy{},
+			status:          "pending",
+			preflightResult: failed,
+			expectReasons:   []string{},
+		},
+		{
+			name:            "no preflights",
+			policy:          Policy{BlockFailures: true},
+			status:          "pending",
+			preflightResult: "",
+			expectReasons:   []string{},
+		},
+		{
+			name:          "pending preflights",
+			policy:        Policy{BlockFailures: true},
+			status:        "pending_preflight",
+			expectReasons: []string{"preflight checks have not completed"},
+		},
+		{
+			name:            "passed",
+			policy:          Policy{BlockFailures: true, BlockWarnings: true},
+			status:          "pending",
+			preflightResult: passed,
+			expectReasons:   []string{},
+		},
+		{
+			name:            "warnings allowed",
+			policy:          Policy{BlockFailures: true},
+			status:          "pending",
+			preflightResult: warned,
+			expectReasons:   []string{},
+		},
+		{
+			name:            "warnings blocked",
+			policy:          Policy{BlockWarnings: true},
+			status:          "pending",
+			preflightResult: failed,
+			expectReasons:   []string{`preflight check "Storage class" failed`, `preflight check "Memory" has a warning`},
+		},
+		{
+			name:            "failed",
+			policy:          Policy{BlockFailures: true},
+			status:          "pending",
+			preflightResult: failed,
+			expectReasons:   []string{`preflight check "Storage class" failed`},
+		},
+		{
+			name:            "rbac errors blocked",
+			policy:          Policy{BlockFailures: true},
+			status:          "pending",
+			preflightResult: rbacErrors,
+			expectReasons:   []string{"preflight checks could not run because of permission errors"},
+		},
+		{
+			name:            "rbac errors allowed",
+			policy:          Policy{BlockFailures: true, AllowRBACErrors: true},
+			status:          "pending",
+			preflightResult: rbacErrors,
+			expectReasons:   []string{},
+		},
+		{
+			name:              "ignored rbac errors blocked",
+			policy:            Policy{BlockFailures: true},
+			status:            "pending",
+			preflightResult:   passed,
+			ignoredRBACErrors: true,
+			expectReasons:     []string{"preflight checks ran without the collectors that lacked permissions"},
+		},
+		{
+			name:              "ignored rbac errors allowed",
+			policy:            Policy{BlockFailures: true, AllowRBACErrors: true},
+			status:            "pending",
+			preflightResult:   passed,
+			ignoredRBACErrors: true,
+			expectReasons:     []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			decision := evaluate(&test.policy, test.status, test.preflightResult, test.ignoredRBACErrors)
+			req.Equal(test.expectReasons, decision.Reasons)
+			req.Equal(len(test.expectReasons) > 0, decision.Blocked)
+		})
+	}
+}
+
+func Test_OverrideValidate(t *testing.T) {
+	req := require.New(t)
+
+	req.Error((&Override{Justification: "  ok  "}).Validate())
+	req.NoError((&Override{Justification: "storage class is provisioned by the cloud provider"}).Validate())
+}
+
+func Test_policyChanges(t *testing.T) {
+	req := require.New(t)
+
+	req.Empty(policyChanges(&Policy{BlockFailures: true}, &Policy{BlockFailures: true}))
+	req.Equal([]string{
+		"blockFailures changed from false to true",
+		"allowRbacErrors changed from true to false",
+	}, policyChanges(&Policy{AllowRBACErrors: true}, &Policy{BlockFailures: true}))
+}
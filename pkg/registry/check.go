@@ -0,0 +1,278 @@
+package registry
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// checkRepository is the repository that a blob upload is started (and cancelled) in to check push permission
+const checkRepository = "kotsadm-registry-check"
+
+// CheckRegistryAccess authenticates against the v2 api of the registry at hostname, and confirms that the user
+// can push to namespace. The CA certificates and insecure opt-in saved for the registry are used.
+// The returned errors are meant to be shown to the user as is
+func CheckRegistryAccess(hostname string, username string, password string, namespace string) error {
+	registryTLS, err := GetRegistryTLS(hostname)
+	if err != nil {
+		return errors.Wrap(err, "failed to get registry tls")
+	}
+
+	client, err := registryHTTPClient(registryTLS)
+	if err != nil {
+		return err
+	}
+
+	scheme := registryScheme(client, hostname, registryTLS != nil && registryTLS.Insecure)
+	return checkRegistryAccess(client, scheme, hostname, username, password, namespace)
+}
+
+func checkRegistryAccess(client *http.Client, scheme string, hostname string, username string, password string, namespace string) error {
+	hostname = strings.TrimSuffix(strings.TrimSpace(hostname), "/")
+	if hostname == "" {
+		return errors.New("Registry hostname is required")
+	}
+	if strings.Contains(hostname, "://") {
+		return errors.Errorf("Registry hostname %q should not include a scheme", hostname)
+	}
+
+	baseURL := fmt.Sprintf("%s://%s/v2/", scheme, hostname)
+
+	resp, err := client.Get(baseURL)
+	if err != nil {
+		return connectionError(hostname, err)
+	}
+	resp.Body.Close()
+
+	repository := path.Join(namespace, checkRepository)
+
+	authorization := ""
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// anonymous access, push is checked below
+	case http.StatusUnauthorized:
+		challenge := resp.Header.Get("Www-Authenticate")
+		authorization, err = authorize(client, challenge, baseURL, hostname, username, password, fmt.Sprintf("repository:%s:push,pull", repository))
+		if err != nil {
+			return err
+		}
+	case http.StatusNotFound:
+		return errors.Errorf("%s does not serve the registry v2 api. Check the hostname", hostname)
+	default:
+		return errors.Errorf("%s returned unexpected status %d for the registry v2 api", hostname, resp.StatusCode)
+	}
+
+	// starting a blob upload is the least intrusive operation that requires push permission
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s%s/blobs/uploads/", baseURL, repository), nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create upload request")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return connectionError(hostname, err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		cancelUpload(client, baseURL, resp.Header.Get("Location"), authorization)
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		if namespace == "" {
+			return errors.Errorf("User %q does not have permission to push images to %s", username, hostname)
+		}
+		return errors.Errorf("User %q does not have permission to push images to namespace %q on %s", username, namespace, hostname)
+	case http.StatusNotFound:
+		return errors.Errorf("Namespace %q does not exist on %s", namespace, hostname)
+	default:
+		return errors.Errorf("%s returned unexpected status %d when checking push permission", hostname, resp.StatusCode)
+	}
+}
+
+// authorize returns the authorization header to use with the registry for scope, based on the challenge returned by the v2 api
+func authorize(client *http.Client, challenge string, baseURL string, hostname string, username string, password string, scope string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return "", errors.Errorf("%s requires a username and password", hostname)
+		}
+		req, err := http.NewRequest("GET", baseURL, nil)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to create request")
+		}
+		req.SetBasicAuth(username, password)
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", connectionError(hostname, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return "", errors.Errorf("Invalid username or password for %s", hostname)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", errors.Errorf("%s returned unexpected status %d when authenticating", hostname, resp.StatusCode)
+		}
+		return req.Header.Get("Authorization"), nil
+
+	case "bearer":
+		realm := params["realm"]
+		if realm == "" {
+			return "", errors.Errorf("%s returned a bearer challenge without a realm", hostname)
+		}
+		tokenURL, err := url.Parse(realm)
+		if err != nil {
+			return "", errors.Wrapf(err, "%s returned an invalid token realm", hostname)
+		}
+		query := tokenURL.Query()
+		if params["service"] != "" {
+			query.Set("service", params["service"])
+		}
+		query.Set("scope", scope)
+		tokenURL.RawQuery = query.Encode()
+
+		req, err := http.NewRequest("GET", tokenURL.String(), nil)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to create token request")
+		}
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", connectionError(tokenURL.Host, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return "", errors.Errorf("Invalid username or password for %s", hostname)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", errors.Errorf("Token service %s returned unexpected status %d", tokenURL.Host, resp.StatusCode)
+		}
+
+		tokenResponse := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+			return "", errors.Wrapf(err, "failed to decode token from %s", tokenURL.Host)
+		}
+		token := tokenResponse.Token
+		if token == "" {
+			token = tokenResponse.AccessToken
+		}
+		if token == "" {
+			return "", errors.Errorf("Token service %s did not return a token", tokenURL.Host)
+		}
+		return "Bearer " + token, nil
+
+	default:
+		return "", errors.Errorf("%s requires unsupported authentication %q", hostname, scheme)
+	}
+}
+
+func cancelUpload(client *http.Client, baseURL string, location string, authorization string) {
+	if location == "" {
+		return
+	}
+	uploadURL, err := url.Parse(location)
+	if err != nil {
+		return
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("DELETE", base.ResolveReference(uploadURL).String(), nil)
+	if err != nil {
+		return
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	for _, param := range splitParams(parts[1]) {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+	}
+
+	return parts[0], params
+}
+
+// splitParams splits on commas that are not in quotes
+func splitParams(s string) []string {
+	params := []string{}
+	inQuotes := false
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if !inQuotes {
+				params = append(params, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(params, s[start:])
+}
+
+func connectionError(hostname string, err error) error {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthorityErr) {
+		return errors.Errorf("The TLS certificate of %s is signed by an unknown authority. Add the registry CA certificate", hostname)
+	}
+
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return errors.Errorf("The TLS certificate of %s is not valid for this hostname: %s", hostname, hostnameErr.Error())
+	}
+
+	var certificateInvalidErr x509.CertificateInvalidError
+	if errors.As(err, &certificateInvalidErr) {
+		if certificateInvalidErr.Reason == x509.Expired {
+			return errors.Errorf("The TLS certificate of %s has expired or is not yet valid", hostname)
+		}
+		return errors.Errorf("The TLS certificate of %s is not valid: %s", hostname, certificateInvalidErr.Error())
+	}
+
+	if urlErr, ok := err.(*url.Error); ok {
+		if urlErr.Timeout() {
+			return errors.Errorf("Timed out connecting to %s", hostname)
+		}
+		err = urlErr.Err
+	}
+
+	return errors.Errorf("Failed to connect to %s: %s", hostname, err.Error())
+}
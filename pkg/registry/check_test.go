@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+// newTestRegistry serves the parts of the registry v2 api and token auth that the check uses.
+// Only user "admin" with password "password" can push, and only to namespace "writable"
+func newTestRegistry() *httptest.Server {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "admin" || password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		token := "pull"
+		if r.URL.Query().Get("scope") == fmt.Sprintf("repository:writable/%s:push,pull", checkRepository) {
+			token = "push"
+		}
+		fmt.Fprintf(w, `{"token": %q}`, token)
+	})
+
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/blobs/uploads/"):
+			if auth != "Bearer push" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Location", r.URL.Path+"upload-id")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server = httptest.NewTLSServer(mux)
+	return server
+}
+
+func Test_checkRegistryAccess(t *testing.T) {
+	server := newTestRegistry()
+	defer server.Close()
+
+	hostname := strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name      string
+		client    *http.Client
+		username  string
+		password  string
+		namespace string
+		expectErr string
+	}{
+		{
+			name:      "can push",
+			client:    server.Client(),
+			username:  "admin",
+			password:  "password",
+			namespace: "writable",
+		},
+		{
+			name:      "wrong password",
+			client:    server.Client(),
+			username:  "admin",
+			password:  "wrong",
+			namespace: "writable",
+			expectErr: "Invalid username or password",
+		},
+		{
+			name:      "no push permission",
+			client:    server.Client(),
+			username:  "admin",
+			password:  "password",
+			namespace: "readonly",
+			expectErr: `does not have permission to push images to namespace "readonly"`,
+		},
+		{
+			name:      "unknown certificate authority",
+			client:    &http.Client{},
+			username:  "admin",
+			password:  "password",
+			namespace: "writable",
+			expectErr: "signed by an unknown authority",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			err := checkRegistryAccess(test.client, "https", hostname, test.username, test.password, test.namespace)
+			if test.expectErr == "" {
+				req.NoError(err)
+				return
+			}
+			req.Error(err)
+			req.Contains(err.Error(), test.expectErr)
+		})
+	}
+}
@@ -0,0 +1,592 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+)
+
+const (
+	GCActionKeep   = "keep"
+	GCActionDelete = "delete"
+
+	// DefaultGCRetainPrevious is the number of versions before the deployed version whose images are kept
+	DefaultGCRetainPrevious = 2
+)
+
+var linkNextRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// GCTag is a tag in the registry namespace, and what garbage collection does with it
+type GCTag struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Digest     string `json:"digest"`
+	Action     string `json:"action"`
+	Reason     string `json:"reason"`
+	Deleted    bool   `json:"deleted"`
+	Error      string `json:"error,omitempty"`
+}
+
+type GCReport struct {
+	DryRun           bool               `json:"dryRun"`
+	Hostname         string             `json:"hostname"`
+	Namespace        string             `json:"namespace"`
+	RetainedVersions map[string][]int64 `json:"retainedVersions"`
+	Tags             []*GCTag           `json:"tags"`
+	ToDelete         int                `json:"toDelete"`
+	Deleted          int                `json:"deleted"`
+}
+
+// GarbageCollectImages deletes the manifests in the app registry namespace that are not referenced by a retained
+// version of any app that uses the namespace, see listVersionReferences. Retained versions are the deployed version, all newer versions, and
+// retainPrevious versions before the deployed version. With dryRun, only the report is returned.
+// Deleting manifests does not free disk until the registry runs its own blob garbage collection
+func GarbageCollectImages(appID string, retainPrevious int, dryRun bool) (*GCReport, error) {
+	registrySettings, err := GetRegistrySettingsForApp(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get registry settings")
+	}
+	if registrySettings == nil || registrySettings.Hostname == "" {
+		return nil, errors.New("no registry is configured for the app")
+	}
+	if registrySettings.Namespace == "" {
+		return nil, errors.New("garbage collection requires a registry namespace")
+	}
+
+	password, err := encryptionkey.Decrypt(registrySettings.PasswordEnc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt registry password")
+	}
+	registryTLS, err := GetRegistryTLS(registrySettings.Hostname)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get registry tls")
+	}
+
+	report := GCReport{
+		DryRun:           dryRun,
+		Hostname:         registrySettings.Hostname,
+		Namespace:        registrySettings.Namespace,
+		RetainedVersions: map[string][]int64{},
+		Tags:             []*GCTag{},
+	}
+
+	// images referenced by any app that pushes to the same namespace
+	appIDs, err := listAppsUsingRegistry(registrySettings.Hostname, registrySettings.Namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list apps using registry")
+	}
+	references := []string{}
+	for _, id := range appIDs {
+		sequences, err := retainedSequences(id, retainPrevious)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get retained versions of app %s", id)
+		}
+		report.RetainedVersions[id] = sequences
+
+		for _, sequence := range sequences {
+			versionReferences, err := listVersionReferences(id, sequence, registrySettings.Hostname, registrySettings.Namespace)
+			if err != nil {
+				// without the complete set of references, nothing can be safely deleted
+				return nil, errors.Wrapf(err, "failed to list images of app %s sequence %d", id, sequence)
+			}
+			references = append(references, versionReferences...)
+		}
+	}
+
+	client, err := registryHTTPClient(registryTLS)
+	if err != nil {
+		return nil, err
+	}
+	insecure := registryTLS != nil && registryTLS.Insecure
+	rc := &registryClient{
+		client:   client,
+		baseURL:  fmt.Sprintf("%s://%s/v2/", registryScheme(client, registrySettings.Hostname, insecure), registrySettings.Hostname),
+		hostname: registrySettings.Hostname,
+		username: registrySettings.Username,
+		password: string(password),
+	}
+
+	repositories, err := rc.listRepositories(registrySettings.Namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list repositories")
+	}
+
+	for _, repository := range repositories {
+		tags, err := rc.listTags(repository)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list tags of %s", repository)
+		}
+		for _, tag := range tags {
+			digest, err := rc.getDigest(repository, tag)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get digest of %s:%s", repository, tag)
+			}
+			report.Tags = append(report.Tags, &GCTag{
+				Repository: repository,
+				Tag:        tag,
+				Digest:     digest,
+			})
+		}
+	}
+
+	report.ToDelete = planGC(report.Tags, references)
+
+	if dryRun {
+		return &report, nil
+	}
+
+	// a manifest is deleted by digest, which removes all of its tags
+	deleteErrs := map[string]error{}
+	for _, tag := range report.Tags {
+		if tag.Action != GCActionDelete {
+			continue
+		}
+
+		key := tag.Repository + "@" + tag.Digest
+		deleteErr, done := deleteErrs[key]
+		if !done {
+			deleteErr = rc.deleteManifest(tag.Repository, tag.Digest)
+			deleteErrs[key] = deleteErr
+			if deleteErr != nil {
+				logger.Error(errors.Wrapf(deleteErr, "failed to delete %s", key))
+			}
+		}
+
+		if deleteErr != nil {
+			tag.Error = deleteErr.Error()
+			continue
+		}
+		tag.Deleted = true
+		report.Deleted++
+	}
+
+	return &report, nil
+}
+
+// planGC sets the action of each tag, and returns the number of tags to delete. Tags that share a digest with
+// a referenced tag are kept, since deleting the manifest would delete the referenced tag too
+func planGC(tags []*GCTag, references []string) int {
+	referencedTags := map[string]bool{}
+	referencedDigests := map[string]bool{}
+	for _, ref := range references {
+		repository, reference := splitReference(ref)
+		_, repository = splitRegistry(repository)
+		if strings.HasPrefix(reference, "sha256:") {
+			referencedDigests[repository+"@"+reference] = true
+		} else {
+			referencedTags[repository+":"+reference] = true
+		}
+	}
+
+	for _, tag := range tags {
+		if referencedTags[tag.Repository+":"+tag.Tag] {
+			referencedDigests[tag.Repository+"@"+tag.Digest] = true
+		}
+	}
+
+	toDelete := 0
+	for _, tag := range tags {
+		switch {
+		case referencedTags[tag.Repository+":"+tag.Tag]:
+			tag.Action = GCActionKeep
+			tag.Reason = "referenced by a retained version"
+		case referencedDigests[tag.Repository+"@"+tag.Digest]:
+			tag.Action = GCActionKeep
+			tag.Reason = "same manifest as a referenced image"
+		default:
+			tag.Action = GCActionDelete
+			tag.Reason = "not referenced by a retained version"
+			toDelete++
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Repository != tags[j].Repository {
+			return tags[i].Repository < tags[j].Repository
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+
+	return toDelete
+}
+
+// listVersionReferences returns the references in the app registry that an app version needs: the images in its
+// rendered manifests, the additional images of the application, and the images that preflight and support bundle
+// collectors run
+func listVersionReferences(appID string, sequence int64, hostname string, namespace string) ([]string, error) {
+	archiveDir, err := version.GetAppVersionArchive(appID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get app version archive")
+	}
+	defer os.RemoveAll(archiveDir)
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load kotskinds")
+	}
+
+	images, err := listArchiveImages(appID, archiveDir, kotsKinds)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list images")
+	}
+
+	references := []string{}
+	for _, image := range images {
+		if image.Registry != hostname {
+			continue
+		}
+		ref := image.Original
+		if image.Rewritten != "" {
+			ref = image.Rewritten
+		}
+		references = append(references, ref)
+	}
+
+	rewrites, err := loadImageRewrites(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load image rewrites")
+	}
+
+	supportingImages, err := listSupportingImages(kotsKinds)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list supporting images")
+	}
+	for _, ref := range supportingImages {
+		references = append(references, registryReference(ref, rewrites, hostname, namespace))
+	}
+
+	return references, nil
+}
+
+// listSupportingImages returns the images that are not in the rendered manifests, but were pushed with the app:
+// the additional images of the application and the images in the preflight and support bundle specs
+func listSupportingImages(kotsKinds *kotsutil.KotsKinds) ([]string, error) {
+	images := []string{}
+	images = append(images, kotsKinds.KotsApplication.Spec.AdditionalImages...)
+
+	specs := []interface{}{}
+	if kotsKinds.Preflight != nil {
+		specs = append(specs, kotsKinds.Preflight.Spec)
+	}
+	if kotsKinds.Collector != nil {
+		specs = append(specs, kotsKinds.Collector.Spec)
+	}
+	for _, spec := range specs {
+		specImages, err := findSpecImages(spec)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, specImages...)
+	}
+
+	return images, nil
+}
+
+// findSpecImages returns the value of every image field in the spec
+func findSpecImages(spec interface{}) ([]string, error) {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal spec")
+	}
+	var obj interface{}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal spec")
+	}
+
+	return findImageFields(obj), nil
+}
+
+func findImageFields(obj interface{}) []string {
+	images := []string{}
+
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range o {
+			if image, ok := value.(string); ok && key == "image" && image != "" {
+				images = append(images, image)
+				continue
+			}
+			images = append(images, findImageFields(value)...)
+		}
+	case []interface{}:
+		for _, value := range o {
+			images = append(images, findImageFields(value)...)
+		}
+	}
+
+	return images
+}
+
+// registryReference returns where ref was pushed in the app registry. Images that are not in the midstream
+// kustomization are pushed to the namespace with the last part of their repository, like kots does
+func registryReference(ref string, rewrites []kustomizationImage, hostname string, namespace string) string {
+	repository, reference := splitReference(ref)
+	registry, _ := splitRegistry(repository)
+	if registry == hostname {
+		return ref
+	}
+
+	newRepository := ""
+	for _, rewrite := range rewrites {
+		if rewrite.Name == repository && rewrite.NewName != "" {
+			newRepository = rewrite.NewName
+			break
+		}
+	}
+	if newRepository == "" {
+		newRepository = path.Join(hostname, namespace, path.Base(repository))
+	}
+
+	if strings.HasPrefix(reference, "sha256:") {
+		return fmt.Sprintf("%s@%s", newRepository, reference)
+	}
+	return fmt.Sprintf("%s:%s", newRepository, reference)
+}
+
+// retainedSequences returns the deployed sequence, all newer sequences and retainPrevious older sequences.
+// All sequences are retained if nothing has been deployed
+func retainedSequences(appID string, retainPrevious int) ([]int64, error) {
+	downstreams, err := downstream.ListDownstreamsForApp(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list downstreams")
+	}
+
+	deployedSequence := int64(-1)
+	for _, d := range downstreams {
+		if d.CurrentSequence == -1 {
+			continue
+		}
+		if deployedSequence == -1 || d.CurrentSequence < deployedSequence {
+			deployedSequence = d.CurrentSequence
+		}
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `select sequence from app_version where app_id = $1 order by sequence desc`
+	rows, err := db.Query(query, appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query app versions")
+	}
+	defer rows.Close()
+
+	sequences := []int64{}
+	previous := 0
+	for rows.Next() {
+		var sequence int64
+		if err := rows.Scan(&sequence); err != nil {
+			return nil, errors.Wrap(err, "failed to scan sequence")
+		}
+
+		if deployedSequence != -1 && sequence < deployedSequence {
+			if previous >= retainPrevious {
+				continue
+			}
+			previous++
+		}
+		sequences = append(sequences, sequence)
+	}
+
+	return sequences, nil
+}
+
+func listAppsUsingRegistry(hostname string, namespace string) ([]string, error) {
+	db := persistence.MustGetPGSession()
+	query := `select id from app where registry_hostname = $1 and namespace = $2`
+	rows, err := db.Query(query, hostname, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query apps")
+	}
+	defer rows.Close()
+
+	appIDs := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "failed to scan app id")
+		}
+		appIDs = append(appIDs, id)
+	}
+
+	return appIDs, nil
+}
+
+// registryClient makes requests to the registry v2 api, authorizing when challenged
+type registryClient struct {
+	client   *http.Client
+	baseURL  string
+	hostname string
+	username string
+	password string
+}
+
+func (c *registryClient) do(method string, path string, accept string, scope string) (*http.Response, error) {
+	authorization := ""
+	for {
+		req, err := http.NewRequest(method, c.resolve(path), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create request")
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, connectionError(c.hostname, err)
+		}
+		if resp.StatusCode != http.StatusUnauthorized || authorization != "" {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		authorization, err = authorize(c.client, resp.Header.Get("Www-Authenticate"), c.baseURL, c.hostname, c.username, c.password, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *registryClient) resolve(path string) string {
+	if strings.HasPrefix(path, "/") {
+		base, err := url.Parse(c.baseURL)
+		if err == nil {
+			if ref, err := url.Parse(path); err == nil {
+				return base.ResolveReference(ref).String()
+			}
+		}
+	}
+	return c.baseURL + path
+}
+
+// listRepositories returns the repositories in namespace, following the catalog pagination
+func (c *registryClient) listRepositories(namespace string) ([]string, error) {
+	repositories := []string{}
+
+	path := "_catalog?n=1000"
+	for path != "" {
+		resp, err := c.do("GET", path, "", "registry:catalog:*")
+		if err != nil {
+			return nil, err
+		}
+
+		catalog := struct {
+			Repositories []string `json:"repositories"`
+		}{}
+		next, err := decodePage(resp, &catalog)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read catalog")
+		}
+
+		for _, repository := range catalog.Repositories {
+			if strings.HasPrefix(repository, namespace+"/") {
+				repositories = append(repositories, repository)
+			}
+		}
+		path = next
+	}
+
+	return repositories, nil
+}
+
+func (c *registryClient) listTags(repository string) ([]string, error) {
+	tags := []string{}
+
+	path := fmt.Sprintf("%s/tags/list", repository)
+	for path != "" {
+		resp, err := c.do("GET", path, "", fmt.Sprintf("repository:%s:pull", repository))
+		if err != nil {
+			return nil, err
+		}
+
+		tagList := struct {
+			Tags []string `json:"tags"`
+		}{}
+		next, err := decodePage(resp, &tagList)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read tags")
+		}
+
+		tags = append(tags, tagList.Tags...)
+		path = next
+	}
+
+	return tags, nil
+}
+
+func (c *registryClient) getDigest(repository string, tag string) (string, error) {
+	resp, err := c.do("HEAD", fmt.Sprintf("%s/manifests/%s", repository, tag), strings.Join(manifestMediaTypes, ", "), fmt.Sprintf("repository:%s:pull", repository))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.New("registry did not return a digest")
+	}
+
+	return digest, nil
+}
+
+func (c *registryClient) deleteManifest(repository string, digest string) error {
+	resp, err := c.do("DELETE", fmt.Sprintf("%s/manifests/%s", repository, digest), "", fmt.Sprintf("repository:%s:delete,pull", repository))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusMethodNotAllowed:
+		return errors.Errorf("deletes are disabled in the registry on %s", c.hostname)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Errorf("user %q does not have permission to delete from %s", c.username, repository)
+	default:
+		return errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+// decodePage decodes the response into obj, and returns the path of the next page from the Link header
+func decodePage(resp *http.Response, obj interface{}) (string, error) {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return "", errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(obj); err != nil {
+		return "", errors.Wrap(err, "failed to decode response")
+	}
+
+	matches := linkNextRegexp.FindStringSubmatch(resp.Header.Get("Link"))
+	if len(matches) != 2 {
+		return "", nil
+	}
+
+	return matches[1], nil
+}
@@ -0,0 +1,185 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_planGC(t *testing.T) {
+	req := require.New(t)
+
+	tags := []*GCTag{
+		{Repository: "app/nginx", Tag: "1.19", Digest: "sha256:a"},
+		{Repository: "app/nginx", Tag: "1.18", Digest: "sha256:b"},
+		{Repository: "app/nginx", Tag: "stable", Digest: "sha256:a"},
+		{Repository: "app/redis", Tag: "5", Digest: "sha256:c"},
+		{Repository: "app/redis", Tag: "6", Digest: "sha256:d"},
+	}
+
+	references := []string{
+		"registry.example.com/app/nginx:1.19",
+		"registry.example.com/app/redis@sha256:d",
+	}
+
+	toDelete := planGC(tags, references)
+	req.Equal(2, toDelete)
+
+	actions := map[string]string{}
+	for _, tag := range tags {
+		actions[tag.Repository+":"+tag.Tag] = tag.Action
+	}
+	req.Equal(map[string]string{
+		"app/nginx:1.19":   GCActionKeep,
+		"app/nginx:1.18":   GCActionDelete,
+		"app/nginx:stable": GCActionKeep,
+		"app/redis:5":      GCActionDelete,
+		"app/redis:6":      GCActionKeep,
+	}, actions)
+}
+
+func Test_registryClient(t *testing.T) {
+	req := require.New(t)
+
+	deleted := []string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "admin" || password != "password" {
+			w.Header().Set("Www-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/_catalog" && r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/_catalog?last=app%2Fnginx&n=1000>; rel="next"`)
+			fmt.Fprint(w, `{"repositories": ["app/nginx", "other/nginx"]}`)
+		case r.URL.Path == "/v2/_catalog":
+			fmt.Fprint(w, `{"repositories": ["app/redis"]}`)
+		case r.URL.Path == "/v2/app/nginx/tags/list":
+			fmt.Fprint(w, `{"name": "app/nginx", "tags": ["1.18", "1.19"]}`)
+		case r.Method == "HEAD" && r.URL.Path == "/v2/app/nginx/manifests/1.18":
+			w.Header().Set("Docker-Content-Digest", "sha256:b")
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/v2/app/nginx/manifests/"):
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/app/nginx/manifests/"))
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	hostname := strings.TrimPrefix(server.URL, "https://")
+	rc := &registryClient{
+		client:   server.Client(),
+		baseURL:  fmt.Sprintf("https://%s/v2/", hostname),
+		hostname: hostname,
+		username: "admin",
+		password: "password",
+	}
+
+	repositories, err := rc.listRepositories("app")
+	req.NoError(err)
+	req.Equal([]string{"app/nginx", "app/redis"}, repositories)
+
+	tags, err := rc.listTags("app/nginx")
+	req.NoError(err)
+	req.Equal([]string{"1.18", "1.19"}, tags)
+
+	digest, err := rc.getDigest("app/nginx", "1.18")
+	req.NoError(err)
+	req.Equal("sha256:b", digest)
+
+	req.NoError(rc.deleteManifest("app/nginx", digest))
+	req.Equal([]string{"sha256:b"}, deleted)
+}
+
+func Test_registryReference(t *testing.T) {
+	rewrites := []kustomizationImage{
+		{Name: "nginx", NewName: "registry.example.com/app/nginx"},
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		expected string
+	}{
+		{
+			name:     "rewritten image",
+			ref:      "nginx:1.19",
+			expected: "registry.example.com/app/nginx:1.19",
+		},
+		{
+			name:     "additional image",
+			ref:      "postgres:10.7",
+			expected: "registry.example.com/app/postgres:10.7",
+		},
+		{
+			name:     "collector image from another registry",
+			ref:      "quay.io/replicatedcom/troubleshoot@sha256:abc",
+			expected: "registry.example.com/app/troubleshoot@sha256:abc",
+		},
+		{
+			name:     "image without a tag",
+			ref:      "busybox",
+			expected: "registry.example.com/app/busybox:latest",
+		},
+		{
+			name:     "image already in the app registry",
+			ref:      "registry.example.com/app/redis:6",
+			expected: "registry.example.com/app/redis:6",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			req.Equal(test.expected, registryReference(test.ref, rewrites, "registry.example.com", "app"))
+		})
+	}
+}
+
+func Test_findSpecImages(t *testing.T) {
+	req := require.New(t)
+
+	spec := map[string]interface{}{
+		"collectors": []interface{}{
+			map[string]interface{}{
+				"clusterInfo": map[string]interface{}{},
+			},
+			map[string]interface{}{
+				"run": map[string]interface{}{
+					"name":  "ping",
+					"image": "busybox:1",
+				},
+			},
+			map[string]interface{}{
+				"copy": map[string]interface{}{
+					"selector": []interface{}{"app=nginx"},
+				},
+			},
+		},
+	}
+
+	images, err := findSpecImages(spec)
+	req.NoError(err)
+	req.Equal([]string{"busybox:1"}, images)
+
+	// planGC keeps the supporting images once they are references
+	tags := []*GCTag{
+		{Repository: "app/busybox", Tag: "1", Digest: "sha256:a"},
+		{Repository: "app/busybox", Tag: "0.9", Digest: "sha256:b"},
+	}
+	references := []string{registryReference(images[0], nil, "registry.example.com", "app")}
+	req.Equal(1, planGC(tags, references))
+	req.Equal(GCActionDelete, tags[0].Action)
+	req.Equal("0.9", tags[0].Tag)
+	req.Equal(GCActionKeep, tags[1].Action)
+}
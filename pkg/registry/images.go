@@ -0,0 +1,479 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	ImageStatusPresent   = "present"
+	ImageStatusMissing   = "missing"
+	ImageStatusUnchecked = "unchecked"
+	ImageStatusError     = "error"
+)
+
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// Image is an image referenced by the rendered manifests of an app version
+type Image struct {
+	Original  string   `json:"original"`
+	Rewritten string   `json:"rewritten,omitempty"`
+	Registry  string   `json:"registry"`
+	Resources []string `json:"resources"`
+	Status    string   `json:"status"`
+	Digest    string   `json:"digest,omitempty"`
+	Size      int64    `json:"size,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type ImageInventory struct {
+	Images  []Image `json:"images"`
+	Missing int     `json:"missing"`
+}
+
+type kustomizationImage struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName"`
+	NewTag  string `yaml:"newTag"`
+	Digest  string `yaml:"digest"`
+}
+
+type registryCreds struct {
+	Hostname string
+	Username string
+	Password string
+	TLS      *RegistryTLS
+}
+
+// GetImageInventory lists the images in the rendered manifests of the app version, and checks if the images
+// that resolve to the app registry or the kurl registry are present there
+func GetImageInventory(appID string, sequence int64) (*ImageInventory, error) {
+	images, err := listVersionImages(appID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list images")
+	}
+
+	registries, err := registriesToCheck(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get registries")
+	}
+
+	inventory := ImageInventory{
+		Images: images,
+	}
+	for i := range inventory.Images {
+		image := &inventory.Images[i]
+
+		creds, ok := registries[image.Registry]
+		if !ok {
+			image.Status = ImageStatusUnchecked
+			continue
+		}
+
+		ref := image.Original
+		if image.Rewritten != "" {
+			ref = image.Rewritten
+		}
+		repository, reference := splitReference(ref)
+		_, repository = splitRegistry(repository)
+
+		client, err := registryHTTPClient(creds.TLS)
+		if err != nil {
+			image.Status = ImageStatusError
+			image.Error = err.Error()
+			continue
+		}
+
+		digest, size, err := getImageManifest(client, creds, repository, reference)
+		if err == errImageNotFound {
+			image.Status = ImageStatusMissing
+			inventory.Missing++
+			continue
+		}
+		if err != nil {
+			logger.Error(errors.Wrapf(err, "failed to check image %s", ref))
+			image.Status = ImageStatusError
+			image.Error = err.Error()
+			continue
+		}
+
+		image.Status = ImageStatusPresent
+		image.Digest = digest
+		image.Size = size
+	}
+
+	return &inventory, nil
+}
+
+// listVersionImages returns the images in the rendered manifests of the app version
+func listVersionImages(appID string, sequence int64) ([]Image, error) {
+	archiveDir, err := version.GetAppVersionArchive(appID, sequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get app version archive")
+	}
+	defer os.RemoveAll(archiveDir)
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load kotskinds")
+	}
+
+	return listArchiveImages(appID, archiveDir, kotsKinds)
+}
+
+// listArchiveImages returns the images in the rendered manifests of the app version in archiveDir
+func listArchiveImages(appID string, archiveDir string, kotsKinds *kotsutil.KotsKinds) ([]Image, error) {
+	downstreams, err := downstream.ListDownstreamsForApp(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list downstreams")
+	}
+	downstreamName := ""
+	if len(downstreams) > 0 {
+		downstreamName = downstreams[0].Name
+	}
+
+	files, err := downstream.BuildManifests(archiveDir, downstreamName, kotsKinds.KustomizeVersion())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build manifests")
+	}
+
+	rewrites, err := loadImageRewrites(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load image rewrites")
+	}
+
+	return listImages(files, rewrites), nil
+}
+
+// registriesToCheck returns the credentials of the registries that images can be checked in, by hostname
+func registriesToCheck(appID string) (map[string]registryCreds, error) {
+	registries := map[string]registryCreds{}
+
+	registrySettings, err := GetRegistrySettingsForApp(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get registry settings")
+	}
+	if registrySettings != nil && registrySettings.Hostname != "" {
+		password, err := encryptionkey.Decrypt(registrySettings.PasswordEnc)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt registry password")
+		}
+		registries[registrySettings.Hostname] = registryCreds{
+			Hostname: registrySettings.Hostname,
+			Username: registrySettings.Username,
+			Password: string(password),
+		}
+	}
+
+	hasKurlRegistry, err := HasKurlRegistry()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check for kurl registry")
+	}
+	if hasKurlRegistry {
+		hostname, username, password, err := GetKurlRegistryCreds()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get kurl registry creds")
+		}
+		if hostname != "" {
+			registries[hostname] = registryCreds{
+				Hostname: hostname,
+				Username: username,
+				Password: password,
+			}
+		}
+	}
+
+	for hostname, creds := range registries {
+		registryTLS, err := GetRegistryTLS(hostname)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get registry tls")
+		}
+		creds.TLS = registryTLS
+		registries[hostname] = creds
+	}
+
+	return registries, nil
+}
+
+// loadImageRewrites reads the images that kots rewrote from the midstream kustomization
+func loadImageRewrites(archiveDir string) ([]kustomizationImage, error) {
+	content, err := ioutil.ReadFile(filepath.Join(archiveDir, "overlays", "midstream", "kustomization.yaml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read midstream kustomization")
+	}
+
+	kustomization := struct {
+		Images []kustomizationImage `yaml:"images"`
+	}{}
+	if err := yaml.Unmarshal(content, &kustomization); err != nil {
+		return nil, errors.Wrap(err, "failed to parse midstream kustomization")
+	}
+
+	return kustomization.Images, nil
+}
+
+// listImages returns the images in the rendered files, with the original reference when the image was rewritten
+func listImages(files map[string][]byte, rewrites []kustomizationImage) []Image {
+	resourcesByRef := map[string][]string{}
+
+	filenames := []string{}
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		doc := map[interface{}]interface{}{}
+		if err := yaml.Unmarshal(files[filename], &doc); err != nil {
+			continue
+		}
+
+		resource := resourceName(doc)
+		for _, ref := range findImages(doc) {
+			if !containsString(resourcesByRef[ref], resource) {
+				resourcesByRef[ref] = append(resourcesByRef[ref], resource)
+			}
+		}
+	}
+
+	refs := []string{}
+	for ref := range resourcesByRef {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	images := []Image{}
+	for _, ref := range refs {
+		image := Image{
+			Original:  ref,
+			Resources: resourcesByRef[ref],
+		}
+
+		if original := originalReference(ref, rewrites); original != "" {
+			image.Original = original
+			image.Rewritten = ref
+		}
+
+		repository, _ := splitReference(ref)
+		image.Registry, _ = splitRegistry(repository)
+
+		images = append(images, image)
+	}
+
+	return images
+}
+
+// originalReference returns the reference that ref was rewritten from, or an empty string if it was not rewritten
+func originalReference(ref string, rewrites []kustomizationImage) string {
+	repository, reference := splitReference(ref)
+
+	for _, rewrite := range rewrites {
+		if rewrite.NewName == "" || rewrite.NewName != repository {
+			continue
+		}
+		if strings.HasPrefix(reference, "sha256:") {
+			return fmt.Sprintf("%s@%s", rewrite.Name, reference)
+		}
+		return fmt.Sprintf("%s:%s", rewrite.Name, reference)
+	}
+
+	return ""
+}
+
+func findImages(obj interface{}) []string {
+	images := []string{}
+
+	switch o := obj.(type) {
+	case map[interface{}]interface{}:
+		for key, value := range o {
+			switch key {
+			case "containers", "initContainers", "ephemeralContainers":
+				containers, ok := value.([]interface{})
+				if !ok {
+					continue
+				}
+				for _, container := range containers {
+					c, ok := container.(map[interface{}]interface{})
+					if !ok {
+						continue
+					}
+					if image, ok := c["image"].(string); ok && image != "" {
+						images = append(images, image)
+					}
+				}
+			default:
+				images = append(images, findImages(value)...)
+			}
+		}
+	case []interface{}:
+		for _, value := range o {
+			images = append(images, findImages(value)...)
+		}
+	}
+
+	return images
+}
+
+func resourceName(doc map[interface{}]interface{}) string {
+	kind, _ := doc["kind"].(string)
+	name := ""
+	if metadata, ok := doc["metadata"].(map[interface{}]interface{}); ok {
+		name, _ = metadata["name"].(string)
+	}
+	return fmt.Sprintf("%s/%s", kind, name)
+}
+
+// splitReference splits an image reference into the repository and the tag or digest, which defaults to latest
+func splitReference(ref string) (string, string) {
+	if i := strings.Index(ref, "@"); i != -1 {
+		return ref[:i], ref[i+1:]
+	}
+
+	lastSlash := strings.LastIndex(ref, "/")
+	if i := strings.LastIndex(ref, ":"); i > lastSlash {
+		return ref[:i], ref[i+1:]
+	}
+
+	return ref, "latest"
+}
+
+// splitRegistry splits a repository into the registry hostname and the path in the registry,
+// following the docker defaults for images without a registry
+func splitRegistry(repository string) (string, string) {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0], parts[1]
+	}
+
+	if len(parts) == 1 {
+		return "docker.io", "library/" + repository
+	}
+	return "docker.io", repository
+}
+
+var errImageNotFound = errors.New("image not found")
+
+// getImageManifest returns the digest and the total size of the config and layers of the image in the registry.
+// For multi-arch images, the size of the linux/amd64 image is returned
+func getImageManifest(client *http.Client, creds registryCreds, repository string, reference string) (string, int64, error) {
+	scheme := registryScheme(client, creds.Hostname, creds.TLS != nil && creds.TLS.Insecure)
+	baseURL := fmt.Sprintf("%s://%s/v2/", scheme, creds.Hostname)
+	manifestURL := fmt.Sprintf("%s%s/manifests/%s", baseURL, repository, reference)
+
+	authorization := ""
+	body, digest, status, challenge, err := fetchManifest(client, manifestURL, authorization)
+	if err != nil {
+		return "", 0, connectionError(creds.Hostname, err)
+	}
+	if status == http.StatusUnauthorized {
+		authorization, err = authorize(client, challenge, baseURL, creds.Hostname, creds.Username, creds.Password, fmt.Sprintf("repository:%s:pull", repository))
+		if err != nil {
+			return "", 0, err
+		}
+		body, digest, status, _, err = fetchManifest(client, manifestURL, authorization)
+		if err != nil {
+			return "", 0, connectionError(creds.Hostname, err)
+		}
+	}
+	if status == http.StatusNotFound {
+		return "", 0, errImageNotFound
+	}
+	if status != http.StatusOK {
+		return "", 0, errors.Errorf("%s returned unexpected status %d", creds.Hostname, status)
+	}
+
+	manifest := struct {
+		Config struct {
+			Size int64 `json:"size"`
+		} `json:"config"`
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+		Manifests []struct {
+			Digest   string `json:"digest"`
+			Platform struct {
+				OS           string `json:"os"`
+				Architecture string `json:"architecture"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}{}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return "", 0, errors.Wrap(err, "failed to parse manifest")
+	}
+
+	if len(manifest.Manifests) > 0 {
+		childDigest := manifest.Manifests[0].Digest
+		for _, m := range manifest.Manifests {
+			if m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				childDigest = m.Digest
+				break
+			}
+		}
+		if _, size, err := getImageManifest(client, creds, repository, childDigest); err == nil {
+			return digest, size, nil
+		}
+		return digest, 0, nil
+	}
+
+	size := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+
+	return digest, size, nil
+}
+
+func fetchManifest(client *http.Client, manifestURL string, authorization string) ([]byte, string, int, string, error) {
+	req, err := http.NewRequest("GET", manifestURL, nil)
+	if err != nil {
+		return nil, "", 0, "", errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", 0, "", errors.Wrap(err, "failed to read response")
+	}
+
+	return body, resp.Header.Get("Docker-Content-Digest"), resp.StatusCode, resp.Header.Get("Www-Authenticate"), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_splitRegistry(t *testing.T) {
+	tests := []struct {
+		image            string
+		expectRegistry   string
+		expectRepository string
+		expectReference  string
+	}{
+		{
+			image:            "nginx",
+			expectRegistry:   "docker.io",
+			expectRepository: "library/nginx",
+			expectReference:  "latest",
+		},
+		{
+			image:            "replicated/kotsadm:v1.15.0",
+			expectRegistry:   "docker.io",
+			expectRepository: "replicated/kotsadm",
+			expectReference:  "v1.15.0",
+		},
+		{
+			image:            "registry.example.com:5000/app/nginx@sha256:abcd",
+			expectRegistry:   "registry.example.com:5000",
+			expectRepository: "app/nginx",
+			expectReference:  "sha256:abcd",
+		},
+		{
+			image:            "localhost/nginx:1.19",
+			expectRegistry:   "localhost",
+			expectRepository: "nginx",
+			expectReference:  "1.19",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			req := require.New(t)
+
+			repository, reference := splitReference(test.image)
+			registry, repository := splitRegistry(repository)
+
+			req.Equal(test.expectRegistry, registry)
+			req.Equal(test.expectRepository, repository)
+			req.Equal(test.expectReference, reference)
+		})
+	}
+}
+
+func Test_listImages(t *testing.T) {
+	req := require.New(t)
+
+	files := map[string][]byte{
+		"deployment.yaml": []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: init
+          image: busybox
+      containers:
+        - name: web
+          image: registry.example.com/app/nginx:1.19
+`),
+		"job.yaml": []byte(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+        - name: migrate
+          image: registry.example.com/app/nginx:1.19
+`),
+	}
+
+	rewrites := []kustomizationImage{
+		{
+			Name:    "nginx",
+			NewName: "registry.example.com/app/nginx",
+			NewTag:  "1.19",
+		},
+	}
+
+	images := listImages(files, rewrites)
+	req.Equal([]Image{
+		{
+			Original:  "busybox",
+			Registry:  "docker.io",
+			Resources: []string{"Deployment/web"},
+		},
+		{
+			Original:  "nginx:1.19",
+			Rewritten: "registry.example.com/app/nginx:1.19",
+			Registry:  "registry.example.com",
+			Resources: []string{"Deployment/web", "Job/migrate"},
+		},
+	}, images)
+}
+
+func Test_getImageManifest(t *testing.T) {
+	req := require.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "admin" || password != "password" {
+			w.Header().Set("Www-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/app/nginx/manifests/1.19":
+			w.Header().Set("Docker-Content-Digest", "sha256:list")
+			fmt.Fprint(w, `{"manifests": [
+				{"digest": "sha256:arm64", "platform": {"os": "linux", "architecture": "arm64"}},
+				{"digest": "sha256:amd64", "platform": {"os": "linux", "architecture": "amd64"}}
+			]}`)
+		case "/v2/app/nginx/manifests/sha256:amd64":
+			w.Header().Set("Docker-Content-Digest", "sha256:amd64")
+			fmt.Fprint(w, `{"config": {"size": 100}, "layers": [{"size": 1000}, {"size": 2000}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	creds := registryCreds{
+		Hostname: strings.TrimPrefix(server.URL, "https://"),
+		Username: "admin",
+		Password: "password",
+	}
+
+	digest, size, err := getImageManifest(server.Client(), creds, "app/nginx", "1.19")
+	req.NoError(err)
+	req.Equal("sha256:list", digest)
+	req.Equal(int64(3100), size)
+
+	_, _, err = getImageManifest(server.Client(), creds, "app/nginx", "1.20")
+	req.Equal(errImageNotFound, err)
+}
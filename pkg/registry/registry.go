@@ -3,7 +3,7 @@ package registry
 import (
 	"bufio"
 	"database/sql"
-	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -12,10 +12,10 @@ import (
 
 	"github.com/pkg/errors"
 	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
-	"github.com/replicatedhq/kots/pkg/crypto"
 	"github.com/replicatedhq/kots/pkg/rewrite"
 	"github.com/replicatedhq/kotsadm/pkg/app"
 	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
 	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
 	"github.com/replicatedhq/kotsadm/pkg/logger"
 	"github.com/replicatedhq/kotsadm/pkg/persistence"
@@ -59,17 +59,33 @@ func GetRegistrySettingsForApp(appID string) (*types.RegistrySettings, error) {
 	return &registrySettings, nil
 }
 
+// PasswordMask is sent by the admin console in place of the saved registry password
+const PasswordMask = "***HIDDEN***"
+
+// ResolvePassword returns the decrypted saved password when password is the mask, so that settings
+// submitted without retyping the password keep working. Any other password is returned as is
+func ResolvePassword(registrySettings *types.RegistrySettings, password string) (string, error) {
+	if password != PasswordMask || registrySettings == nil || registrySettings.PasswordEnc == "" {
+		return password, nil
+	}
+
+	decrypted, err := encryptionkey.Decrypt(registrySettings.PasswordEnc)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt registry password")
+	}
+
+	return string(decrypted), nil
+}
+
 func UpdateRegistry(appID string, hostname string, username string, password string, namespace string) error {
 	logger.Debug("updating app registry",
 		zap.String("appID", appID))
 
-	cipher, err := crypto.AESCipherFromString(os.Getenv("API_ENCRYPTION_KEY"))
+	passwordEnc, err := encryptionkey.Encrypt([]byte(password))
 	if err != nil {
-		return errors.Wrap(err, "failed to create aes cipher")
+		return errors.Wrap(err, "failed to encrypt password")
 	}
 
-	passwordEnc := base64.StdEncoding.EncodeToString(cipher.Encrypt([]byte(password)))
-
 	db := persistence.MustGetPGSession()
 	query := `update app set registry_hostname = $1, registry_username = $2, registry_password_enc = $3, namespace = $4 where id = $5`
 	_, err = db.Exec(query, hostname, username, passwordEnc, namespace, appID)
@@ -198,6 +214,13 @@ func RewriteImages(appID string, sequence int64, hostname string, username strin
 		RegistryNamespace: namespace,
 	}
 
+	// kots builds the SystemContext of image pushes itself, and can't be given the one for the registry tls settings yet
+	// TODO: pass the SystemContext to kots so that pushes trust the registry CA certificates
+	if _, err := WriteContainersConfig(); err != nil {
+		finalError = err
+		return errors.Wrap(err, "failed to write containers config")
+	}
+
 	if err := rewrite.Rewrite(options); err != nil {
 		finalError = err
 		return errors.Wrap(err, "failed to rewrite images")
@@ -214,7 +237,7 @@ func RewriteImages(appID string, sequence int64, hostname string, username strin
 		return errors.Wrap(err, "failed to upload app version")
 	}
 
-	if err := preflight.Run(appID, newSequence, appDir); err != nil {
+	if err := preflight.Run(appID, newSequence, appDir, preflight.TriggerRegistry); err != nil {
 		finalError = err
 		return errors.Wrap(err, "failed to run preflights")
 	}
@@ -252,3 +275,54 @@ func HasKurlRegistry() (bool, error) {
 
 	return false, nil
 }
+
+// GetKurlRegistryCreds returns the hostname and credentials of the kurl registry, or empty strings if there is none
+func GetKurlRegistryCreds() (hostname string, username string, password string, finalErr error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		finalErr = errors.Wrap(err, "failed to get cluster config")
+		return
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		finalErr = errors.Wrap(err, "failed to create kubernetes clientset")
+		return
+	}
+
+	// kURL registry secret is always in default namespace
+	secret, err := clientset.CoreV1().Secrets("default").Get("registry-creds", metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+
+	dockerJson, ok := secret.Data[".dockerconfigjson"]
+	if !ok {
+		return
+	}
+
+	type dockerRegistryAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	dockerConfig := struct {
+		Auths map[string]dockerRegistryAuth `json:"auths"`
+	}{}
+
+	err = json.Unmarshal(dockerJson, &dockerConfig)
+	if err != nil {
+		return
+	}
+
+	for host, auth := range dockerConfig.Auths {
+		if auth.Username == "kurl" {
+			hostname = host
+			username = auth.Username
+			password = auth.Password
+			return
+		}
+	}
+
+	return
+}
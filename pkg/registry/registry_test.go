@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"os"
+	"testing"
+
+	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
+	"github.com/replicatedhq/kotsadm/pkg/registry/types"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_ResolvePassword(t *testing.T) {
+	req := require.New(t)
+
+	cipher, err := crypto.NewAESCipher()
+	req.NoError(err)
+
+	defer os.Setenv(encryptionkey.CurrentKeyEnv, os.Getenv(encryptionkey.CurrentKeyEnv))
+	os.Setenv(encryptionkey.CurrentKeyEnv, cipher.ToString())
+
+	passwordEnc, err := encryptionkey.Encrypt([]byte("hunter2"))
+	req.NoError(err)
+
+	saved := &types.RegistrySettings{
+		Hostname:    "registry.example.com",
+		Username:    "admin",
+		PasswordEnc: passwordEnc,
+		Namespace:   "app",
+	}
+
+	tests := []struct {
+		name             string
+		registrySettings *types.RegistrySettings
+		password         string
+		expected         string
+	}{
+		{
+			name:             "mask is replaced with the saved password",
+			registrySettings: saved,
+			password:         PasswordMask,
+			expected:         "hunter2",
+		},
+		{
+			name:             "new password is kept",
+			registrySettings: saved,
+			password:         "correct horse",
+			expected:         "correct horse",
+		},
+		{
+			name:             "mask is kept when nothing is saved",
+			registrySettings: nil,
+			password:         PasswordMask,
+			expected:         PasswordMask,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			password, err := ResolvePassword(test.registrySettings, test.password)
+			req.NoError(err)
+			req.Equal(test.expected, password)
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	containerstypes "github.com/containers/image/types"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+)
+
+// containersConfigDir is where kotsadm writes the registry CA certificates and insecure registries for
+// containers/image, which images are pushed with. The system config in /etc/containers is never modified
+func containersConfigDir() string {
+	if os.Getenv("KOTSADM_CONTAINERS_CONFIG_DIR") != "" {
+		return os.Getenv("KOTSADM_CONTAINERS_CONFIG_DIR")
+	}
+	return filepath.Join(os.TempDir(), "kotsadm-containers")
+}
+
+// RegistryTLS is the CA certificate and insecure opt-in for a registry hostname
+type RegistryTLS struct {
+	Hostname  string    `json:"hostname"`
+	CACert    string    `json:"caCert"`
+	Insecure  bool      `json:"insecure"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func ListRegistryTLS() ([]*RegistryTLS, error) {
+	db := persistence.MustGetPGSession()
+	query := `select hostname, ca_cert, insecure, updated_at from registry_tls order by hostname`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query registry tls")
+	}
+	defer rows.Close()
+
+	registryTLSs := []*RegistryTLS{}
+	for rows.Next() {
+		registryTLS, err := scanRegistryTLS(rows)
+		if err != nil {
+			return nil, err
+		}
+		registryTLSs = append(registryTLSs, registryTLS)
+	}
+
+	return registryTLSs, nil
+}
+
+// GetRegistryTLS returns the tls settings of the registry, or nil if there are none
+func GetRegistryTLS(hostname string) (*RegistryTLS, error) {
+	db := persistence.MustGetPGSession()
+	query := `select hostname, ca_cert, insecure, updated_at from registry_tls where hostname = $1`
+	row := db.QueryRow(query, hostname)
+
+	registryTLS, err := scanRegistryTLS(row)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return registryTLS, nil
+}
+
+// SetRegistryTLS saves the CA certificates (PEM) and insecure opt-in for the registry, and writes them
+// where image pushes will find them
+func SetRegistryTLS(hostname string, caCert string, insecure bool) error {
+	if err := validateRegistryHostname(hostname); err != nil {
+		return err
+	}
+	if caCert != "" {
+		if err := validateCACert(caCert); err != nil {
+			return err
+		}
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `insert into registry_tls (hostname, ca_cert, insecure, updated_at) values ($1, $2, $3, $4)
+	on conflict (hostname) do update set ca_cert = EXCLUDED.ca_cert, insecure = EXCLUDED.insecure, updated_at = EXCLUDED.updated_at`
+	_, err := db.Exec(query, hostname, caCert, insecure, time.Now().UTC())
+	if err != nil {
+		return errors.Wrap(err, "failed to set registry tls")
+	}
+
+	if _, err := WriteContainersConfig(); err != nil {
+		return errors.Wrap(err, "failed to write containers config")
+	}
+
+	return nil
+}
+
+func DeleteRegistryTLS(hostname string) error {
+	if err := validateRegistryHostname(hostname); err != nil {
+		return err
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `delete from registry_tls where hostname = $1`
+	_, err := db.Exec(query, hostname)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete registry tls")
+	}
+
+	if _, err := WriteContainersConfig(); err != nil {
+		return errors.Wrap(err, "failed to write containers config")
+	}
+
+	return nil
+}
+
+// WriteContainersConfig writes the CA certificates and insecure registries in the database to a directory owned
+// by kotsadm, and returns the SystemContext that points containers/image at them. This must be called before images
+// are pushed, since the files don't survive a restart of the pod. It returns nil when no registry has tls settings
+func WriteContainersConfig() (*containerstypes.SystemContext, error) {
+	registryTLSs, err := ListRegistryTLS()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list registry tls")
+	}
+
+	return writeContainersConfig(containersConfigDir(), registryTLSs)
+}
+
+func writeContainersConfig(configDir string, registryTLSs []*RegistryTLS) (*containerstypes.SystemContext, error) {
+	certsDir := filepath.Join(configDir, "certs.d")
+	registriesConf := filepath.Join(configDir, "registries.conf")
+
+	// the directory is only written by kotsadm, so the certs of registries that were deleted can be removed with it
+	if err := os.RemoveAll(configDir); err != nil {
+		return nil, errors.Wrap(err, "failed to remove containers config dir")
+	}
+	if len(registryTLSs) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(certsDir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create certs dir")
+	}
+
+	registriesConfData := bytes.NewBufferString("# managed by kotsadm\n")
+	for _, registryTLS := range registryTLSs {
+		if err := validateRegistryHostname(registryTLS.Hostname); err != nil {
+			logger.Error(errors.Wrapf(err, "skipping tls settings of registry %q", registryTLS.Hostname))
+			continue
+		}
+
+		if registryTLS.CACert != "" {
+			hostCertsDir := filepath.Join(certsDir, registryTLS.Hostname)
+			if err := os.MkdirAll(hostCertsDir, 0700); err != nil {
+				return nil, errors.Wrapf(err, "failed to create certs dir for %s", registryTLS.Hostname)
+			}
+			if err := ioutil.WriteFile(filepath.Join(hostCertsDir, "ca.crt"), []byte(registryTLS.CACert), 0600); err != nil {
+				return nil, errors.Wrapf(err, "failed to write ca cert for %s", registryTLS.Hostname)
+			}
+		}
+
+		if registryTLS.Insecure {
+			fmt.Fprintf(registriesConfData, "\n[[registry]]\nlocation = %q\ninsecure = true\n", registryTLS.Hostname)
+		}
+	}
+
+	if err := ioutil.WriteFile(registriesConf, registriesConfData.Bytes(), 0600); err != nil {
+		return nil, errors.Wrap(err, "failed to write registries config")
+	}
+
+	return &containerstypes.SystemContext{
+		DockerPerHostCertDirPath: certsDir,
+		SystemRegistriesConfPath: registriesConf,
+	}, nil
+}
+
+// validateRegistryHostname checks that hostname is a host with an optional port, since it is used as a path
+func validateRegistryHostname(hostname string) error {
+	if hostname == "" {
+		return errors.New("hostname is required")
+	}
+
+	host := hostname
+	if strings.Contains(hostname, ":") {
+		h, port, err := net.SplitHostPort(hostname)
+		if err != nil {
+			return errors.Wrapf(err, "invalid hostname %q", hostname)
+		}
+		portNumber, err := strconv.Atoi(port)
+		if err != nil || portNumber < 1 || portNumber > 65535 {
+			return errors.Errorf("invalid port in hostname %q", hostname)
+		}
+		host = h
+	}
+
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if !registryHostRegex.MatchString(host) {
+		return errors.Errorf("invalid hostname %q", hostname)
+	}
+
+	return nil
+}
+
+func validateCACert(caCert string) error {
+	rest := []byte(caCert)
+	numCerts := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return errors.Errorf("unexpected %s in CA certificates", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return errors.Wrap(err, "failed to parse CA certificate")
+		}
+		numCerts++
+	}
+
+	if numCerts == 0 {
+		return errors.New("no PEM encoded certificates found")
+	}
+
+	return nil
+}
+
+// registryHTTPClient returns a client that trusts the CA certificates of the registry, and skips
+// verification if the registry is insecure
+func registryHTTPClient(registryTLS *RegistryTLS) (*http.Client, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	if registryTLS == nil {
+		return client, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if registryTLS.CACert != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM([]byte(registryTLS.CACert)) {
+			return nil, errors.Errorf("failed to load CA certificates for %s", registryTLS.Hostname)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if registryTLS.Insecure {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client.Transport = transport
+
+	return client, nil
+}
+
+// registryScheme returns https, unless the registry is insecure and does not serve https
+func registryScheme(client *http.Client, hostname string, insecure bool) string {
+	if !insecure {
+		return "https"
+	}
+
+	resp, err := client.Get(fmt.Sprintf("https://%s/v2/", hostname))
+	if err != nil {
+		return "http"
+	}
+	resp.Body.Close()
+
+	return "https"
+}
+
+var registryHostRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRegistryTLS(row scanner) (*RegistryTLS, error) {
+	registryTLS := RegistryTLS{}
+
+	var caCert sql.NullString
+	var insecure sql.NullBool
+	var updatedAt sql.NullTime
+	if err := row.Scan(&registryTLS.Hostname, &caCert, &insecure, &updatedAt); err != nil {
+		return nil, errors.Wrap(err, "failed to scan registry tls")
+	}
+
+	registryTLS.CACert = caCert.String
+	registryTLS.Insecure = insecure.Bool
+	if updatedAt.Valid {
+		registryTLS.UpdatedAt = updatedAt.Time
+	}
+
+	return &registryTLS, nil
+}
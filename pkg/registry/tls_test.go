@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_registryHTTPClient(t *testing.T) {
+	server := newTestRegistry()
+	defer server.Close()
+
+	hostname := strings.TrimPrefix(server.URL, "https://")
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	tests := []struct {
+		name        string
+		registryTLS *RegistryTLS
+		expectErr   string
+	}{
+		{
+			name:      "no tls settings",
+			expectErr: "signed by an unknown authority",
+		},
+		{
+			name: "ca cert",
+			registryTLS: &RegistryTLS{
+				Hostname: hostname,
+				CACert:   caCert,
+			},
+		},
+		{
+			name: "insecure",
+			registryTLS: &RegistryTLS{
+				Hostname: hostname,
+				Insecure: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			client, err := registryHTTPClient(test.registryTLS)
+			req.NoError(err)
+
+			insecure := test.registryTLS != nil && test.registryTLS.Insecure
+			scheme := registryScheme(client, hostname, insecure)
+			req.Equal("https", scheme)
+
+			err = checkRegistryAccess(client, scheme, hostname, "admin", "password", "writable")
+			if test.expectErr == "" {
+				req.NoError(err)
+				return
+			}
+			req.Error(err)
+			req.Contains(err.Error(), test.expectErr)
+		})
+	}
+}
+
+func Test_validateCACert(t *testing.T) {
+	req := require.New(t)
+
+	server := newTestRegistry()
+	defer server.Close()
+
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	req.NoError(validateCACert(caCert))
+
+	req.Error(validateCACert("not a certificate"))
+	req.Error(validateCACert(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("key")}))))
+}
+
+func Test_validateRegistryHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		valid    bool
+	}{
+		{hostname: "registry.example.com", valid: true},
+		{hostname: "registry.example.com:5000", valid: true},
+		{hostname: "localhost", valid: true},
+		{hostname: "10.96.0.10:443", valid: true},
+		{hostname: "[::1]:5000", valid: true},
+		{hostname: "", valid: false},
+		{hostname: "..", valid: false},
+		{hostname: ".", valid: false},
+		{hostname: "../etc", valid: false},
+		{hostname: "registry.example.com/library", valid: false},
+		{hostname: "registry.example.com:", valid: false},
+		{hostname: "registry.example.com:99999", valid: false},
+		{hostname: "-registry.example.com", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.hostname, func(t *testing.T) {
+			req := require.New(t)
+
+			err := validateRegistryHostname(test.hostname)
+			if test.valid {
+				req.NoError(err)
+			} else {
+				req.Error(err)
+			}
+		})
+	}
+}
+
+func Test_writeContainersConfig(t *testing.T) {
+	req := require.New(t)
+
+	server := newTestRegistry()
+	defer server.Close()
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	parentDir, err := ioutil.TempDir("", "kotsadm")
+	req.NoError(err)
+	defer os.RemoveAll(parentDir)
+	configDir := filepath.Join(parentDir, "containers")
+
+	// nothing is written without tls settings
+	sysCtx, err := writeContainersConfig(configDir, []*RegistryTLS{})
+	req.NoError(err)
+	req.Nil(sysCtx)
+	_, err = os.Stat(configDir)
+	req.True(os.IsNotExist(err))
+
+	sysCtx, err = writeContainersConfig(configDir, []*RegistryTLS{
+		{Hostname: "registry.example.com:5000", CACert: caCert},
+		{Hostname: "insecure.example.com", Insecure: true},
+		{Hostname: "..", CACert: caCert, Insecure: true},
+	})
+	req.NoError(err)
+	req.NotNil(sysCtx)
+	req.Equal(filepath.Join(configDir, "certs.d"), sysCtx.DockerPerHostCertDirPath)
+	req.Equal(filepath.Join(configDir, "registries.conf"), sysCtx.SystemRegistriesConfPath)
+
+	writtenCACert, err := ioutil.ReadFile(filepath.Join(configDir, "certs.d", "registry.example.com:5000", "ca.crt"))
+	req.NoError(err)
+	req.Equal(caCert, string(writtenCACert))
+
+	registriesConf, err := ioutil.ReadFile(sysCtx.SystemRegistriesConfPath)
+	req.NoError(err)
+	req.Contains(string(registriesConf), `location = "insecure.example.com"`)
+	req.NotContains(string(registriesConf), `location = ".."`)
+	_, err = os.Stat(filepath.Join(configDir, "ca.crt"))
+	req.True(os.IsNotExist(err))
+
+	// registries that were deleted are removed
+	sysCtx, err = writeContainersConfig(configDir, []*RegistryTLS{
+		{Hostname: "insecure.example.com", Insecure: true},
+	})
+	req.NoError(err)
+	req.NotNil(sysCtx)
+	_, err = os.Stat(filepath.Join(configDir, "certs.d", "registry.example.com:5000"))
+	req.True(os.IsNotExist(err))
+
+	// the parent of the config dir is left alone
+	_, err = os.Stat(parentDir)
+	req.NoError(err)
+}
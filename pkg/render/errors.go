@@ -0,0 +1,49 @@
+package render
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// TemplateError is a template error with the position in the file that caused it
+type TemplateError struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (e *TemplateError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", e.Filename, e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.Filename, e.Line, e.Message)
+}
+
+// parseTemplateError finds the position in a text/template error, these look like
+// "template: name:12: function "foo" not defined" when parsing and
+// "template: name:12:8: executing "name" at <...>: error calling ..." when executing.
+// nil is returned when the error does not come from the template named filename
+func parseTemplateError(filename string, err error) *TemplateError {
+	if err == nil {
+		return nil
+	}
+
+	re := regexp.MustCompile(`template: ` + regexp.QuoteMeta(filename) + `:(\d+)(?::(\d+))?: (.*)`)
+	matches := re.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return nil
+	}
+
+	templateErr := TemplateError{
+		Filename: filename,
+		Message:  matches[3],
+	}
+	templateErr.Line, _ = strconv.Atoi(matches[1])
+	if matches[2] != "" {
+		templateErr.Column, _ = strconv.Atoi(matches[2])
+	}
+
+	return &templateErr
+}
@@ -3,6 +3,7 @@ package render
 import (
 	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -13,10 +14,15 @@ import (
 	"github.com/replicatedhq/kots/pkg/template"
 	"github.com/replicatedhq/kotsadm/pkg/app"
 	"github.com/replicatedhq/kotsadm/pkg/downstream"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
 	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
 	registrytypes "github.com/replicatedhq/kotsadm/pkg/registry/types"
+	"github.com/replicatedhq/kotsadm/pkg/secretprovider"
 )
 
+// MaskedValue replaces secrets in masked renders
+const MaskedValue = "********"
+
 // RenderFile renders a single file
 // this is useful for upstream/kotskinds files that are not rendered in the dir
 func RenderFile(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.RegistrySettings, inputContent []byte) ([]byte, error) {
@@ -25,33 +31,70 @@ func RenderFile(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.R
 		return nil, errors.Wrap(err, "failed to fix up yaml")
 	}
 
-	apiCipher, err := crypto.AESCipherFromString(os.Getenv("API_ENCRYPTION_KEY"))
+	return renderTemplate(kotsKinds, registrySettings, string(inputContent), inputContent, false)
+}
+
+// RenderNamedFile renders a single file as is, without fixing up the yaml first. Template errors are
+// returned as a *TemplateError with the position of the error in inputContent
+func RenderNamedFile(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.RegistrySettings, filename string, inputContent []byte) ([]byte, error) {
+	return renderNamedFile(kotsKinds, registrySettings, filename, inputContent, false)
+}
+
+// RenderNamedFileMasked renders a single file like RenderNamedFile, but password config items and the registry
+// password render as MaskedValue, and secret references are not resolved. The output can't contain secrets
+func RenderNamedFileMasked(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.RegistrySettings, filename string, inputContent []byte) ([]byte, error) {
+	return renderNamedFile(kotsKinds, registrySettings, filename, inputContent, true)
+}
+
+func renderNamedFile(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.RegistrySettings, filename string, inputContent []byte, masked bool) ([]byte, error) {
+	rendered, err := renderTemplate(kotsKinds, registrySettings, filename, inputContent, masked)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to load apiCipher")
+		if templateErr := parseTemplateError(filename, err); templateErr != nil {
+			return nil, templateErr
+		}
+		return nil, err
 	}
 
+	return rendered, nil
+}
+
+func renderTemplate(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.RegistrySettings, name string, inputContent []byte, masked bool) ([]byte, error) {
 	localRegistry := template.LocalRegistry{}
 
 	if registrySettings != nil {
-		decodedPassword, err := base64.StdEncoding.DecodeString(registrySettings.PasswordEnc)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to decode")
-		}
-
-		decryptedPassword, err := apiCipher.Decrypt([]byte(decodedPassword))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to decrypt")
-		}
-
 		localRegistry.Host = registrySettings.Hostname
 		localRegistry.Namespace = registrySettings.Namespace
 		localRegistry.Username = registrySettings.Username
-		localRegistry.Password = string(decryptedPassword)
+
+		if masked {
+			localRegistry.Password = MaskedValue
+		} else {
+			decryptedPassword, err := encryptionkey.Decrypt(registrySettings.PasswordEnc)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to decrypt")
+			}
+			localRegistry.Password = string(decryptedPassword)
+		}
+	}
+
+	appCipher, err := crypto.AESCipherFromString(kotsKinds.Installation.Spec.EncryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load appCipher")
 	}
 
 	templateContextValues := make(map[string]template.ItemValue)
 	if kotsKinds.ConfigValues != nil {
-		for k, v := range kotsKinds.ConfigValues.Spec.Values {
+		var values map[string]kotsv1beta1.ConfigValue
+		if masked {
+			values = maskPasswordValues(kotsKinds.Config, kotsKinds.ConfigValues.Spec.Values, appCipher)
+		} else {
+			values, err = resolveSecretReferences(kotsKinds.Config, kotsKinds.ConfigValues.Spec.Values, appCipher)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to resolve secret references")
+			}
+		}
+
+		for k, v := range values {
 			templateContextValues[k] = template.ItemValue{
 				Value:   v.Value,
 				Default: v.Default,
@@ -59,11 +102,6 @@ func RenderFile(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.R
 		}
 	}
 
-	appCipher, err := crypto.AESCipherFromString(kotsKinds.Installation.Spec.EncryptionKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to load appCipher")
-	}
-
 	configGroups := []kotsv1beta1.ConfigGroup{}
 	if kotsKinds.Config != nil && kotsKinds.Config.Spec.Groups != nil {
 		configGroups = kotsKinds.Config.Spec.Groups
@@ -74,7 +112,7 @@ func RenderFile(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.R
 		return nil, errors.Wrap(err, "failed to create builder")
 	}
 
-	rendered, err := builder.RenderTemplate(string(inputContent), string(inputContent))
+	rendered, err := builder.RenderTemplate(name, string(inputContent))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to render")
 	}
@@ -82,8 +120,140 @@ func RenderFile(kotsKinds *kotsutil.KotsKinds, registrySettings *registrytypes.R
 	return []byte(rendered), nil
 }
 
+// hasSecretReferences returns true if any of the config values references a secret in an external provider
+func hasSecretReferences(config *kotsv1beta1.Config, values map[string]kotsv1beta1.ConfigValue, appCipher *crypto.AESCipher) bool {
+	itemTypes := configItemTypes(config)
+	for name, v := range values {
+		value, _ := decryptedValue(itemTypes[name], v.Value, appCipher)
+		if secretprovider.IsReference(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecretReferences returns a copy of values with the values that reference a secret in an external provider
+// replaced by the secret. Password items are stored encrypted, so references in them are decrypted first and
+// the secret is encrypted again for the template builder. The copy is only used to render, it is never stored
+func resolveSecretReferences(config *kotsv1beta1.Config, values map[string]kotsv1beta1.ConfigValue, appCipher *crypto.AESCipher) (map[string]kotsv1beta1.ConfigValue, error) {
+	itemTypes := configItemTypes(config)
+
+	resolved := map[string]kotsv1beta1.ConfigValue{}
+	for name, v := range values {
+		resolved[name] = v
+
+		value, isEncrypted := decryptedValue(itemTypes[name], v.Value, appCipher)
+		if !secretprovider.IsReference(value) {
+			continue
+		}
+
+		secret, err := secretprovider.Resolve(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve value of %s", name)
+		}
+
+		if isEncrypted {
+			secret = base64.StdEncoding.EncodeToString(appCipher.Encrypt([]byte(secret)))
+		}
+		v.Value = secret
+		resolved[name] = v
+	}
+
+	return resolved, nil
+}
+
+// maskPasswordValues returns a copy of values with the values of password items replaced by MaskedValue,
+// encrypted like the template builder expects password values to be. Secret references are left as they are
+func maskPasswordValues(config *kotsv1beta1.Config, values map[string]kotsv1beta1.ConfigValue, appCipher *crypto.AESCipher) map[string]kotsv1beta1.ConfigValue {
+	itemTypes := configItemTypes(config)
+
+	masked := map[string]kotsv1beta1.ConfigValue{}
+	for name, v := range values {
+		if itemTypes[name] == "password" && v.Value != "" {
+			v.Value = base64.StdEncoding.EncodeToString(appCipher.Encrypt([]byte(MaskedValue)))
+		}
+		masked[name] = v
+	}
+
+	return masked
+}
+
+func configItemTypes(config *kotsv1beta1.Config) map[string]string {
+	itemTypes := map[string]string{}
+	if config == nil {
+		return itemTypes
+	}
+
+	for _, group := range config.Spec.Groups {
+		for _, item := range group.Items {
+			itemTypes[item.Name] = item.Type
+		}
+	}
+	return itemTypes
+}
+
+// decryptedValue returns the value of a config item, decrypted when it's a password. The second return value
+// is true when the value was decrypted
+func decryptedValue(itemType string, value string, appCipher *crypto.AESCipher) (string, bool) {
+	if itemType != "password" || value == "" {
+		return value, false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return value, false
+	}
+	decrypted, err := appCipher.Decrypt(decoded)
+	if err != nil {
+		return value, false
+	}
+	return string(decrypted), true
+}
+
+// RenderDirForDeploy renders an app archive dir with the config values that reference an external secret replaced
+// by the secret, so that the manifests sent to the operator contain the secrets. archiveDir must be a temporary copy
+// of the version, it's never stored. Nothing is rendered again when no config value references a secret
+func RenderDirForDeploy(archiveDir string, appID string, registrySettings *registrytypes.RegistrySettings) error {
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to load kots kinds from path")
+	}
+
+	if kotsKinds.ConfigValues == nil {
+		return nil
+	}
+
+	appCipher, err := crypto.AESCipherFromString(kotsKinds.Installation.Spec.EncryptionKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to load appCipher")
+	}
+
+	if !hasSecretReferences(kotsKinds.Config, kotsKinds.ConfigValues.Spec.Values, appCipher) {
+		return nil
+	}
+
+	values, err := resolveSecretReferences(kotsKinds.Config, kotsKinds.ConfigValues.Spec.Values, appCipher)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve secret references")
+	}
+	kotsKinds.ConfigValues.Spec.Values = values
+
+	configValuesSpec, err := kotsKinds.Marshal("kots.io", "v1beta1", "ConfigValues")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal config values spec")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(archiveDir, "upstream", "userdata", "config.yaml"), []byte(configValuesSpec), 0644); err != nil {
+		return errors.Wrap(err, "failed to write config.yaml to upstream/userdata")
+	}
+
+	return RenderDir(archiveDir, appID, registrySettings)
+}
+
 // RenderDir renders an app archive dir
-// this is useful for when the license/config have updated, and template functions need to be evaluated again
+// this is useful for when the license/config have updated, and template functions need to be evaluated again.
+// the output of RenderDir is stored with the version, so config values that reference an external secret
+// are left as references here. They are resolved by RenderDirForDeploy when the manifests are sent to the operator
 func RenderDir(archiveDir string, appID string, registrySettings *registrytypes.RegistrySettings) error {
 	installation, err := kotsutil.LoadInstallationFromPath(filepath.Join(archiveDir, "upstream", "userdata", "installation.yaml"))
 	if err != nil {
@@ -138,17 +308,7 @@ func RenderDir(archiveDir string, appID string, registrySettings *registrytypes.
 	}
 
 	if registrySettings != nil {
-		cipher, err := crypto.AESCipherFromString(os.Getenv("API_ENCRYPTION_KEY"))
-		if err != nil {
-			return errors.Wrap(err, "failed to create aes cipher")
-		}
-
-		decodedPassword, err := base64.StdEncoding.DecodeString(registrySettings.PasswordEnc)
-		if err != nil {
-			return errors.Wrap(err, "failed to decode")
-		}
-
-		decryptedPassword, err := cipher.Decrypt([]byte(decodedPassword))
+		decryptedPassword, err := encryptionkey.Decrypt(registrySettings.PasswordEnc)
 		if err != nil {
 			return errors.Wrap(err, "failed to decrypt")
 		}
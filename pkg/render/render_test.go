@@ -0,0 +1,122 @@
+package render
+
+import (
+	"encoding/base64"
+	"testing"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/pkg/crypto"
+	"github.com/replicatedhq/kotsadm/pkg/secretprovider"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_resolveSecretReferences(t *testing.T) {
+	req := require.New(t)
+
+	provider := secretprovider.NewMemoryProvider()
+	provider.SetSecret("secret/data/myapp", "api_key", "abc123")
+	provider.SetSecret("secret/data/myapp", "db_password", "hunter2")
+	secretprovider.SetProvider("vault", provider)
+	defer secretprovider.SetProvider("vault", &secretprovider.VaultProvider{})
+
+	appCipher, err := crypto.NewAESCipher()
+	req.NoError(err)
+	encrypt := func(value string) string {
+		return base64.StdEncoding.EncodeToString(appCipher.Encrypt([]byte(value)))
+	}
+
+	config := &kotsv1beta1.Config{
+		Spec: kotsv1beta1.ConfigSpec{
+			Groups: []kotsv1beta1.ConfigGroup{
+				{
+					Name: "settings",
+					Items: []kotsv1beta1.ConfigItem{
+						{Name: "db_host", Type: "text"},
+						{Name: "api_key", Type: "text"},
+						{Name: "db_password", Type: "password"},
+					},
+				},
+			},
+		},
+	}
+
+	plainValues := map[string]kotsv1beta1.ConfigValue{
+		"db_host":     {Value: "postgres"},
+		"db_password": {Value: encrypt("not-a-reference")},
+	}
+	req.False(hasSecretReferences(config, plainValues, appCipher))
+
+	storedPassword := encrypt("vault://secret/data/myapp#db_password")
+	values := map[string]kotsv1beta1.ConfigValue{
+		"db_host":     {Value: "postgres"},
+		"api_key":     {Value: "vault://secret/data/myapp#api_key"},
+		"db_password": {Value: storedPassword},
+	}
+	req.True(hasSecretReferences(config, values, appCipher))
+
+	resolved, err := resolveSecretReferences(config, values, appCipher)
+	req.NoError(err)
+
+	req.Equal("postgres", resolved["db_host"].Value)
+	req.Equal("abc123", resolved["api_key"].Value)
+
+	password, isEncrypted := decryptedValue("password", resolved["db_password"].Value, appCipher)
+	req.True(isEncrypted)
+	req.Equal("hunter2", password)
+
+	// the stored values keep the references
+	req.Equal("vault://secret/data/myapp#api_key", values["api_key"].Value)
+	req.Equal(storedPassword, values["db_password"].Value)
+
+	_, err = resolveSecretReferences(config, map[string]kotsv1beta1.ConfigValue{
+		"api_key": {Value: "vault://secret/data/myapp#missing"},
+	}, appCipher)
+	req.Error(err)
+}
+
+func Test_maskPasswordValues(t *testing.T) {
+	req := require.New(t)
+
+	appCipher, err := crypto.NewAESCipher()
+	req.NoError(err)
+
+	config := &kotsv1beta1.Config{
+		Spec: kotsv1beta1.ConfigSpec{
+			Groups: []kotsv1beta1.ConfigGroup{
+				{
+					Name: "settings",
+					Items: []kotsv1beta1.ConfigItem{
+						{Name: "db_host", Type: "text"},
+						{Name: "db_password", Type: "password"},
+						{Name: "plain_password", Type: "password"},
+						{Name: "empty_password", Type: "password"},
+						{Name: "api_key", Type: "text"},
+					},
+				},
+			},
+		},
+	}
+
+	values := map[string]kotsv1beta1.ConfigValue{
+		"db_host":        {Value: "postgres"},
+		"db_password":    {Value: base64.StdEncoding.EncodeToString(appCipher.Encrypt([]byte("hunter2")))},
+		"plain_password": {Value: "letmein"},
+		"empty_password": {Value: ""},
+		"api_key":        {Value: "vault://secret/data/myapp#api_key"},
+	}
+
+	masked := maskPasswordValues(config, values, appCipher)
+
+	req.Equal("postgres", masked["db_host"].Value)
+	req.Equal("vault://secret/data/myapp#api_key", masked["api_key"].Value)
+	req.Equal("", masked["empty_password"].Value)
+	for _, name := range []string{"db_password", "plain_password"} {
+		value, isEncrypted := decryptedValue("password", masked[name].Value, appCipher)
+		req.True(isEncrypted, name)
+		req.Equal(MaskedValue, value, name)
+	}
+
+	// the values that are stored are not changed
+	req.Equal("letmein", values["plain_password"].Value)
+}
@@ -0,0 +1,71 @@
+package secretprovider
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubernetesProvider reads secrets from Kubernetes Secrets. The path is the name of the secret, optionally
+// prefixed with its namespace. Secrets without a namespace are read from the namespace the app is deployed to.
+// Since secrets are read with the kotsadm service account, only the app and kotsadm namespaces can be read,
+// along with the namespaces in KOTSADM_SECRET_NAMESPACES, separated by commas
+type KubernetesProvider struct{}
+
+func (p *KubernetesProvider) GetSecret(path string, key string) (string, error) {
+	appNamespace := os.Getenv("POD_NAMESPACE")
+	if os.Getenv("KOTSADM_TARGET_NAMESPACE") != "" {
+		appNamespace = os.Getenv("KOTSADM_TARGET_NAMESPACE")
+	}
+
+	namespace, name, err := secretNamespaceAndName(path, appNamespace, os.Getenv("POD_NAMESPACE"), os.Getenv("KOTSADM_SECRET_NAMESPACES"))
+	if err != nil {
+		return "", err
+	}
+
+	clientset, err := k8s.Clientset()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create clientset")
+	}
+
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get secret %s/%s", namespace, name)
+	}
+
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", errors.Errorf("key %q not found in secret %s/%s", key, namespace, name)
+	}
+
+	return string(value), nil
+}
+
+// secretNamespaceAndName splits the path of a reference into the namespace and the name of the secret, and
+// checks that the namespace is one that references may read from
+func secretNamespaceAndName(path string, appNamespace string, kotsadmNamespace string, allowedNamespaces string) (string, string, error) {
+	namespace, name := appNamespace, path
+	if parts := strings.SplitN(path, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	}
+
+	allowed := map[string]bool{
+		appNamespace:     true,
+		kotsadmNamespace: true,
+	}
+	for _, allowedNamespace := range strings.Split(allowedNamespaces, ",") {
+		allowedNamespace = strings.TrimSpace(allowedNamespace)
+		if allowedNamespace != "" {
+			allowed[allowedNamespace] = true
+		}
+	}
+
+	if namespace == "" || !allowed[namespace] {
+		return "", "", errors.Errorf("secrets in namespace %q can't be referenced", namespace)
+	}
+
+	return namespace, name, nil
+}
@@ -0,0 +1,69 @@
+package secretprovider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// MemoryProvider holds secrets in memory, keyed by path and then key
+type MemoryProvider struct {
+	mtx     sync.Mutex
+	secrets map[string]map[string]string
+}
+
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{
+		secrets: map[string]map[string]string{},
+	}
+}
+
+func (p *MemoryProvider) SetSecret(path string, key string, value string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if _, ok := p.secrets[path]; !ok {
+		p.secrets[path] = map[string]string{}
+	}
+	p.secrets[path][key] = value
+}
+
+func (p *MemoryProvider) GetSecret(path string, key string) (string, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	value, ok := p.secrets[path][key]
+	if !ok {
+		return "", errors.Errorf("key %q not found in secret %q", key, path)
+	}
+
+	return value, nil
+}
+
+// FileProvider reads secrets from files on disk, laid out as <Dir>/<path>/<key>.
+// This is the same layout as a mounted Kubernetes Secret or the vault agent injector
+type FileProvider struct {
+	Dir string
+}
+
+func (p *FileProvider) GetSecret(path string, key string) (string, error) {
+	filename := filepath.Join(p.Dir, filepath.FromSlash(path), key)
+	relPath, err := filepath.Rel(p.Dir, filename)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return "", errors.Errorf("secret %q is outside of the secrets dir", path)
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.Errorf("key %q not found in secret %q", key, path)
+		}
+		return "", errors.Wrap(err, "failed to read secret file")
+	}
+
+	return string(content), nil
+}
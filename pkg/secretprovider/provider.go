@@ -0,0 +1,104 @@
+package secretprovider
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Provider reads secrets from an external store
+type Provider interface {
+	// GetSecret returns the value of key in the secret at path
+	GetSecret(path string, key string) (string, error)
+}
+
+// Reference points to a key in a secret held by a provider, for example
+//
+//	vault://secret/data/myapp#db_password
+//	k8s://myapp-secrets#db_password
+//	k8s://other-namespace/myapp-secrets#db_password
+type Reference struct {
+	Scheme string
+	Path   string
+	Key    string
+}
+
+func (r Reference) String() string {
+	return r.Scheme + "://" + r.Path + "#" + r.Key
+}
+
+var (
+	providersMtx sync.Mutex
+	providers    = map[string]Provider{
+		"vault": &VaultProvider{},
+		"k8s":   &KubernetesProvider{},
+	}
+)
+
+// SetProvider replaces the provider used to resolve references with scheme. This is how a file backed or
+// in-memory provider is put in place of vault or kubernetes
+func SetProvider(scheme string, provider Provider) {
+	providersMtx.Lock()
+	defer providersMtx.Unlock()
+
+	providers[scheme] = provider
+}
+
+func getProvider(scheme string) (Provider, bool) {
+	providersMtx.Lock()
+	defer providersMtx.Unlock()
+
+	provider, ok := providers[scheme]
+	return provider, ok
+}
+
+// IsReference returns true if value looks like a reference to a secret of one of the known providers
+func IsReference(value string) bool {
+	parts := strings.SplitN(value, "://", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	_, ok := getProvider(parts[0])
+	return ok
+}
+
+// ParseReference parses a reference in the form <scheme>://<path>#<key>
+func ParseReference(value string) (*Reference, error) {
+	parts := strings.SplitN(value, "://", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("reference does not have a scheme")
+	}
+
+	pathAndKey := strings.SplitN(parts[1], "#", 2)
+	if len(pathAndKey) != 2 || pathAndKey[0] == "" || pathAndKey[1] == "" {
+		return nil, errors.Errorf("reference %q must be in the form %s://<path>#<key>", value, parts[0])
+	}
+
+	return &Reference{
+		Scheme: parts[0],
+		Path:   strings.Trim(pathAndKey[0], "/"),
+		Key:    pathAndKey[1],
+	}, nil
+}
+
+// Resolve returns the secret that value references, or value itself when it's not a reference
+func Resolve(value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+
+	ref, err := ParseReference(value)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse reference")
+	}
+
+	provider, _ := getProvider(ref.Scheme)
+	secret, err := provider.GetSecret(ref.Path, ref.Key)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get secret %s", ref.String())
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,163 @@
+package secretprovider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_ParseReference(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    *Reference
+		expectError bool
+	}{
+		{
+			name:     "vault kv2",
+			value:    "vault://secret/data/myapp#db_password",
+			expected: &Reference{Scheme: "vault", Path: "secret/data/myapp", Key: "db_password"},
+		},
+		{
+			name:     "kubernetes secret in another namespace",
+			value:    "k8s://other/myapp-secrets#password",
+			expected: &Reference{Scheme: "k8s", Path: "other/myapp-secrets", Key: "password"},
+		},
+		{
+			name:        "missing key",
+			value:       "vault://secret/data/myapp",
+			expectError: true,
+		},
+		{
+			name:        "not a reference",
+			value:       "hunter2",
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			ref, err := ParseReference(test.value)
+			if test.expectError {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			req.Equal(test.expected, ref)
+		})
+	}
+}
+
+func Test_Resolve(t *testing.T) {
+	req := require.New(t)
+
+	memoryProvider := NewMemoryProvider()
+	memoryProvider.SetSecret("secret/data/myapp", "db_password", "hunter2")
+	SetProvider("vault", memoryProvider)
+	defer SetProvider("vault", &VaultProvider{})
+
+	dir, err := ioutil.TempDir("", "secretprovider")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+	req.NoError(os.MkdirAll(filepath.Join(dir, "myapp-secrets"), 0755))
+	req.NoError(ioutil.WriteFile(filepath.Join(dir, "myapp-secrets", "token"), []byte("abc123"), 0644))
+	SetProvider("k8s", &FileProvider{Dir: dir})
+	defer SetProvider("k8s", &KubernetesProvider{})
+
+	value, err := Resolve("vault://secret/data/myapp#db_password")
+	req.NoError(err)
+	req.Equal("hunter2", value)
+
+	value, err = Resolve("k8s://myapp-secrets#token")
+	req.NoError(err)
+	req.Equal("abc123", value)
+
+	value, err = Resolve("not a reference")
+	req.NoError(err)
+	req.Equal("not a reference", value)
+
+	_, err = Resolve("vault://secret/data/myapp#missing")
+	req.Error(err)
+
+	_, err = Resolve("k8s://../../etc#passwd")
+	req.Error(err)
+}
+
+func Test_secretNamespaceAndName(t *testing.T) {
+	tests := []struct {
+		name              string
+		path              string
+		allowedNamespaces string
+		expectedNamespace string
+		expectedName      string
+		expectError       bool
+	}{
+		{
+			name:              "app namespace by default",
+			path:              "myapp-secrets",
+			expectedNamespace: "app",
+			expectedName:      "myapp-secrets",
+		},
+		{
+			name:              "kotsadm namespace",
+			path:              "kotsadm/myapp-secrets",
+			expectedNamespace: "kotsadm",
+			expectedName:      "myapp-secrets",
+		},
+		{
+			name:              "allowed namespace",
+			path:              "shared/myapp-secrets",
+			allowedNamespaces: "other, shared",
+			expectedNamespace: "shared",
+			expectedName:      "myapp-secrets",
+		},
+		{
+			name:        "other namespace",
+			path:        "kube-system/bootstrap-token",
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			namespace, name, err := secretNamespaceAndName(test.path, "app", "kotsadm", test.allowedNamespaces)
+			if test.expectError {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			req.Equal(test.expectedNamespace, namespace)
+			req.Equal(test.expectedName, name)
+		})
+	}
+}
+
+func Test_VaultProviderTimeout(t *testing.T) {
+	req := require.New(t)
+
+	done := make(chan struct{})
+	defer close(done)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	provider := &VaultProvider{Address: server.URL, Token: "token", Timeout: 100 * time.Millisecond}
+
+	started := time.Now()
+	_, err := provider.GetSecret("secret/data/myapp", "db_password")
+	req.Error(err)
+	req.True(time.Since(started) < 5*time.Second)
+}
@@ -0,0 +1,100 @@
+package secretprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VaultProvider reads secrets from the Vault KV secrets engine, both version 1 and version 2 mounts
+// are supported. Address and Token default to the VAULT_ADDR and VAULT_TOKEN environment variables
+type VaultProvider struct {
+	Address string
+	Token   string
+	// Timeout limits each request to vault, so that an unreachable vault doesn't hang renders. Defaults to 10 seconds
+	Timeout time.Duration
+}
+
+const defaultVaultTimeout = 10 * time.Second
+
+type vaultSecretResponse struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+func (p *VaultProvider) GetSecret(path string, key string) (string, error) {
+	address := p.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return "", errors.New("vault address is not configured")
+	}
+
+	token := p.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = defaultVaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimSuffix(address, "/"), path)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to call newrequest")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Vault-Token", token)
+
+	client := &http.Client{
+		Timeout: timeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to execute get request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", errors.Errorf("unexpected status code %d from vault", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read response")
+	}
+
+	secretResponse := vaultSecretResponse{}
+	if err := json.Unmarshal(body, &secretResponse); err != nil {
+		return "", errors.Wrap(err, "failed to unmarshal response")
+	}
+
+	data := secretResponse.Data
+	// kv version 2 nests the secret data, along with metadata about the secret
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nested
+		}
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", errors.Errorf("key %q not found in secret", key)
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
@@ -22,6 +22,7 @@ import (
 
 type Session struct {
 	ID        string
+	UserID    string
 	CreatedAt time.Time
 	ExpiresAt time.Time
 }
@@ -94,6 +95,7 @@ func Parse(signedToken string) (*Session, error) {
 
 		s := Session{
 			ID:        "kots-cli",
+			UserID:    "kots-cli",
 			CreatedAt: time.Now(),
 			ExpiresAt: time.Now().Add(time.Minute),
 		}
@@ -126,12 +128,12 @@ func get(id string) (*Session, error) {
 		zap.String("id", id))
 
 	db := persistence.MustGetPGSession()
-	query := `select id, expire_at from session where id = $1`
+	query := `select id, user_id, expire_at from session where id = $1`
 	row := db.QueryRow(query, id)
 	session := Session{}
 
 	var expiresAt time.Time
-	if err := row.Scan(&session.ID, &expiresAt); err != nil {
+	if err := row.Scan(&session.ID, &session.UserID, &expiresAt); err != nil {
 		return nil, errors.Wrap(err, "failed to get session")
 	}
 
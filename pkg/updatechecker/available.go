@@ -0,0 +1,215 @@
+package updatechecker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	kotsupstream "github.com/replicatedhq/kots/pkg/upstream"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/task"
+	"github.com/replicatedhq/kotsadm/pkg/upstream"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+)
+
+// AvailableUpdate is a release on the channel of the license that is newer than the installed cursor
+type AvailableUpdate struct {
+	Cursor       string `json:"cursor"`
+	VersionLabel string `json:"versionLabel"`
+	ReleaseNotes string `json:"releaseNotes"`
+	CreatedAt    string `json:"createdAt,omitempty"`
+}
+
+// pendingChannelRelease is a release in the response of the pending releases endpoint of the vendor api,
+// which is also what kotspull.GetUpdates lists the updates from
+type pendingChannelRelease struct {
+	ChannelSequence int    `json:"channelSequence"`
+	VersionLabel    string `json:"versionLabel"`
+	ReleaseNotes    string `json:"releaseNotes"`
+	CreatedAt       string `json:"createdAt"`
+}
+
+type pendingChannelReleasesResponse struct {
+	ChannelReleases []pendingChannelRelease `json:"channelReleases"`
+}
+
+const releaseNotesTimeout = 30 * time.Second
+
+// ListAvailableUpdates returns the pending releases for an app, oldest first, without downloading any of them
+func ListAvailableUpdates(appID string) ([]AvailableUpdate, error) {
+	a, err := app.Get(appID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get app")
+	}
+	if a.IsAirgap {
+		return nil, errors.New("airgap apps are updated by uploading a bundle")
+	}
+
+	archiveDir, err := version.GetAppVersionArchive(a.ID, a.CurrentSequence)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get app version archive")
+	}
+	defer os.RemoveAll(archiveDir)
+
+	updates, err := getUpdates(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get updates")
+	}
+
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load kotskinds")
+	}
+
+	// the updates are listed without release notes when they can't be fetched, since they can still be downloaded
+	releases, err := listPendingReleases(kotsKinds.License, kotsKinds.Installation.Spec.UpdateCursor)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "failed to list release notes"))
+	}
+
+	return availableUpdatesFromUpstream(updates, releases), nil
+}
+
+// listPendingReleases returns the releases after currentCursor from the vendor api, keyed by cursor. kotspull.GetUpdates
+// lists the updates from the same endpoint, but drops the release notes
+func listPendingReleases(license *kotsv1beta1.License, currentCursor string) (map[string]pendingChannelRelease, error) {
+	if license == nil {
+		return nil, errors.New("app does not have a license")
+	}
+
+	urlValues := url.Values{}
+	urlValues.Set("channelSequence", currentCursor)
+	urlValues.Set("licenseSequence", strconv.FormatInt(license.Spec.LicenseSequence, 10))
+	pendingURL := fmt.Sprintf("%s/release/%s/pending?%s", license.Spec.Endpoint, license.Spec.AppSlug, urlValues.Encode())
+
+	req, err := http.NewRequest("GET", pendingURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", license.Spec.LicenseID, license.Spec.LicenseID)))
+	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", auth))
+
+	client := &http.Client{
+		Timeout: releaseNotesTimeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pending releases")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected result from get request: %d, data: %s", resp.StatusCode, body)
+	}
+
+	pendingReleases := pendingChannelReleasesResponse{}
+	if err := json.Unmarshal(body, &pendingReleases); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal pending releases")
+	}
+
+	releases := map[string]pendingChannelRelease{}
+	for _, release := range pendingReleases.ChannelReleases {
+		releases[strconv.Itoa(release.ChannelSequence)] = release
+	}
+
+	return releases, nil
+}
+
+// DownloadAvailableUpdate starts downloading the release at cursor in the background, creating a single version.
+// The progress is reported in the update-download task
+func DownloadAvailableUpdate(appID string, cursor string) error {
+	currentStatus, err := task.GetTaskStatus("update-download")
+	if err != nil {
+		return errors.Wrap(err, "failed to get task status")
+	}
+	if currentStatus == "running" {
+		return errors.New("an update is already being downloaded")
+	}
+
+	availableUpdates, err := ListAvailableUpdates(appID)
+	if err != nil {
+		return errors.Wrap(err, "failed to list available updates")
+	}
+
+	if findAvailableUpdate(availableUpdates, cursor) == nil {
+		return errors.Errorf("cursor %s is not an available update", cursor)
+	}
+
+	a, err := app.Get(appID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get app")
+	}
+
+	archiveDir, err := version.GetAppVersionArchive(a.ID, a.CurrentSequence)
+	if err != nil {
+		return errors.Wrap(err, "failed to get app version archive")
+	}
+
+	if err := task.SetTaskStatus("update-download", "Downloading release...", "running"); err != nil {
+		os.RemoveAll(archiveDir)
+		return errors.Wrap(err, "failed to set task status")
+	}
+
+	go func() {
+		defer os.RemoveAll(archiveDir)
+		if err := upstream.DownloadUpdate(a.ID, archiveDir, cursor); err != nil {
+			logger.Error(err)
+		}
+	}()
+
+	return nil
+}
+
+// availableUpdatesFromUpstream returns the updates that kotspull listed, with the release notes of the
+// pending releases that have the same cursor
+func availableUpdatesFromUpstream(updates []kotsupstream.Update, releases map[string]pendingChannelRelease) []AvailableUpdate {
+	availableUpdates := []AvailableUpdate{}
+	for _, update := range updates {
+		availableUpdate := AvailableUpdate{
+			Cursor:       update.Cursor,
+			VersionLabel: update.VersionLabel,
+		}
+		if release, ok := releases[update.Cursor]; ok {
+			availableUpdate.ReleaseNotes = release.ReleaseNotes
+			availableUpdate.CreatedAt = release.CreatedAt
+		}
+		availableUpdates = append(availableUpdates, availableUpdate)
+	}
+	return availableUpdates
+}
+
+func findAvailableUpdate(availableUpdates []AvailableUpdate, cursor string) *AvailableUpdate {
+	for _, availableUpdate := range availableUpdates {
+		if availableUpdate.Cursor == cursor {
+			return &availableUpdate
+		}
+	}
+	return nil
+}
+
+// cursorsToDownload returns the cursors that an update check downloads. When the admin selects the
+// updates to download, the check only lists them
+func cursorsToDownload(updates []kotsupstream.Update, selectUpdates bool) []string {
+	cursors := []string{}
+	if selectUpdates {
+		return cursors
+	}
+	for _, update := range updates {
+		cursors = append(cursors, update.Cursor)
+	}
+	return cursors
+}
@@ -0,0 +1,145 @@
+package updatechecker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	kotsupstream "github.com/replicatedhq/kots/pkg/upstream"
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_availableUpdatesFromUpstream(t *testing.T) {
+	req := require.New(t)
+
+	req.Equal([]AvailableUpdate{}, availableUpdatesFromUpstream(nil, nil))
+
+	updates := []kotsupstream.Update{
+		{Cursor: "12", VersionLabel: "1.0.1"},
+		{Cursor: "14", VersionLabel: "1.1.0"},
+	}
+	req.Equal([]AvailableUpdate{
+		{Cursor: "12", VersionLabel: "1.0.1"},
+		{Cursor: "14", VersionLabel: "1.1.0"},
+	}, availableUpdatesFromUpstream(updates, nil))
+
+	releases := map[string]pendingChannelRelease{
+		"14": {ChannelSequence: 14, VersionLabel: "1.1.0", ReleaseNotes: "adds sso", CreatedAt: "2020-06-01T00:00:00Z"},
+	}
+	req.Equal([]AvailableUpdate{
+		{Cursor: "12", VersionLabel: "1.0.1"},
+		{Cursor: "14", VersionLabel: "1.1.0", ReleaseNotes: "adds sso", CreatedAt: "2020-06-01T00:00:00Z"},
+	}, availableUpdatesFromUpstream(updates, releases))
+}
+
+func Test_listPendingReleases(t *testing.T) {
+	req := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/release/my-app/pending" || r.URL.Query().Get("channelSequence") != "10" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write([]byte(`{"channelReleases":[{"channelSequence":12,"versionLabel":"1.0.1","releaseNotes":"fixes a bug"},{"channelSequence":14,"versionLabel":"1.1.0","releaseNotes":"adds sso"}]}`))
+	}))
+	defer server.Close()
+
+	license := &kotsv1beta1.License{
+		Spec: kotsv1beta1.LicenseSpec{
+			Endpoint:  server.URL,
+			AppSlug:   "my-app",
+			LicenseID: "license-id",
+		},
+	}
+
+	releases, err := listPendingReleases(license, "10")
+	req.NoError(err)
+	req.Equal("fixes a bug", releases["12"].ReleaseNotes)
+	req.Equal("adds sso", releases["14"].ReleaseNotes)
+
+	_, err = listPendingReleases(license, "11")
+	req.Error(err)
+}
+
+func Test_findAvailableUpdate(t *testing.T) {
+	availableUpdates := []AvailableUpdate{
+		{Cursor: "12", VersionLabel: "1.0.1"},
+		{Cursor: "14", VersionLabel: "1.1.0"},
+	}
+
+	tests := []struct {
+		name     string
+		cursor   string
+		expected *AvailableUpdate
+	}{
+		{
+			name:     "first update",
+			cursor:   "12",
+			expected: &AvailableUpdate{Cursor: "12", VersionLabel: "1.0.1"},
+		},
+		{
+			name:     "latest update",
+			cursor:   "14",
+			expected: &AvailableUpdate{Cursor: "14", VersionLabel: "1.1.0"},
+		},
+		{
+			name:     "not an available update",
+			cursor:   "13",
+			expected: nil,
+		},
+		{
+			name:     "empty cursor",
+			cursor:   "",
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			req.Equal(test.expected, findAvailableUpdate(availableUpdates, test.cursor))
+		})
+	}
+}
+
+func Test_cursorsToDownload(t *testing.T) {
+	updates := []kotsupstream.Update{
+		{Cursor: "12", VersionLabel: "1.0.1"},
+		{Cursor: "14", VersionLabel: "1.1.0"},
+	}
+
+	tests := []struct {
+		name          string
+		updates       []kotsupstream.Update
+		selectUpdates bool
+		expected      []string
+	}{
+		{
+			name:          "downloads every update",
+			updates:       updates,
+			selectUpdates: false,
+			expected:      []string{"12", "14"},
+		},
+		{
+			name:          "lists only when the admin selects updates",
+			updates:       updates,
+			selectUpdates: true,
+			expected:      []string{},
+		},
+		{
+			name:          "no updates",
+			updates:       nil,
+			selectUpdates: false,
+			expected:      []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			req.Equal(test.expected, cursorsToDownload(test.updates, test.selectUpdates))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package updatechecker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule is a parsed cron expression with the standard five fields: minute, hour, day of month,
+// month and day of week. Each field accepts *, numbers, ranges (1-5), steps (*/15, 0-30/10) and lists of
+// these separated by commas. The @hourly, @daily, @weekly and @monthly shorthands are accepted too.
+type Schedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+
+	// cron matches either the day of month or the day of week when both are restricted. Like vixie cron,
+	// a field that starts with *, such as */2, counts as unrestricted
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func ParseCron(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if shorthand, ok := cronShorthands[expr]; ok {
+		expr = shorthand
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("expected 5 fields in cron expression, found %d", len(fields))
+	}
+
+	schedule := Schedule{
+		anyDayOfMonth: strings.HasPrefix(fields[2], "*"),
+		anyDayOfWeek:  strings.HasPrefix(fields[4], "*"),
+	}
+
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, errors.Wrap(err, "invalid minute")
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, errors.Wrap(err, "invalid hour")
+	}
+	if schedule.daysOfMonth, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, errors.Wrap(err, "invalid day of month")
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, errors.Wrap(err, "invalid month")
+	}
+	if schedule.daysOfWeek, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, errors.Wrap(err, "invalid day of week")
+	}
+	// both 0 and 7 are sunday
+	if schedule.daysOfWeek[7] {
+		schedule.daysOfWeek[0] = true
+	}
+
+	return &schedule, nil
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, errors.Errorf("invalid step in %q", part)
+			}
+			step = s
+			part = part[:i]
+		}
+
+		start, end := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, errors.Errorf("invalid range %q", part)
+			}
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, errors.Errorf("invalid range %q", part)
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, errors.Errorf("invalid value %q", part)
+			}
+			start = value
+			if step == 1 {
+				end = value
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return nil, errors.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+
+	return values, nil
+}
+
+// Next returns the first time after t that matches the schedule, in the location of t
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// every matching time is within a few years, this bounds the search for schedules like 30 feb
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !s.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.daysOfMonth[t.Day()]
+	dayOfWeek := s.daysOfWeek[int(t.Weekday())]
+
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
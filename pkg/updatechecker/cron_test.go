@@ -0,0 +1,82 @@
+package updatechecker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	_ "go.undefinedlabs.com/scopeagent/autoinstrument"
+)
+
+func Test_ScheduleNext(t *testing.T) {
+	// a monday
+	from := time.Date(2020, 6, 1, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected time.Time
+	}{
+		{
+			name:     "every 15 minutes",
+			expr:     "*/15 * * * *",
+			expected: time.Date(2020, 6, 1, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily shorthand",
+			expr:     "@daily",
+			expected: time.Date(2020, 6, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekdays at 2am",
+			expr:     "0 2 * * 1-5",
+			expected: time.Date(2020, 6, 2, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "sundays as 7",
+			expr:     "30 4 * * 7",
+			expected: time.Date(2020, 6, 7, 4, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "first of the month or fridays",
+			expr:     "0 0 1 * 5",
+			expected: time.Date(2020, 6, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "odd days of the month that are mondays",
+			expr:     "0 0 */2 * 1",
+			expected: time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "first of the month on even days of the week",
+			expr:     "0 0 1 * */2",
+			expected: time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "list of hours",
+			expr:     "0 6,18 * * *",
+			expected: time.Date(2020, 6, 1, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "next year",
+			expr:     "0 0 1 1 *",
+			expected: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			schedule, err := ParseCron(test.expr)
+			req.NoError(err)
+			req.Equal(test.expected, schedule.Next(from))
+		})
+	}
+}
+
+func Test_ParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseCron(expr)
+		require.Error(t, err, expr)
+	}
+}
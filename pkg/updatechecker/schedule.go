@@ -0,0 +1,129 @@
+package updatechecker
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/persistence"
+)
+
+// UpdateCheckSchedule is when updates are checked for an app, and the result of the last check.
+// Cron expressions are evaluated in UTC. An empty schedule disables scheduled checks.
+// When SelectUpdates is set, checks only list the available updates and the admin picks the ones to download
+type UpdateCheckSchedule struct {
+	AppID                string     `json:"appId"`
+	Schedule             string     `json:"schedule"`
+	JitterSeconds        int64      `json:"jitterSeconds"`
+	SelectUpdates        bool       `json:"selectUpdates"`
+	LastCheckedAt        *time.Time `json:"lastCheckedAt,omitempty"`
+	LastAvailableUpdates int64      `json:"lastAvailableUpdates"`
+	LastError            string     `json:"lastError,omitempty"`
+}
+
+// GetSchedule returns the update check schedule of an app. Apps that were never configured have an empty schedule
+func GetSchedule(appID string) (*UpdateCheckSchedule, error) {
+	db := persistence.MustGetPGSession()
+	query := `select schedule, jitter_seconds, select_updates, last_checked_at, last_available_updates, last_error
+from app_update_check_schedule where app_id = $1`
+	row := db.QueryRow(query, appID)
+
+	var schedule sql.NullString
+	var jitterSeconds sql.NullInt64
+	var selectUpdates sql.NullBool
+	var lastCheckedAt sql.NullTime
+	var lastAvailableUpdates sql.NullInt64
+	var lastError sql.NullString
+	if err := row.Scan(&schedule, &jitterSeconds, &selectUpdates, &lastCheckedAt, &lastAvailableUpdates, &lastError); err != nil {
+		if err == sql.ErrNoRows {
+			return &UpdateCheckSchedule{AppID: appID}, nil
+		}
+		return nil, errors.Wrap(err, "failed to scan update check schedule")
+	}
+
+	updateCheckSchedule := UpdateCheckSchedule{
+		AppID:                appID,
+		Schedule:             schedule.String,
+		JitterSeconds:        jitterSeconds.Int64,
+		SelectUpdates:        selectUpdates.Bool,
+		LastAvailableUpdates: lastAvailableUpdates.Int64,
+		LastError:            lastError.String,
+	}
+	if lastCheckedAt.Valid {
+		updateCheckSchedule.LastCheckedAt = &lastCheckedAt.Time
+	}
+
+	return &updateCheckSchedule, nil
+}
+
+// ListSchedules returns the update check schedules of every app that has one
+func ListSchedules() ([]*UpdateCheckSchedule, error) {
+	db := persistence.MustGetPGSession()
+	query := `select app_id from app_update_check_schedule where schedule is not null and schedule != ''`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query update check schedules")
+	}
+	defer rows.Close()
+
+	appIDs := []string{}
+	for rows.Next() {
+		var appID string
+		if err := rows.Scan(&appID); err != nil {
+			return nil, errors.Wrap(err, "failed to scan app id")
+		}
+		appIDs = append(appIDs, appID)
+	}
+
+	schedules := []*UpdateCheckSchedule{}
+	for _, appID := range appIDs {
+		schedule, err := GetSchedule(appID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get update check schedule for app %s", appID)
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+// SetSchedule validates and stores the update check schedule of an app
+func SetSchedule(appID string, schedule string, jitterSeconds int64, selectUpdates bool) error {
+	if schedule != "" {
+		if _, err := ParseCron(schedule); err != nil {
+			return errors.Wrap(err, "failed to parse schedule")
+		}
+	}
+	if jitterSeconds < 0 {
+		return errors.New("jitter must not be negative")
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `insert into app_update_check_schedule (app_id, schedule, jitter_seconds, select_updates, updated_at) values ($1, $2, $3, $4, $5)
+on conflict(app_id) do update set schedule = EXCLUDED.schedule, jitter_seconds = EXCLUDED.jitter_seconds,
+select_updates = EXCLUDED.select_updates, updated_at = EXCLUDED.updated_at`
+	_, err := db.Exec(query, appID, schedule, jitterSeconds, selectUpdates, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "failed to set update check schedule")
+	}
+
+	return nil
+}
+
+func setLastCheckResult(appID string, availableUpdates int64, checkErr error) error {
+	lastError := ""
+	if checkErr != nil {
+		lastError = errors.Cause(checkErr).Error()
+	}
+
+	db := persistence.MustGetPGSession()
+	query := `insert into app_update_check_schedule (app_id, last_checked_at, last_available_updates, last_error, updated_at) values ($1, $2, $3, $4, $2)
+on conflict(app_id) do update set last_checked_at = EXCLUDED.last_checked_at, last_available_updates = EXCLUDED.last_available_updates,
+last_error = EXCLUDED.last_error, updated_at = EXCLUDED.updated_at`
+	_, err := db.Exec(query, appID, time.Now(), availableUpdates, lastError)
+	if err != nil {
+		return errors.Wrap(err, "failed to set last update check result")
+	}
+
+	return nil
+}
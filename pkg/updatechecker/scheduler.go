@@ -0,0 +1,152 @@
+package updatechecker
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+)
+
+const schedulerInterval = time.Minute
+
+type scheduledCheck struct {
+	schedule      string
+	jitterSeconds int64
+	nextCheckAt   time.Time
+}
+
+var (
+	scheduledChecks   = map[string]*scheduledCheck{}
+	runningChecks     = map[string]bool{}
+	scheduledChecksMu sync.Mutex
+)
+
+// StartScheduler checks for updates in the background for every online app that has an update check schedule.
+// A random delay of up to the jitter of the app is added to every check, so that many installations on the same
+// schedule don't all reach the vendor at the same time
+func StartScheduler() {
+	go func() {
+		for {
+			runScheduledChecks(time.Now())
+			time.Sleep(schedulerInterval)
+		}
+	}()
+}
+
+// NextCheckAt returns when the next scheduled check of an app will run, or nil if it has no schedule
+func NextCheckAt(appID string) *time.Time {
+	scheduledChecksMu.Lock()
+	defer scheduledChecksMu.Unlock()
+
+	check, ok := scheduledChecks[appID]
+	if !ok {
+		return nil
+	}
+	nextCheckAt := check.nextCheckAt
+	return &nextCheckAt
+}
+
+func runScheduledChecks(now time.Time) {
+	schedules, err := ListSchedules()
+	if err != nil {
+		logger.Error(errors.Wrap(err, "failed to list update check schedules"))
+		return
+	}
+
+	scheduledChecksMu.Lock()
+	defer scheduledChecksMu.Unlock()
+
+	current := map[string]bool{}
+	for _, s := range schedules {
+		current[s.AppID] = true
+
+		check, ok := scheduledChecks[s.AppID]
+		if !ok || check.schedule != s.Schedule || check.jitterSeconds != s.JitterSeconds {
+			nextCheckAt, err := nextScheduledCheck(s.Schedule, s.JitterSeconds, now)
+			if err != nil {
+				logger.Error(errors.Wrapf(err, "failed to schedule update check for app %s", s.AppID))
+				delete(scheduledChecks, s.AppID)
+				continue
+			}
+			scheduledChecks[s.AppID] = &scheduledCheck{
+				schedule:      s.Schedule,
+				jitterSeconds: s.JitterSeconds,
+				nextCheckAt:   nextCheckAt,
+			}
+			continue
+		}
+
+		if now.Before(check.nextCheckAt) {
+			continue
+		}
+
+		nextCheckAt, err := nextScheduledCheck(s.Schedule, s.JitterSeconds, now)
+		if err != nil {
+			logger.Error(errors.Wrapf(err, "failed to schedule update check for app %s", s.AppID))
+			continue
+		}
+		check.nextCheckAt = nextCheckAt
+
+		if runningChecks[s.AppID] {
+			logger.Debugf("update check for app %s is still running, skipping", s.AppID)
+			continue
+		}
+		runningChecks[s.AppID] = true
+		go runScheduledCheck(s.AppID)
+	}
+
+	// schedules that were removed
+	for appID := range scheduledChecks {
+		if !current[appID] {
+			delete(scheduledChecks, appID)
+		}
+	}
+}
+
+func runScheduledCheck(appID string) {
+	defer func() {
+		scheduledChecksMu.Lock()
+		delete(runningChecks, appID)
+		scheduledChecksMu.Unlock()
+	}()
+
+	a, err := app.Get(appID)
+	if err != nil {
+		logger.Error(errors.Wrapf(err, "failed to get app %s for scheduled update check", appID))
+		return
+	}
+
+	// airgap apps are updated by uploading a bundle
+	if a.IsAirgap {
+		return
+	}
+
+	availableUpdates, err := CheckForUpdates(appID)
+	if err != nil {
+		logger.Error(errors.Wrapf(err, "failed to check for updates for app %s", a.Slug))
+		return
+	}
+
+	logger.Debugf("scheduled update check for app %s found %d updates", a.Slug, availableUpdates)
+}
+
+func nextScheduledCheck(schedule string, jitterSeconds int64, now time.Time) (time.Time, error) {
+	cronSchedule, err := ParseCron(schedule)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse schedule")
+	}
+
+	next := cronSchedule.Next(now.UTC())
+	if next.IsZero() {
+		return time.Time{}, errors.Errorf("schedule %q never runs", schedule)
+	}
+
+	if jitterSeconds > 0 {
+		next = next.Add(time.Duration(rand.Int63n(jitterSeconds)) * time.Second)
+	}
+
+	return next, nil
+}
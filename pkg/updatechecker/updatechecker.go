@@ -0,0 +1,132 @@
+package updatechecker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	kotspull "github.com/replicatedhq/kots/pkg/pull"
+	kotsupstream "github.com/replicatedhq/kots/pkg/upstream"
+	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
+	"github.com/replicatedhq/kotsadm/pkg/license"
+	"github.com/replicatedhq/kotsadm/pkg/logger"
+	"github.com/replicatedhq/kotsadm/pkg/task"
+	"github.com/replicatedhq/kotsadm/pkg/upstream"
+	"github.com/replicatedhq/kotsadm/pkg/version"
+)
+
+// CheckForUpdates syncs the license, checks the upstream for updates and starts downloading them in the
+// background, unless the admin selects the updates to download. It returns the number of available updates,
+// which is 0 when a download is already running.
+// The result is recorded as the last update check of the app
+func CheckForUpdates(appID string) (int64, error) {
+	availableUpdates, err := checkForUpdates(appID)
+	if recordErr := setLastCheckResult(appID, availableUpdates, err); recordErr != nil {
+		logger.Error(errors.Wrap(recordErr, "failed to record update check result"))
+	}
+	return availableUpdates, err
+}
+
+func checkForUpdates(appID string) (int64, error) {
+	currentStatus, err := task.GetTaskStatus("update-download")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get task status")
+	}
+
+	if currentStatus == "running" {
+		logger.Debug("update-download is already running, not starting a new one")
+		return 0, nil
+	}
+
+	if err := task.ClearTaskStatus("update-download"); err != nil {
+		return 0, errors.Wrap(err, "failed to clear task status")
+	}
+
+	foundApp, err := app.Get(appID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get app")
+	}
+
+	// sync license, this method is only called when online
+	_, err = license.Sync(foundApp, "")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to sync license")
+	}
+
+	// reload app because license sync could have created a new release
+	foundApp, err = app.Get(foundApp.ID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to reload app")
+	}
+
+	// download the app
+	archiveDir, err := version.GetAppVersionArchive(foundApp.ID, foundApp.CurrentSequence)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get app version archive")
+	}
+
+	updates, err := getUpdates(archiveDir)
+	if err != nil {
+		os.RemoveAll(archiveDir)
+		return 0, errors.Wrap(err, "failed to get updates")
+	}
+
+	// update last updated at time
+	if err := app.LastUpdateAtTime(foundApp.ID); err != nil {
+		os.RemoveAll(archiveDir)
+		return 0, errors.Wrap(err, "failed to update last updated at time")
+	}
+
+	schedule, err := GetSchedule(foundApp.ID)
+	if err != nil {
+		os.RemoveAll(archiveDir)
+		return 0, errors.Wrap(err, "failed to get update check schedule")
+	}
+
+	// if there are updates to download, go routine it
+	cursors := cursorsToDownload(updates, schedule.SelectUpdates)
+	if len(cursors) == 0 {
+		os.RemoveAll(archiveDir)
+		return int64(len(updates)), nil
+	}
+
+	go func() {
+		defer os.RemoveAll(archiveDir)
+		for _, cursor := range cursors {
+			// the latest version is in archive dir
+			if err := upstream.DownloadUpdate(foundApp.ID, archiveDir, cursor); err != nil {
+				logger.Error(err)
+			}
+		}
+	}()
+
+	return int64(len(updates)), nil
+}
+
+// getUpdates asks the upstream for the releases after the cursor of the app version in archiveDir
+func getUpdates(archiveDir string) ([]kotsupstream.Update, error) {
+	// we need a few objects from the app to check for updates
+	kotsKinds, err := kotsutil.LoadKotsKindsFromPath(archiveDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load kotskinds")
+	}
+	if kotsKinds.License == nil {
+		return nil, errors.New("app does not have a license")
+	}
+
+	getUpdatesOptions := kotspull.GetUpdatesOptions{
+		LicenseFile:    filepath.Join(archiveDir, "upstream", "userdata", "license.yaml"),
+		CurrentCursor:  kotsKinds.Installation.Spec.UpdateCursor,
+		CurrentChannel: kotsKinds.Installation.Spec.ChannelName,
+		Silent:         false,
+	}
+
+	updates, err := kotspull.GetUpdates(fmt.Sprintf("replicated://%s", kotsKinds.License.Spec.AppSlug), getUpdatesOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get updates from upstream")
+	}
+
+	return updates, nil
+}
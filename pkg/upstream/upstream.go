@@ -2,7 +2,6 @@ package upstream
 
 import (
 	"bufio"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"os"
@@ -10,9 +9,9 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/replicatedhq/kots/pkg/crypto"
 	kotspull "github.com/replicatedhq/kots/pkg/pull"
 	"github.com/replicatedhq/kotsadm/pkg/app"
+	"github.com/replicatedhq/kotsadm/pkg/encryptionkey"
 	"github.com/replicatedhq/kotsadm/pkg/kotsutil"
 	"github.com/replicatedhq/kotsadm/pkg/logger"
 	"github.com/replicatedhq/kotsadm/pkg/preflight"
@@ -95,17 +94,7 @@ func DownloadUpdate(appID string, archiveDir string, toCursor string) error {
 	if registrySettings != nil {
 		pullOptions.RewriteImages = true
 
-		cipher, err := crypto.AESCipherFromString(os.Getenv("API_ENCRYPTION_KEY"))
-		if err != nil {
-			return errors.Wrap(err, "failed to create aes cipher")
-		}
-
-		decodedPassword, err := base64.StdEncoding.DecodeString(registrySettings.PasswordEnc)
-		if err != nil {
-			return errors.Wrap(err, "failed to decode")
-		}
-
-		decryptedPassword, err := cipher.Decrypt([]byte(decodedPassword))
+		decryptedPassword, err := encryptionkey.Decrypt(registrySettings.PasswordEnc)
 		if err != nil {
 			return errors.Wrap(err, "failed to decrypt")
 		}
@@ -149,7 +138,7 @@ func DownloadUpdate(appID string, archiveDir string, toCursor string) error {
 		return errors.Wrap(err, "failed to create app version archive")
 	}
 
-	if err := preflight.Run(appID, newSequence, archiveDir); err != nil {
+	if err := preflight.Run(appID, newSequence, archiveDir, preflight.TriggerUpdate); err != nil {
 		finalError = err
 		return errors.Wrap(err, "failed to run preflights")
 	}